@@ -0,0 +1,260 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// имя ключа входит в логин key/<имя>, поэтому двоеточие, которое разделяет логин и пароль, в нём запрещено
+var apiKeyName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// APIKeyRequest - тело POST /api-keys, ExpiresAt - RFC3339, пустой - ключ бессрочный
+type APIKeyRequest struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	ExpiresAt   string   `json:"expiresAt"`
+}
+
+// KeyAuth пропускает запросы с заголовком Authorization: Bearer <ключ> к next
+// как запросы с логином key/<имя ключа> и ключом вместо пароля, поэтому обработчики
+// проверяют ключи тем же verify.User, что и пароли. Сам клиент логин key/<имя> не передаёт
+func KeyAuth(log *slog.Logger, s *sqlite.Storage, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			if user, _, basic := r.BasicAuth(); basic && verify.IsKeyLogin(user) {
+				log.Error("api key in basic auth")
+				http.Error(w, "use Bearer authorization for api keys", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := verify.Key(s, token)
+		if errors.Is(err, verify.ErrWrongCredentials) {
+			log.Error("wrong api key")
+			http.Error(w, "wrong api key", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Error("cant get api key", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		r.SetBasicAuth(verify.KeyLogin(key.Name), token)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
+}
+
+func keysAuth(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	ok = verify.User(user, pass, log, verify.KeysPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return "", false
+	}
+	log.Info("authorization was successful")
+	return user, true
+}
+
+// ValidateAPIKey проверяет запрос на ключ: ключ не может получить права, которых нет у user,
+// и права на выдачу ключей
+func ValidateAPIKey(s *sqlite.Storage, user string, req APIKeyRequest, now time.Time) (sqlite.APIKey, error) {
+	if !apiKeyName.MatchString(req.Name) {
+		return sqlite.APIKey{}, errors.New("wrong api key name, use up to 64 letters, digits, '.', '_' and '-'")
+	}
+
+	if len(req.Permissions) == 0 {
+		return sqlite.APIKey{}, errors.New("no api key permissions")
+	}
+	for _, permission := range req.Permissions {
+		if !verify.ValidKeyPermission(permission) || !verify.HasPermission(s, user, permission) {
+			return sqlite.APIKey{}, fmt.Errorf("wrong api key permission %q", permission)
+		}
+	}
+
+	key := sqlite.APIKey{Name: req.Name, Permissions: req.Permissions}
+	if req.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return sqlite.APIKey{}, errors.New("wrong expiresAt, use RFC3339")
+		}
+		if !expiresAt.After(now) {
+			return sqlite.APIKey{}, errors.New("expiresAt is in the past")
+		}
+		key.ExpiresAt = expiresAt.UTC().Format(time.DateTime)
+	}
+
+	return key, nil
+}
+
+func apiKeyID(log *slog.Logger, w http.ResponseWriter, r *http.Request) (int, bool) {
+	parts := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return 0, false
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid api key ID", slog.Any("error", err))
+		http.Error(w, "invalid api key ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /api-keys - все ключи, в том числе отозванные и истёкшие, без самих ключей
+func GetAPIKeys(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	if _, ok := keysAuth(log, s, w, r); !ok {
+		return
+	}
+
+	keys, err := sqlite.ListAPIKeys(s)
+	if err != nil {
+		log.Error("no api keys", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(log, w, http.StatusOK, keys)
+	log.Info("get api keys successfully")
+}
+
+// POST /api-keys выпускает ключ. Сам ключ есть только в этом ответе, сервер хранит его хеш
+func PostAPIKey(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, ok := keysAuth(log, s, w, r)
+	if !ok {
+		return
+	}
+
+	var req APIKeyRequest
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = json.Unmarshal(buf.Bytes(), &req); err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, err := ValidateAPIKey(s, user, req, time.Now())
+	if err != nil {
+		log.Error("wrong api key", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, prefix, err := verify.NewKey()
+	if err != nil {
+		log.Error("cant generate api key", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key.Prefix = prefix
+
+	id, err := sqlite.CreateAPIKey(s.As(user), key, verify.HashKey(token))
+	if errors.Is(err, sqlite.ErrAPIKeyExists) {
+		log.Error("api key exists", slog.String("name", key.Name))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error("error to post api key to storage", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	key, err = sqlite.GetAPIKey(s, id)
+	if err != nil {
+		log.Error("no api key", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key.Key = token
+
+	w.Header().Set("Location", "/api-keys/"+strconv.Itoa(id))
+	writeJSON(log, w, http.StatusCreated, key)
+	log.Info("api key created", slog.Int("id", id), slog.String("name", key.Name))
+}
+
+// GET /api-keys/{id}
+func GetOneAPIKey(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	if _, ok := keysAuth(log, s, w, r); !ok {
+		return
+	}
+	id, ok := apiKeyID(log, w, r)
+	if !ok {
+		return
+	}
+
+	key, err := sqlite.GetAPIKey(s, id)
+	if err != nil {
+		log.Error("no api key", slog.Any("error", err))
+		http.Error(w, "no such api key", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(log, w, http.StatusOK, key)
+	log.Info("get api key successfully", slog.Int("id", id))
+}
+
+// DELETE /api-keys/{id} отзывает ключ, он остаётся в списке с revokedAt
+func DeleteOneAPIKey(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, ok := keysAuth(log, s, w, r)
+	if !ok {
+		return
+	}
+	id, ok := apiKeyID(log, w, r)
+	if !ok {
+		return
+	}
+
+	err := sqlite.RevokeAPIKey(s.As(user), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Error("no active api key", slog.Any("error", err))
+		http.Error(w, "no such active api key", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("error to revoke api key", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("api key revoked", slog.Int("id", id))
+}
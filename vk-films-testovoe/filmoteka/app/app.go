@@ -2,22 +2,19 @@ package app
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 	
 	"vk-testovoe/filmoteka/storage"
 	"vk-testovoe/filmoteka/verify"
 )
 
-const(
-	layout = "02.01.2006"
-)
-
 func GetAllActors(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *http.Request){
 	user, pass, ok := r.BasicAuth()
 	if !ok {
@@ -33,16 +30,21 @@ func GetAllActors(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *
 		return
 	}
 	
-	sliceOfActors,err:=sqlite.GetAllActorsFromStorage(s, log)
+	deleted, ok := deletedParam(log, s, user, w, r)
+	if !ok {
+		return
+	}
+
+	sliceOfActors,err:=sqlite.GetAllActorsFromStorage(s, log, deleted)
 	if err != nil {
-		log.Error("no list of actors: %v", err)
+		log.Error("no list of actors", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	resp, err := json.Marshal(sliceOfActors)
 	if err != nil {
-		log.Error("cant json.marshal actors: %v", err)
+		log.Error("cant json.marshal actors", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -73,39 +75,34 @@ func PostActor(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *htt
 
 	_, err := buf.ReadFrom(r.Body)
 	if err != nil {
-		log.Error("wrong input:",err)
+		log.Error("wrong input", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	if err = json.Unmarshal(buf.Bytes(), &actor); err != nil {
-		log.Error("wrong unmarshal inputted:", err)
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if actor.Gender!="male" && actor.Gender!="female"{
-		log.Error("wrong gender")
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "wrong gender")
-		return
-	}
-
-	_, err = time.Parse(layout, actor.BirthDate)
+	err = ValidateActor(actor)
 	if err != nil {
-		log.Error("wrong BirthDate")
+		log.Error("invalid actor", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err=sqlite.PostActorToStorage(s,actor)
+	createMissing := r.URL.Query().Get("createMissing") == "true"
+
+	err=sqlite.PostActorToStorage(s.As(user),actor,createMissing)
 	if err != nil {
-		log.Error("error to post actor to storage:", err)
+		log.Error("error to post actor to storage", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusCreated)
 	io.WriteString(w, "Actor posted")
 }
@@ -134,21 +131,24 @@ func GetOneActor(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *h
 	}
 	actorID, err := strconv.Atoi(parts[2])
 	if err != nil {
-		log.Error("invalid actor ID:", err)
+		log.Error("invalid actor ID", slog.Any("error", err))
 		http.Error(w, "invalid actor ID", http.StatusBadRequest)
 		return
 	}
 	
 	actor,err:=sqlite.GetOneActorFromStorage(s, actorID, log)
+	if errors.Is(err, sql.ErrNoRows) && redirectAlias(log, s, w, r, sqlite.EntityPerson, actorID) {
+		return
+	}
 	if err != nil {
-		log.Error("no actor:", err)
+		log.Error("no actor", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
 	resp, err := json.Marshal(actor)
 	if err != nil {
-		log.Error("cant json.marshal actor:", err)
+		log.Error("cant json.marshal actor", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -183,7 +183,7 @@ func PutOneActor(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *h
 	}
 	actorID, err := strconv.Atoi(parts[2])
 	if err != nil {
-		log.Error("invalid actor ID:", err)
+		log.Error("invalid actor ID", slog.Any("error", err))
 		http.Error(w, "invalid actor ID", http.StatusBadRequest)
 		return
 	}
@@ -195,39 +195,39 @@ func PutOneActor(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *h
 
 	_, err = buf.ReadFrom(r.Body)
 	if err != nil {
-		log.Error("wrong input:",err)
+		log.Error("wrong input", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	if err = json.Unmarshal(buf.Bytes(), &actor); err != nil {
-		log.Error("wrong unmarshal inputted:", err)
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if (actor.Gender!="male") && (actor.Gender!="female"){
-		log.Error("wrong gender")
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "wrong gender")
+	err = ValidateActor(actor)
+	if err != nil {
+		log.Error("invalid actor", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	_, err = time.Parse(layout, actor.BirthDate)
-	if err != nil {
-		log.Error("wrong BirthDate")
+	createMissing := r.URL.Query().Get("createMissing") == "true"
+
+	err=sqlite.UpdateActor(s.As(user),actor,createMissing)
+	if errors.Is(err, sqlite.ErrUnknownRef) || errors.Is(err, sqlite.ErrAmbiguousRef) {
+		log.Error("wrong film reference", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	err=sqlite.UpdateActor(s,actor)
 	if err != nil {
-		log.Error("error to post actor to storage:", err)
+		log.Error("error to post actor to storage", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusCreated)
 	io.WriteString(w, "Actor updated")
 }
@@ -256,14 +256,14 @@ func DeleteOneActor(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r
 	}
 	actorID, err := strconv.Atoi(parts[2])
 	if err != nil {
-		log.Error("invalid actor ID:", err)
+		log.Error("invalid actor ID", slog.Any("error", err))
 		http.Error(w, "invalid actor ID", http.StatusBadRequest)
 		return
 	}
 	
-	err=sqlite.DeleteActor(s, actorID)
+	err=sqlite.DeleteActor(s.As(user), actorID)
 	if err != nil {
-		log.Error("no actor:", err)
+		log.Error("no actor", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
@@ -290,16 +290,54 @@ func GetAllFilms(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *h
 		return
 	}
 	
-	sliceOfFilms,err:=sqlite.GetAllFilmsFromStorage(s, log)
+	filter := sqlite.FilmFilter{
+		Genre: r.URL.Query().Get("genre"),
+		Sort:  r.URL.Query().Get("sort"),
+		Desc:  r.URL.Query().Get("order") == "desc",
+	}
+
+	filter.Deleted, ok = deletedParam(log, s, user, w, r)
+	if !ok {
+		return
+	}
+
+	for param, bound := range map[string]*string{"released_from": &filter.ReleasedFrom, "released_to": &filter.ReleasedTo} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		var err error
+		*bound, err = sqlite.NormalizeDate(value)
+		if err != nil {
+			log.Error("wrong "+param, slog.Any("error", err))
+			http.Error(w, "wrong "+param, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if filter.Sort != "" && !sqlite.ValidFilmSort(filter.Sort) {
+		log.Error("wrong sort")
+		http.Error(w, "wrong sort", http.StatusBadRequest)
+		return
+	}
+
+	sliceOfFilms,err:=sqlite.GetAllFilmsFromStorage(s, log, filter)
+	if err != nil {
+		log.Error("no list of films", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = sqlite.FillViewerFlags(s, user, sliceOfFilms)
 	if err != nil {
-		log.Error("no list of films: %v", err)
+		log.Error("no viewer flags", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	resp, err := json.Marshal(sliceOfFilms)
 	if err != nil {
-		log.Error("cant json.marshal films: %v", err)
+		log.Error("cant json.marshal films", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -330,53 +368,34 @@ func PostFilm(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *http
 
 	_, err := buf.ReadFrom(r.Body)
 	if err != nil {
-		log.Error("wrong input:",err)
+		log.Error("wrong input", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	if err = json.Unmarshal(buf.Bytes(), &film); err != nil {
-		log.Error("wrong unmarshal inputted:", err)
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if len(film.Title)<1 || len(film.Title)>150{
-		log.Error("wrong title")
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "wrong title")
-		return
-	}
-
-	if len(film.Description)>1000{
-		log.Error("too long description")
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "too long description")
-		return
-	}
-
-	if film.Rating<0||film.Rating>10{
-		log.Error("wrong rating")
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "wrong rating")
-		return
-	}
-
-	_, err = time.Parse(layout, film.ReleaseDate)
+	err = ValidateFilm(film)
 	if err != nil {
-		log.Error("wrong ReleaseDate")
+		log.Error("invalid film", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err=sqlite.PostFilmToStorage(s,film)
+	createMissing := r.URL.Query().Get("createMissing") == "true"
+
+	err=sqlite.PostFilmToStorage(s.As(user),film,createMissing)
 	if err != nil {
-		log.Error("error to post film to storage:", err)
+		log.Error("error to post film to storage", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusCreated)
 	io.WriteString(w, "Film posted")
 }
@@ -405,21 +424,33 @@ func GetOneFilm(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *ht
 	}
 	filmID, err := strconv.Atoi(parts[2])
 	if err != nil {
-		log.Error("invalid actor ID:", err)
+		log.Error("invalid actor ID", slog.Any("error", err))
 		http.Error(w, "invalid actor ID", http.StatusBadRequest)
 		return
 	}
 
 	film, err := sqlite.GetOneFilmFromStorage(s, filmID)
+	if errors.Is(err, sql.ErrNoRows) && redirectAlias(log, s, w, r, sqlite.EntityFilm, filmID) {
+		return
+	}
 	if err != nil {
-		log.Error("no film:", err)
+		log.Error("no film", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
+	films := []sqlite.Film{film}
+	err = sqlite.FillViewerFlags(s, user, films)
+	if err != nil {
+		log.Error("no viewer flags", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	film = films[0]
+
 	resp, err := json.Marshal(film)
 	if err != nil {
-		log.Error("cant json.marshal film:", err)
+		log.Error("cant json.marshal film", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -454,7 +485,7 @@ func PutOneFilm(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *ht
 	}
 	filmID, err := strconv.Atoi(parts[2])
 	if err != nil {
-		log.Error("invalid actor ID:", err)
+		log.Error("invalid actor ID", slog.Any("error", err))
 		http.Error(w, "invalid actor ID", http.StatusBadRequest)
 		return
 	}
@@ -466,60 +497,39 @@ func PutOneFilm(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r *ht
 
 	_, err = buf.ReadFrom(r.Body)
 	if err != nil {
-		log.Error("wrong input:", err)
+		log.Error("wrong input", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	if err = json.Unmarshal(buf.Bytes(), &film); err != nil {
-		log.Error("wrong unmarshal inputted:", err)
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if len(film.Title)<1 || len(film.Title)>150{
-		log.Error("wrong title")
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "wrong title")
-		return
-	}
-
-	if len(film.Description)>1000{
-		log.Error("too long description")
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "too long description")
-		return
-	}
-
-	if film.Rating<0||film.Rating>10{
-		log.Error("wrong rating")
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "wrong rating")
-		return
-	}
-
-	_, err = time.Parse(layout, film.ReleaseDate)
+	err = ValidateFilm(film)
 	if err != nil {
-		log.Error("wrong ReleaseDate")
+		log.Error("invalid film", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	_, err = time.Parse(layout, film.ReleaseDate)
-	if err != nil {
-		log.Error("wrong ReleaseDate")
+	createMissing := r.URL.Query().Get("createMissing") == "true"
+
+	err = sqlite.UpdateFilm(s.As(user), film, createMissing)
+	if errors.Is(err, sqlite.ErrUnknownRef) || errors.Is(err, sqlite.ErrAmbiguousRef) {
+		log.Error("wrong actor reference", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	err = sqlite.UpdateFilm(s, film)
 	if err != nil {
-		log.Error("error to update film to storage:", err)
+		log.Error("error to update film to storage", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusCreated)
 	io.WriteString(w, "Film updated")
 }
@@ -547,14 +557,14 @@ func DeleteOneFilm(log *slog.Logger, s *sqlite.Storage,w http.ResponseWriter, r
 	}
 	filmID, err := strconv.Atoi(parts[2])
 	if err != nil {
-		log.Error("invalid actor ID:", err)
+		log.Error("invalid actor ID", slog.Any("error", err))
 		http.Error(w, "invalid actor ID", http.StatusBadRequest)
 		return
 	}
 
-	err = sqlite.DeleteFilm(s, filmID)
+	err = sqlite.DeleteFilm(s.As(user), filmID)
 	if err != nil {
-		log.Error("no film:", err)
+		log.Error("no film", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// формат CreatedAt в AuditLog
+const auditTimeLayout = "2006-01-02 15:04:05"
+
+// parseAuditTime принимает RFC3339 или дату ГГГГ-ММ-ДД и приводит её к формату AuditLog
+func parseAuditTime(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return t.UTC().Format(auditTimeLayout), nil
+}
+
+// фильтры: user, entity, entityId, from (включительно), to (не включительно)
+func auditFilter(r *http.Request) (sqlite.AuditFilter, error) {
+	query := r.URL.Query()
+
+	filter := sqlite.AuditFilter{
+		Principal:  query.Get("user"),
+		EntityType: query.Get("entity"),
+	}
+
+	if filter.EntityType != "" && !sqlite.ValidEntityType(filter.EntityType) {
+		return filter, strconv.ErrSyntax
+	}
+
+	var err error
+	if v := query.Get("entityId"); v != "" {
+		filter.EntityId, err = strconv.Atoi(v)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	filter.From, err = parseAuditTime(query.Get("from"))
+	if err != nil {
+		return filter, err
+	}
+
+	filter.To, err = parseAuditTime(query.Get("to"))
+	return filter, err
+}
+
+func GetAuditLog(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.AuditPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := auditFilter(r)
+	if err != nil {
+		log.Error("wrong audit filter", slog.Any("error", err))
+		http.Error(w, "wrong audit filter", http.StatusBadRequest)
+		return
+	}
+
+	page, limit, err := pageParams(r)
+	if err != nil {
+		log.Error("wrong pagination", slog.Any("error", err))
+		http.Error(w, "wrong pagination", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := sqlite.GetAuditLogFromStorage(s, filter, page, limit)
+	if err != nil {
+		log.Error("no audit log", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(entries)
+	if err != nil {
+		log.Error("cant json.marshal audit log", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get audit log successfully")
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+type BackupInfo struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// делает копию в dir и удаляет лишние старые копии
+func backupToDir(log *slog.Logger, s *sqlite.Storage, dir string, keep int) (BackupInfo, error) {
+	path, err := sqlite.BackupToDir(s, dir)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	removed, err := sqlite.PruneBackups(dir, keep)
+	if err != nil {
+		log.Error("cant remove old backups", slog.Any("error", err))
+	}
+	for _, old := range removed {
+		log.Info("old backup removed", slog.String("path", old))
+	}
+
+	return BackupInfo{
+		Path:      path,
+		Size:      stat.Size(),
+		CreatedAt: stat.ModTime().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// ScheduleBackups раз в interval делает копию базы в dir и оставляет keep последних.
+// Пустой dir выключает плановые копии.
+func ScheduleBackups(log *slog.Logger, s *sqlite.Storage, dir string, interval time.Duration, keep int) {
+	if dir == "" || interval <= 0 {
+		return
+	}
+
+	log.Info("scheduled backups enabled", slog.String("dir", dir), slog.Duration("interval", interval), slog.Int("keep", keep))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := backupToDir(log, s, dir, keep)
+		if err != nil {
+			log.Error("scheduled backup failed", slog.Any("error", err))
+			continue
+		}
+		log.Info("scheduled backup created", slog.String("path", info.Path), slog.Int64("size", info.Size))
+	}
+}
+
+// копия создаётся только в каталоге из конфига, путь из запроса не принимается
+func PostBackup(log *slog.Logger, s *sqlite.Storage, dir string, keep int, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	if dir == "" {
+		log.Error("backup dir is not configured")
+		http.Error(w, "backup dir is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	info, err := backupToDir(log, s, dir, keep)
+	if err != nil {
+		log.Error("error to backup storage", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(info)
+	if err != nil {
+		log.Error("cant json.marshal backup info", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+	log.Info("backup created", slog.String("path", info.Path))
+}
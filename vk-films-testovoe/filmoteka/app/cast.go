@@ -0,0 +1,135 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// разбирает путь вида /films/{id}/cast/{actorId}
+func castIDs(path string) (int, int, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 5 {
+		return 0, 0, strconv.ErrSyntax
+	}
+
+	filmID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	actorID, err := strconv.Atoi(parts[4])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return filmID, actorID, nil
+}
+
+func PostCastMember(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	filmID, actorID, err := castIDs(r.URL.Path)
+	if err != nil {
+		log.Error("invalid URL path", slog.Any("error", err))
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+
+	var member sqlite.CastMember
+	var buf bytes.Buffer
+
+	_, err = buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// тело запроса необязательно: без него актёр добавляется в конец состава
+	if buf.Len() > 0 {
+		if err = json.Unmarshal(buf.Bytes(), &member); err != nil {
+			log.Error("wrong unmarshal inputted", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(member.Character) > 150 {
+		log.Error("wrong character")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong character")
+		return
+	}
+
+	if member.Position < 0 {
+		log.Error("wrong position")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong position")
+		return
+	}
+
+	err = sqlite.SetCastMember(s.As(user), filmID, actorID, member)
+	if err != nil {
+		log.Error("error to set cast member", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Cast updated")
+}
+
+func DeleteCastMember(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	filmID, actorID, err := castIDs(r.URL.Path)
+	if err != nil {
+		log.Error("invalid URL path", slog.Any("error", err))
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+
+	err = sqlite.DeleteCastMember(s.As(user), filmID, actorID)
+	if err != nil {
+		log.Error("no cast member", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("cast member deleted successfully")
+}
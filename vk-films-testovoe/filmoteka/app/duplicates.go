@@ -0,0 +1,253 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+
+	defaultDuplicateThreshold = 0.85
+	// завершённые отчёты хранятся в памяти, старые вытесняются
+	keepDuplicateJobs = 10
+)
+
+type JobProgress struct {
+	// вид записей, которые просматриваются сейчас
+	Stage string `json:"stage"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+}
+
+// DuplicateJob - фоновый поиск дублей. Pairs заполняется, когда поиск завершён.
+type DuplicateJob struct {
+	Id         int                    `json:"id"`
+	Kinds      []string               `json:"kinds"`
+	Threshold  float64                `json:"threshold"`
+	Status     string                 `json:"status"`
+	Progress   JobProgress            `json:"progress"`
+	StartedAt  string                 `json:"startedAt"`
+	FinishedAt string                 `json:"finishedAt,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Pairs      []sqlite.DuplicatePair `json:"pairs,omitempty"`
+}
+
+type duplicateJobs struct {
+	mu   sync.Mutex
+	next int
+	jobs []*DuplicateJob
+}
+
+var duplicates = &duplicateJobs{}
+
+func (d *duplicateJobs) start(kinds []string, threshold float64) *DuplicateJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.next++
+	job := &DuplicateJob{
+		Id:        d.next,
+		Kinds:     kinds,
+		Threshold: threshold,
+		Status:    JobRunning,
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	d.jobs = append(d.jobs, job)
+	// вытесняется самый старый завершённый отчёт, идущие поиски остаются в списке
+	for len(d.jobs) > keepDuplicateJobs {
+		oldest := -1
+		for i, job := range d.jobs {
+			if job.Status != JobRunning {
+				oldest = i
+				break
+			}
+		}
+		if oldest < 0 {
+			break
+		}
+		d.jobs = append(d.jobs[:oldest], d.jobs[oldest+1:]...)
+	}
+
+	return job
+}
+
+// update меняет задачу под блокировкой, читатели получают копии через get
+func (d *duplicateJobs) update(job *DuplicateJob, fn func(job *DuplicateJob)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(job)
+}
+
+func (d *duplicateJobs) get(id int) (DuplicateJob, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, job := range d.jobs {
+		if job.Id == id {
+			return *job, true
+		}
+	}
+	return DuplicateJob{}, false
+}
+
+func (d *duplicateJobs) list() []DuplicateJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	jobs := []DuplicateJob{}
+	for i := len(d.jobs) - 1; i >= 0; i-- {
+		job := *d.jobs[i]
+		job.Pairs = nil
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// runDuplicates ищет дубли по очереди для каждого вида записей
+func runDuplicates(log *slog.Logger, s *sqlite.Storage, job *DuplicateJob) {
+	pairs := []sqlite.DuplicatePair{}
+
+	for _, kind := range job.Kinds {
+		found, err := sqlite.FindDuplicates(s, kind, job.Threshold, func(done, total int) {
+			duplicates.update(job, func(job *DuplicateJob) {
+				job.Progress = JobProgress{Stage: kind, Done: done, Total: total}
+			})
+		})
+		if err != nil {
+			log.Error("duplicate search failed", slog.Int("job", job.Id), slog.Any("error", err))
+			duplicates.update(job, func(job *DuplicateJob) {
+				job.Status = JobFailed
+				job.Error = err.Error()
+				job.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+			})
+			return
+		}
+		pairs = append(pairs, found...)
+	}
+
+	duplicates.update(job, func(job *DuplicateJob) {
+		job.Status = JobDone
+		job.Pairs = pairs
+		job.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	})
+	log.Info("duplicate search finished", slog.Int("job", job.Id), slog.Int("pairs", len(pairs)))
+}
+
+func duplicatesAuth(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return false
+	}
+	log.Info("authorization was successful")
+	return true
+}
+
+func writeJSON(log *slog.Logger, w http.ResponseWriter, status int, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		log.Error("cant json.marshal response", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// POST /duplicates?kind=people&threshold=0.85 запускает поиск, без kind ищутся и люди, и фильмы
+func PostDuplicates(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	if !duplicatesAuth(log, s, w, r) {
+		return
+	}
+
+	kinds := []string{sqlite.DuplicatePeople, sqlite.DuplicateFilms}
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		if !sqlite.ValidDuplicateKind(kind) {
+			log.Error("wrong duplicate kind")
+			http.Error(w, "wrong kind", http.StatusBadRequest)
+			return
+		}
+		kinds = []string{kind}
+	}
+
+	threshold := defaultDuplicateThreshold
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		var err error
+		threshold, err = strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			log.Error("wrong duplicate threshold")
+			http.Error(w, "wrong threshold", http.StatusBadRequest)
+			return
+		}
+	}
+
+	job := duplicates.start(kinds, threshold)
+	// поиск переживает запрос, поэтому не зависит от его контекста
+	go runDuplicates(log, s, job)
+
+	snapshot, _ := duplicates.get(job.Id)
+	w.Header().Set("Location", "/duplicates/"+strconv.Itoa(job.Id))
+	writeJSON(log, w, http.StatusAccepted, snapshot)
+	log.Info("duplicate search started", slog.Int("job", job.Id))
+}
+
+// GET /duplicates - последние запуски поиска без найденных пар
+func GetDuplicateJobs(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	if !duplicatesAuth(log, s, w, r) {
+		return
+	}
+
+	writeJSON(log, w, http.StatusOK, duplicates.list())
+	log.Info("get duplicate jobs successfully")
+}
+
+// GET /duplicates/{id} - прогресс поиска, а после завершения и найденные пары
+func GetDuplicateJob(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	if !duplicatesAuth(log, s, w, r) {
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid job ID", slog.Any("error", err))
+		http.Error(w, "invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, ok := duplicates.get(id)
+	if !ok {
+		log.Error("no duplicate job")
+		http.Error(w, "no such job", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(log, w, http.StatusOK, job)
+	log.Info("get duplicate job successfully")
+}
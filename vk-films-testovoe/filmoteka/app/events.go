@@ -0,0 +1,199 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+const (
+	// EventReset приходит вместо пропущенных событий, которые уже удалены очисткой:
+	// клиенту нужно перечитать каталог целиком
+	EventReset = "reset"
+
+	// сколько событий читается из базы за раз
+	eventsBatch = 100
+	// если событий нет дольше, в поток пишется комментарий, чтобы прокси не закрыли соединение
+	eventsKeepAlive = 15 * time.Second
+)
+
+// ScheduleEventsPrune раз в interval удаляет события ленты и завершённые доставки подписчикам старше retention.
+// retention <= 0 выключает очистку.
+func ScheduleEventsPrune(log *slog.Logger, s *sqlite.Storage, retention, interval time.Duration) {
+	if retention <= 0 || interval <= 0 {
+		return
+	}
+
+	log.Info("events prune enabled", slog.Duration("retention", retention), slog.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pruned, err := sqlite.PruneEvents(s, retention)
+		if err != nil {
+			log.Error("events prune failed", slog.Any("error", err))
+			continue
+		}
+		if pruned > 0 {
+			log.Info("events pruned", slog.Int("count", pruned))
+		}
+
+		pruned, err = sqlite.PruneDeliveries(s, retention)
+		if err != nil {
+			log.Error("webhook deliveries prune failed", slog.Any("error", err))
+			continue
+		}
+		if pruned > 0 {
+			log.Info("webhook deliveries pruned", slog.Int("count", pruned))
+		}
+	}
+}
+
+// lastEventID читает Last-Event-ID или ?lastEventId. Второе значение false, если клиент не продолжает поток
+func lastEventID(r *http.Request) (int, bool, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return 0, false, strconv.ErrSyntax
+	}
+	return id, true, nil
+}
+
+func writeEvent(w io.Writer, event sqlite.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.EventId, data)
+	return err
+}
+
+// /events - лента изменений в формате Server-Sent Events. Поток раз в poll читает новые события
+// из таблицы Events, поэтому видит и изменения, сделанные другим процессом с той же базой.
+// poll <= 0 - раз в секунду.
+func GetEvents(log *slog.Logger, s *sqlite.Storage, poll time.Duration, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	last, resume, err := lastEventID(r)
+	if err != nil {
+		log.Error("wrong Last-Event-ID", slog.Any("error", err))
+		http.Error(w, "wrong Last-Event-ID", http.StatusBadRequest)
+		return
+	}
+
+	first, newest, err := sqlite.EventRange(s)
+	if err != nil {
+		log.Error("no events", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// поток открыт дольше, чем WriteTimeout сервера
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		log.Warn("cant reset write deadline", slog.Any("error", err))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	switch {
+	case !resume:
+		last = newest
+	// события после last уже удалены очисткой, или база заменена копией, в которой их ещё нет
+	case last+1 < first || last > newest:
+		last = first - 1
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: {\"type\":%q}\n\n", last, EventReset, EventReset)
+		if err != nil {
+			return
+		}
+	}
+
+	err = rc.Flush()
+	if err != nil {
+		log.Error("cant flush events", slog.Any("error", err))
+		return
+	}
+
+	if poll <= 0 {
+		poll = time.Second
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+
+	log.Info("events stream started", slog.Int("lastEventId", last))
+
+	for {
+		events, err := sqlite.EventsAfter(s, last, eventsBatch)
+		if err != nil {
+			log.Error("cant read events", slog.Any("error", err))
+			return
+		}
+
+		for _, event := range events {
+			err = writeEvent(w, event)
+			if err != nil {
+				return
+			}
+			last = event.EventId
+		}
+
+		wrote := len(events) > 0
+		if !wrote && time.Since(lastWrite) >= eventsKeepAlive {
+			_, err = io.WriteString(w, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+			wrote = true
+		}
+
+		if wrote {
+			if err = rc.Flush(); err != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+
+		// пачка заполнена целиком - в базе есть ещё события
+		if len(events) == eventsBatch {
+			continue
+		}
+
+		select {
+		case <-r.Context().Done():
+			log.Info("events stream closed", slog.Int("lastEventId", last))
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package app
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+const FormatSQL = "sql"
+
+// тип содержимого и имя файла для каждого формата выгрузки
+var exportFiles = map[string][2]string{
+	FormatJSONL: {"application/x-ndjson", "filmoteka.jsonl"},
+	FormatCSV:   {"application/zip", "filmoteka.zip"},
+	FormatSQL:   {"application/sql", "filmoteka.sql"},
+}
+
+func ValidExportFormat(format string) bool {
+	_, ok := exportFiles[format]
+	return ok
+}
+
+// Export выгружает весь каталог в w в одной читающей транзакции.
+// Строки пишутся по мере чтения, каталог целиком в памяти не держится.
+//
+//	jsonl - строка на запись: {"table":"films","row":{...}}
+//	csv   - zip-архив с файлом на каждую таблицу
+//	sql   - CREATE TABLE и INSERT без особенностей SQLite
+func Export(s *sqlite.Storage, w io.Writer, format string) error {
+	if !ValidExportFormat(format) {
+		return fmt.Errorf("wrong format %q", format)
+	}
+
+	return sqlite.RunExport(s, func(x *sqlite.Export) error {
+		switch format {
+		case FormatJSONL:
+			return exportJSONL(x, w)
+		case FormatCSV:
+			return exportCSV(x, w)
+		default:
+			return exportSQL(x, w)
+		}
+	})
+}
+
+func exportJSONL(x *sqlite.Export, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, table := range sqlite.ExportTables {
+		prefix := `{"table":` + strconv.Quote(table.Name) + `,"row":{`
+		keys := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			keys[i] = strconv.Quote(column.Name) + ":"
+		}
+
+		err := x.Rows(table, func(values []any) error {
+			bw.WriteString(prefix)
+			for i, value := range values {
+				if i > 0 {
+					bw.WriteByte(',')
+				}
+				data, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				bw.WriteString(keys[i])
+				bw.Write(data)
+			}
+			_, err := bw.WriteString("}}\n")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+func exportCSV(x *sqlite.Export, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	for _, table := range sqlite.ExportTables {
+		f, err := zw.Create(table.Name + ".csv")
+		if err != nil {
+			return err
+		}
+
+		cw := csv.NewWriter(f)
+		record := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			record[i] = column.Name
+		}
+		cw.Write(record)
+
+		err = x.Rows(table, func(values []any) error {
+			for i, value := range values {
+				record[i] = exportText(value)
+			}
+			return cw.Write(record)
+		})
+		if err != nil {
+			return err
+		}
+
+		cw.Flush()
+		if err = cw.Error(); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func exportSQL(x *sqlite.Export, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "-- filmoteka export, schema version %d\n", sqlite.SchemaVersion())
+	bw.WriteString("BEGIN;\n")
+
+	for _, table := range sqlite.ExportTables {
+		names := make([]string, len(table.Columns))
+		definitions := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			names[i] = column.Name
+			definitions[i] = column.Name + " " + column.Type
+		}
+
+		fmt.Fprintf(bw, "\nCREATE TABLE %s (%s);\n", table.Name, strings.Join(definitions, ", "))
+		prefix := "INSERT INTO " + table.Name + " (" + strings.Join(names, ", ") + ") VALUES ("
+
+		literals := make([]string, len(table.Columns))
+		err := x.Rows(table, func(values []any) error {
+			for i, value := range values {
+				literals[i] = sqlLiteral(value)
+			}
+			_, err := bw.WriteString(prefix + strings.Join(literals, ", ") + ");\n")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	bw.WriteString("\nCOMMIT;\n")
+	return bw.Flush()
+}
+
+func exportText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func sqlLiteral(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return exportText(v)
+	}
+}
+
+func GetExport(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatJSONL
+	}
+	if !ValidExportFormat(format) {
+		log.Error("wrong export format")
+		http.Error(w, "wrong format", http.StatusBadRequest)
+		return
+	}
+
+	// большой каталог выгружается дольше, чем WriteTimeout сервера
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		log.Warn("cant reset write deadline", slog.Any("error", err))
+	}
+
+	w.Header().Set("Content-Type", exportFiles[format][0])
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportFiles[format][1]+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// после начала выгрузки статус уже не поменять, ошибка только логируется
+	err = Export(s, w, format)
+	if err != nil {
+		log.Error("error to export", slog.Any("error", err))
+		return
+	}
+
+	log.Info("export finished", slog.String("format", format))
+}
@@ -0,0 +1,260 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+func GetAllGenres(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	sliceOfGenres, err := sqlite.GetAllGenresFromStorage(s, log)
+	if err != nil {
+		log.Error("no list of genres", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(sliceOfGenres)
+	if err != nil {
+		log.Error("cant json.marshal genres", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get genres successfully")
+}
+
+func PostGenre(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	var genre sqlite.Genre
+	var buf bytes.Buffer
+
+	_, err := buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), &genre); err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	genre.Name = strings.TrimSpace(genre.Name)
+	if len(genre.Name) < 1 || len(genre.Name) > 100 {
+		log.Error("wrong genre name")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong genre name")
+		return
+	}
+
+	err = sqlite.PostGenreToStorage(s.As(user), genre)
+	if err != nil {
+		log.Error("error to post genre to storage", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Genre posted")
+}
+
+func GetOneGenre(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	genreID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid genre ID", slog.Any("error", err))
+		http.Error(w, "invalid genre ID", http.StatusBadRequest)
+		return
+	}
+
+	genre, err := sqlite.GetOneGenreFromStorage(s, genreID)
+	if err != nil {
+		log.Error("no genre", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	resp, err := json.Marshal(genre)
+	if err != nil {
+		log.Error("cant json.marshal genre", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get genre successfully")
+}
+
+func PutOneGenre(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	genreID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid genre ID", slog.Any("error", err))
+		http.Error(w, "invalid genre ID", http.StatusBadRequest)
+		return
+	}
+
+	var genre sqlite.Genre
+	var buf bytes.Buffer
+
+	_, err = buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), &genre); err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	genre.GenreId = genreID
+
+	genre.Name = strings.TrimSpace(genre.Name)
+	if len(genre.Name) < 1 || len(genre.Name) > 100 {
+		log.Error("wrong genre name")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong genre name")
+		return
+	}
+
+	err = sqlite.UpdateGenre(s.As(user), genre)
+	if errors.Is(err, sqlite.ErrGenreExists) {
+		log.Error("genre exists", slog.String("name", genre.Name))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error("error to update genre in storage", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Genre updated")
+}
+
+func DeleteOneGenre(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	genreID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid genre ID", slog.Any("error", err))
+		http.Error(w, "invalid genre ID", http.StatusBadRequest)
+		return
+	}
+
+	err = sqlite.DeleteGenre(s.As(user), genreID)
+	if err != nil {
+		log.Error("no genre", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("genre deleted successfully")
+}
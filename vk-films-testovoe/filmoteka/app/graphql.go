@@ -0,0 +1,945 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema.graphql
+var graphSchemaSource string
+
+var graphSchema = graphql.MustParseSchema(graphSchemaSource, &graphRoot{}, graphql.MaxDepth(12))
+
+// размер страницы в films и actors
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type graphParams struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// //GraphQL
+//
+// GraphQL выполняет POST /graphql с телом {"query", "operationName", "variables"}.
+// Чтение доступно с правом read, изменения проверяют права внутри мутаций.
+func GraphQL(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	var params graphParams
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphRequestKey{}, newGraphRequest(log, s, user))
+	resp := graphSchema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+	for _, queryErr := range resp.Errors {
+		log.Error("graphql error", slog.Any("error", queryErr))
+	}
+
+	writeJSON(log, w, http.StatusOK, resp)
+	log.Info("graphql query executed")
+}
+
+type graphRequestKey struct{}
+
+// graphRequest - состояние одного запроса: пользователь и загрузчики связей
+type graphRequest struct {
+	log  *slog.Logger
+	s    *sqlite.Storage
+	user string
+
+	films         *loader[sqlite.Film]
+	actors        *loader[sqlite.Actor]
+	filmCredits   *loader[[]sqlite.Credit]
+	personCredits *loader[[]sqlite.Credit]
+	genres        *loader[[]string]
+
+	// личные списки читаются один раз на запрос
+	listsOnce sync.Once
+	watchlist []sqlite.WatchlistEntry
+	watched   []sqlite.WatchedEntry
+	listsErr  error
+}
+
+// загрузка каждого уровня регистрирует ID следующего, поэтому вложенный запрос
+// выполняет по одной выборке на уровень, а не на каждую запись
+func newGraphRequest(log *slog.Logger, s *sqlite.Storage, user string) *graphRequest {
+	req := &graphRequest{log: log, s: s, user: user}
+
+	req.films = newLoader(func(ids []int) (map[int]sqlite.Film, error) {
+		films, err := sqlite.FilmsByID(s, ids)
+		if err != nil {
+			return nil, err
+		}
+		for id := range films {
+			req.primeFilm(id)
+		}
+		return films, nil
+	})
+
+	req.actors = newLoader(func(ids []int) (map[int]sqlite.Actor, error) {
+		actors, err := sqlite.ActorsByID(s, ids)
+		if err != nil {
+			return nil, err
+		}
+		for id := range actors {
+			req.personCredits.prime(id)
+		}
+		return actors, nil
+	})
+
+	req.filmCredits = newLoader(func(ids []int) (map[int][]sqlite.Credit, error) {
+		credits, err := sqlite.CreditsForFilms(s, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, list := range credits {
+			for _, credit := range list {
+				req.actors.prime(credit.PersonId)
+			}
+		}
+		return credits, nil
+	})
+
+	req.personCredits = newLoader(func(ids []int) (map[int][]sqlite.Credit, error) {
+		credits, err := sqlite.CreditsForPeople(s, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, list := range credits {
+			for _, credit := range list {
+				req.films.prime(credit.FilmId)
+			}
+		}
+		return credits, nil
+	})
+
+	req.genres = newLoader(func(ids []int) (map[int][]string, error) {
+		return sqlite.GenresForFilms(s, ids)
+	})
+
+	return req
+}
+
+func graphRequestFrom(ctx context.Context) *graphRequest {
+	return ctx.Value(graphRequestKey{}).(*graphRequest)
+}
+
+func (req *graphRequest) primeFilm(id int) {
+	req.filmCredits.prime(id)
+	req.genres.prime(id)
+}
+
+func (req *graphRequest) allow(permission string) error {
+	if !verify.HasPermission(req.s, req.user, permission) {
+		return errors.New("wrong role")
+	}
+	return nil
+}
+
+func (req *graphRequest) lists() error {
+	req.listsOnce.Do(func() {
+		req.watchlist, req.listsErr = sqlite.GetWatchlistFromStorage(req.s, req.user)
+		if req.listsErr != nil {
+			return
+		}
+		req.watched, req.listsErr = sqlite.GetWatchedFromStorage(req.s, req.user)
+	})
+	return req.listsErr
+}
+
+func (req *graphRequest) filmResolvers(films []sqlite.Film) []*filmResolver {
+	res := make([]*filmResolver, 0, len(films))
+	for _, film := range films {
+		req.primeFilm(film.FilmId)
+		res = append(res, &filmResolver{req: req, film: film})
+	}
+	return res
+}
+
+func (req *graphRequest) loadFilm(id int) (*filmResolver, error) {
+	film, ok, err := req.films.load(id)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &filmResolver{req: req, film: film}, nil
+}
+
+// requireFilm - для полей, где фильм обязателен: удалённые фильмы
+// в роли и личные списки не попадают, так что пустой ответ - ошибка
+func (req *graphRequest) requireFilm(id int) (*filmResolver, error) {
+	film, err := req.loadFilm(id)
+	if err == nil && film == nil {
+		err = errors.New("film not found")
+	}
+	return film, err
+}
+
+func (req *graphRequest) loadActor(id int) (*actorResolver, error) {
+	actor, ok, err := req.actors.load(id)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &actorResolver{req: req, actor: actor}, nil
+}
+
+// pageBounds проверяет first и offset и подставляет значения по умолчанию
+func pageBounds(first, offset *int32) (int, int, error) {
+	limit, skip := defaultPageSize, 0
+	if first != nil {
+		limit = int(*first)
+	}
+	if offset != nil {
+		skip = int(*offset)
+	}
+	if limit < 0 || limit > maxPageSize {
+		return 0, 0, errors.New("first must be between 0 and " + strconv.Itoa(maxPageSize))
+	}
+	if skip < 0 {
+		return 0, 0, errors.New("offset must not be negative")
+	}
+	return limit, skip, nil
+}
+
+func parseGraphID(id graphql.ID, what string) (int, error) {
+	n, err := strconv.Atoi(string(id))
+	if err != nil {
+		return 0, errors.New("invalid " + what + " ID")
+	}
+	return n, nil
+}
+
+func graphID(id int) graphql.ID {
+	return graphql.ID(strconv.Itoa(id))
+}
+
+// //Запросы
+
+type graphRoot struct{}
+
+func (*graphRoot) Film(ctx context.Context, args struct{ ID graphql.ID }) (*filmResolver, error) {
+	id, err := parseGraphID(args.ID, "film")
+	if err != nil {
+		return nil, err
+	}
+	return graphRequestFrom(ctx).loadFilm(id)
+}
+
+type filmsArgs struct {
+	Genre        *string
+	ReleasedFrom *string
+	ReleasedTo   *string
+	Sort         *string
+	Desc         *bool
+	First        *int32
+	Offset       *int32
+}
+
+func (*graphRoot) Films(ctx context.Context, args filmsArgs) (*filmPageResolver, error) {
+	req := graphRequestFrom(ctx)
+
+	filter := sqlite.FilmFilter{}
+	if args.Genre != nil {
+		filter.Genre = *args.Genre
+	}
+	if args.Sort != nil {
+		if !sqlite.ValidFilmSort(*args.Sort) {
+			return nil, errors.New("wrong sort")
+		}
+		filter.Sort = *args.Sort
+	}
+	if args.Desc != nil {
+		filter.Desc = *args.Desc
+	}
+
+	var err error
+	if args.ReleasedFrom != nil {
+		filter.ReleasedFrom, err = sqlite.NormalizeDate(*args.ReleasedFrom)
+		if err != nil {
+			return nil, errors.New("wrong releasedFrom")
+		}
+	}
+	if args.ReleasedTo != nil {
+		filter.ReleasedTo, err = sqlite.NormalizeDate(*args.ReleasedTo)
+		if err != nil {
+			return nil, errors.New("wrong releasedTo")
+		}
+	}
+
+	return req.findFilms(filter, args.First, args.Offset)
+}
+
+func (req *graphRequest) findFilms(filter sqlite.FilmFilter, first, offset *int32) (*filmPageResolver, error) {
+	limit, skip, err := pageBounds(first, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	films, total, err := sqlite.FindFilms(req.s, filter, limit, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filmPageResolver{
+		total: total,
+		next:  skip+len(films) < total,
+		items: req.filmResolvers(films),
+	}, nil
+}
+
+func (*graphRoot) Actor(ctx context.Context, args struct{ ID graphql.ID }) (*actorResolver, error) {
+	id, err := parseGraphID(args.ID, "actor")
+	if err != nil {
+		return nil, err
+	}
+	return graphRequestFrom(ctx).loadActor(id)
+}
+
+type actorsArgs struct {
+	Name   *string
+	First  *int32
+	Offset *int32
+}
+
+func (*graphRoot) Actors(ctx context.Context, args actorsArgs) (*actorPageResolver, error) {
+	req := graphRequestFrom(ctx)
+
+	limit, skip, err := pageBounds(args.First, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ""
+	if args.Name != nil {
+		name = *args.Name
+	}
+
+	actors, total, err := sqlite.FindActors(req.s, name, limit, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*actorResolver, 0, len(actors))
+	for _, actor := range actors {
+		req.personCredits.prime(actor.ActorId)
+		items = append(items, &actorResolver{req: req, actor: actor})
+	}
+
+	return &actorPageResolver{total: total, next: skip+len(actors) < total, items: items}, nil
+}
+
+func (*graphRoot) Genres(ctx context.Context) ([]*genreResolver, error) {
+	req := graphRequestFrom(ctx)
+
+	genres, err := sqlite.GetAllGenresFromStorage(req.s, req.log)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*genreResolver, 0, len(genres))
+	for _, genre := range genres {
+		res = append(res, &genreResolver{req: req, genre: genre})
+	}
+	return res, nil
+}
+
+func (*graphRoot) Me(ctx context.Context) *userResolver {
+	return &userResolver{req: graphRequestFrom(ctx)}
+}
+
+// //Изменения
+
+type refInput struct {
+	ID   *graphql.ID
+	Name *string
+}
+
+type creditInput struct {
+	PersonID  *graphql.ID
+	Name      *string
+	Role      string
+	Character *string
+	Job       *string
+	Position  *int32
+}
+
+type filmInput struct {
+	Title        string
+	Description  *string
+	CriticRating *int32
+	ReleaseDate  string
+	Actors       *[]refInput
+	Genres       *[]string
+	Credits      *[]creditInput
+}
+
+type actorInput struct {
+	Name      string
+	Gender    string
+	BirthDate string
+	Films     *[]refInput
+}
+
+func deref[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+	return *v
+}
+
+func (input refInput) ref() (sqlite.Ref, error) {
+	ref := sqlite.Ref{Name: deref(input.Name)}
+	if input.ID != nil {
+		id, err := parseGraphID(*input.ID, "ref")
+		if err != nil {
+			return sqlite.Ref{}, err
+		}
+		ref.Id = id
+	}
+	return ref, nil
+}
+
+func refs(inputs *[]refInput) ([]sqlite.Ref, error) {
+	res := []sqlite.Ref{}
+	for _, input := range deref(inputs) {
+		ref, err := input.ref()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ref)
+	}
+	return res, nil
+}
+
+// film накладывает переданные поля на film, пропущенные необязательные поля остаются как были
+func (input filmInput) film(film sqlite.Film) (sqlite.Film, error) {
+	film.Title = input.Title
+	film.ReleaseDate = input.ReleaseDate
+	if input.Description != nil {
+		film.Description = *input.Description
+	}
+	if input.CriticRating != nil {
+		film.CriticRating = int(*input.CriticRating)
+	}
+	if input.Genres != nil {
+		film.Genres = *input.Genres
+	}
+
+	// actors и credits вместе задают состав фильма, поэтому заменяются только вместе
+	if input.Actors != nil || input.Credits != nil {
+		var err error
+		film.Actors, err = refs(input.Actors)
+		if err != nil {
+			return sqlite.Film{}, err
+		}
+
+		film.Credits = nil
+		for _, credit := range deref(input.Credits) {
+			ref, err := refInput{ID: credit.PersonID, Name: credit.Name}.ref()
+			if err != nil {
+				return sqlite.Film{}, err
+			}
+			film.Credits = append(film.Credits, sqlite.Credit{
+				PersonId:  ref.Id,
+				Name:      ref.Name,
+				Role:      credit.Role,
+				Character: deref(credit.Character),
+				Job:       deref(credit.Job),
+				Position:  int(deref(credit.Position)),
+			})
+		}
+	}
+
+	return film, ValidateFilm(film)
+}
+
+func (input actorInput) actor(actor sqlite.Actor) (sqlite.Actor, error) {
+	actor.Name = input.Name
+	actor.Gender = input.Gender
+	actor.BirthDate = input.BirthDate
+
+	if input.Films != nil {
+		var err error
+		actor.Films, err = refs(input.Films)
+		if err != nil {
+			return sqlite.Actor{}, err
+		}
+	}
+
+	return actor, ValidateActor(actor)
+}
+
+// изменённая запись читается мимо загрузчиков, в кэше может быть старая версия
+func (req *graphRequest) freshFilm(id int) (*filmResolver, error) {
+	film, err := sqlite.GetOneFilmFromStorage(req.s, id)
+	if err != nil {
+		return nil, err
+	}
+	return &filmResolver{req: req, film: film}, nil
+}
+
+func (req *graphRequest) freshActor(id int) (*actorResolver, error) {
+	actor, err := sqlite.GetOneActorFromStorage(req.s, id, req.log)
+	if err != nil {
+		return nil, err
+	}
+	return &actorResolver{req: req, actor: actor}, nil
+}
+
+func notFound(err error, what string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New(what + " not found")
+	}
+	return err
+}
+
+type createFilmArgs struct {
+	Input         filmInput
+	CreateMissing *bool
+}
+
+func (*graphRoot) CreateFilm(ctx context.Context, args createFilmArgs) (*filmResolver, error) {
+	req := graphRequestFrom(ctx)
+	if err := req.allow(verify.WritePermission); err != nil {
+		return nil, err
+	}
+
+	film, err := args.Input.film(sqlite.Film{})
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := sqlite.CreateFilm(req.s.As(req.user), film, deref(args.CreateMissing))
+	if err != nil {
+		return nil, err
+	}
+
+	return req.freshFilm(id)
+}
+
+type updateFilmArgs struct {
+	ID            graphql.ID
+	Input         filmInput
+	CreateMissing *bool
+}
+
+func (*graphRoot) UpdateFilm(ctx context.Context, args updateFilmArgs) (*filmResolver, error) {
+	req := graphRequestFrom(ctx)
+	if err := req.allow(verify.WritePermission); err != nil {
+		return nil, err
+	}
+
+	id, err := parseGraphID(args.ID, "film")
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := sqlite.GetOneFilmFromStorage(req.s, id)
+	if err != nil {
+		return nil, notFound(err, "film")
+	}
+	// актёры уже есть среди участников вместе с позициями
+	stored.Actors = nil
+
+	film, err := args.Input.film(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlite.UpdateFilm(req.s.As(req.user), film, deref(args.CreateMissing))
+	if err != nil {
+		return nil, notFound(err, "film")
+	}
+
+	return req.freshFilm(id)
+}
+
+func (*graphRoot) DeleteFilm(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	req := graphRequestFrom(ctx)
+	if err := req.allow(verify.WritePermission); err != nil {
+		return false, err
+	}
+
+	id, err := parseGraphID(args.ID, "film")
+	if err != nil {
+		return false, err
+	}
+
+	err = sqlite.DeleteFilm(req.s.As(req.user), id)
+	if err != nil {
+		return false, notFound(err, "film")
+	}
+
+	return true, nil
+}
+
+type createActorArgs struct {
+	Input         actorInput
+	CreateMissing *bool
+}
+
+func (*graphRoot) CreateActor(ctx context.Context, args createActorArgs) (*actorResolver, error) {
+	req := graphRequestFrom(ctx)
+	if err := req.allow(verify.WritePermission); err != nil {
+		return nil, err
+	}
+
+	actor, err := args.Input.actor(sqlite.Actor{})
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := sqlite.CreateActor(req.s.As(req.user), actor, deref(args.CreateMissing))
+	if err != nil {
+		return nil, err
+	}
+
+	return req.freshActor(id)
+}
+
+type updateActorArgs struct {
+	ID            graphql.ID
+	Input         actorInput
+	CreateMissing *bool
+}
+
+func (*graphRoot) UpdateActor(ctx context.Context, args updateActorArgs) (*actorResolver, error) {
+	req := graphRequestFrom(ctx)
+	if err := req.allow(verify.WritePermission); err != nil {
+		return nil, err
+	}
+
+	id, err := parseGraphID(args.ID, "actor")
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := sqlite.GetOneActorFromStorage(req.s, id, req.log)
+	if err != nil {
+		return nil, notFound(err, "actor")
+	}
+
+	actor, err := args.Input.actor(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlite.UpdateActor(req.s.As(req.user), actor, deref(args.CreateMissing))
+	if err != nil {
+		return nil, notFound(err, "actor")
+	}
+
+	return req.freshActor(id)
+}
+
+func (*graphRoot) DeleteActor(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	req := graphRequestFrom(ctx)
+	if err := req.allow(verify.WritePermission); err != nil {
+		return false, err
+	}
+
+	id, err := parseGraphID(args.ID, "actor")
+	if err != nil {
+		return false, err
+	}
+
+	err = sqlite.DeleteActor(req.s.As(req.user), id)
+	if err != nil {
+		return false, notFound(err, "actor")
+	}
+
+	return true, nil
+}
+
+// //Типы
+
+type filmPageResolver struct {
+	total int
+	next  bool
+	items []*filmResolver
+}
+
+func (p *filmPageResolver) TotalCount() int32      { return int32(p.total) }
+func (p *filmPageResolver) HasNextPage() bool      { return p.next }
+func (p *filmPageResolver) Items() []*filmResolver { return p.items }
+
+type actorPageResolver struct {
+	total int
+	next  bool
+	items []*actorResolver
+}
+
+func (p *actorPageResolver) TotalCount() int32       { return int32(p.total) }
+func (p *actorPageResolver) HasNextPage() bool       { return p.next }
+func (p *actorPageResolver) Items() []*actorResolver { return p.items }
+
+type filmResolver struct {
+	req  *graphRequest
+	film sqlite.Film
+}
+
+func (f *filmResolver) ID() graphql.ID      { return graphID(f.film.FilmId) }
+func (f *filmResolver) Title() string       { return f.film.Title }
+func (f *filmResolver) Description() string { return f.film.Description }
+func (f *filmResolver) CriticRating() int32 { return int32(f.film.CriticRating) }
+func (f *filmResolver) ReleaseDate() string { return f.film.ReleaseDate }
+
+func (f *filmResolver) UserScore() *scoreResolver {
+	return &scoreResolver{score: f.film.UserScore}
+}
+
+func (f *filmResolver) Genres() ([]string, error) {
+	genres, _, err := f.req.genres.load(f.film.FilmId)
+	if genres == nil {
+		genres = []string{}
+	}
+	return genres, err
+}
+
+func (f *filmResolver) credits() ([]sqlite.Credit, error) {
+	credits, _, err := f.req.filmCredits.load(f.film.FilmId)
+	return credits, err
+}
+
+func (f *filmResolver) Cast() ([]*actorResolver, error) {
+	credits, err := f.credits()
+	if err != nil {
+		return nil, err
+	}
+
+	cast := []*actorResolver{}
+	for _, credit := range credits {
+		if credit.Role != sqlite.RoleActor {
+			continue
+		}
+		actor, err := f.req.loadActor(credit.PersonId)
+		if err != nil {
+			return nil, err
+		}
+		if actor != nil {
+			cast = append(cast, actor)
+		}
+	}
+	return cast, nil
+}
+
+func (f *filmResolver) Credits() ([]*creditResolver, error) {
+	credits, err := f.credits()
+	if err != nil {
+		return nil, err
+	}
+	return creditResolvers(f.req, credits), nil
+}
+
+func (f *filmResolver) InWatchlist() (bool, error) {
+	if err := f.req.lists(); err != nil {
+		return false, err
+	}
+	for _, entry := range f.req.watchlist {
+		if entry.Film.Id == f.film.FilmId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *filmResolver) Watched() (bool, error) {
+	if err := f.req.lists(); err != nil {
+		return false, err
+	}
+	for _, entry := range f.req.watched {
+		if entry.Film.Id == f.film.FilmId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type scoreResolver struct {
+	score sqlite.FilmScore
+}
+
+func (s *scoreResolver) Average() float64 { return s.score.Average }
+func (s *scoreResolver) Votes() int32     { return int32(s.score.Votes) }
+
+func (s *scoreResolver) Histogram() []int32 {
+	res := make([]int32, len(s.score.Histogram))
+	for i, n := range s.score.Histogram {
+		res[i] = int32(n)
+	}
+	return res
+}
+
+type actorResolver struct {
+	req   *graphRequest
+	actor sqlite.Actor
+}
+
+func (a *actorResolver) ID() graphql.ID    { return graphID(a.actor.ActorId) }
+func (a *actorResolver) Name() string      { return a.actor.Name }
+func (a *actorResolver) Gender() string    { return a.actor.Gender }
+func (a *actorResolver) BirthDate() string { return a.actor.BirthDate }
+
+func (a *actorResolver) credits() ([]sqlite.Credit, error) {
+	credits, _, err := a.req.personCredits.load(a.actor.ActorId)
+	return credits, err
+}
+
+func (a *actorResolver) Films() ([]*filmResolver, error) {
+	credits, err := a.credits()
+	if err != nil {
+		return nil, err
+	}
+
+	films := []*filmResolver{}
+	for _, credit := range credits {
+		if credit.Role != sqlite.RoleActor {
+			continue
+		}
+		film, err := a.req.loadFilm(credit.FilmId)
+		if err != nil {
+			return nil, err
+		}
+		if film != nil {
+			films = append(films, film)
+		}
+	}
+	return films, nil
+}
+
+func (a *actorResolver) Credits() ([]*creditResolver, error) {
+	credits, err := a.credits()
+	if err != nil {
+		return nil, err
+	}
+	return creditResolvers(a.req, credits), nil
+}
+
+type creditResolver struct {
+	req    *graphRequest
+	credit sqlite.Credit
+}
+
+func creditResolvers(req *graphRequest, credits []sqlite.Credit) []*creditResolver {
+	res := make([]*creditResolver, 0, len(credits))
+	for _, credit := range credits {
+		res = append(res, &creditResolver{req: req, credit: credit})
+	}
+	return res
+}
+
+func (c *creditResolver) Film() (*filmResolver, error) {
+	return c.req.requireFilm(c.credit.FilmId)
+}
+
+func (c *creditResolver) Person() (*actorResolver, error) {
+	actor, err := c.req.loadActor(c.credit.PersonId)
+	if err == nil && actor == nil {
+		err = errors.New("actor not found")
+	}
+	return actor, err
+}
+
+func (c *creditResolver) Role() string      { return c.credit.Role }
+func (c *creditResolver) Character() string { return c.credit.Character }
+func (c *creditResolver) Job() string       { return c.credit.Job }
+func (c *creditResolver) Position() int32   { return int32(c.credit.Position) }
+
+type genreResolver struct {
+	req   *graphRequest
+	genre sqlite.Genre
+}
+
+func (g *genreResolver) ID() graphql.ID    { return graphID(g.genre.GenreId) }
+func (g *genreResolver) Name() string      { return g.genre.Name }
+func (g *genreResolver) FilmsCount() int32 { return int32(g.genre.FilmsCount) }
+
+func (g *genreResolver) Films(args struct{ First, Offset *int32 }) (*filmPageResolver, error) {
+	return g.req.findFilms(sqlite.FilmFilter{Genre: g.genre.Name}, args.First, args.Offset)
+}
+
+type userResolver struct {
+	req *graphRequest
+}
+
+func (u *userResolver) Login() string { return u.req.user }
+
+func (u *userResolver) Watchlist() ([]*watchlistEntryResolver, error) {
+	if err := u.req.lists(); err != nil {
+		return nil, err
+	}
+
+	res := []*watchlistEntryResolver{}
+	for _, entry := range u.req.watchlist {
+		u.req.films.prime(entry.Film.Id)
+		res = append(res, &watchlistEntryResolver{req: u.req, entry: entry})
+	}
+	return res, nil
+}
+
+func (u *userResolver) Watched() ([]*watchedEntryResolver, error) {
+	if err := u.req.lists(); err != nil {
+		return nil, err
+	}
+
+	res := []*watchedEntryResolver{}
+	for _, entry := range u.req.watched {
+		u.req.films.prime(entry.Film.Id)
+		res = append(res, &watchedEntryResolver{req: u.req, entry: entry})
+	}
+	return res, nil
+}
+
+type watchlistEntryResolver struct {
+	req   *graphRequest
+	entry sqlite.WatchlistEntry
+}
+
+func (e *watchlistEntryResolver) Film() (*filmResolver, error) {
+	return e.req.requireFilm(e.entry.Film.Id)
+}
+func (e *watchlistEntryResolver) Note() string    { return e.entry.Note }
+func (e *watchlistEntryResolver) AddedAt() string { return e.entry.AddedAt }
+
+type watchedEntryResolver struct {
+	req   *graphRequest
+	entry sqlite.WatchedEntry
+}
+
+func (e *watchedEntryResolver) Film() (*filmResolver, error) {
+	return e.req.requireFilm(e.entry.Film.Id)
+}
+func (e *watchedEntryResolver) Note() string      { return e.entry.Note }
+func (e *watchedEntryResolver) WatchedAt() string { return e.entry.WatchedAt }
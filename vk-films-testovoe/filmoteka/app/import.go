@@ -0,0 +1,511 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+const (
+	ImportFilms  = "films"
+	ImportActors = "actors"
+
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+
+	ConflictSkip   = "skip"
+	ConflictUpdate = "update"
+
+	RowCreated = "created"
+	RowUpdated = "updated"
+	RowSkipped = "skipped"
+	RowFailed  = "failed"
+
+	// строк в одной транзакции импорта
+	importBatchSize = 500
+)
+
+// колонки CSV совпадают с полями JSON
+var importColumns = map[string][]string{
+	ImportFilms:  {"id", "title", "description", "criticRating", "releaseDate", "actors", "genres"},
+	ImportActors: {"id", "name", "gender", "birthdate", "films"},
+}
+
+type ImportOptions struct {
+	Kind          string
+	Format        string
+	DryRun        bool
+	OnConflict    string
+	CreateMissing bool
+}
+
+type ImportRow struct {
+	Line   int    `json:"line"`
+	Status string `json:"status"`
+	Id     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportReport - итог импорта. Если импорт прервался, в отчёте только строки сохранённых пачек:
+// Committed - сколько их, Stopped - первая несохранённая строка и причина остановки.
+type ImportReport struct {
+	DryRun    bool        `json:"dryRun"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Skipped   int         `json:"skipped"`
+	Failed    int         `json:"failed"`
+	Committed int         `json:"committed"`
+	Rows      []ImportRow `json:"rows"`
+	Stopped   *ImportRow  `json:"stopped,omitempty"`
+}
+
+func (rep *ImportReport) add(row ImportRow) {
+	switch row.Status {
+	case RowCreated:
+		rep.Created++
+	case RowUpdated:
+		rep.Updated++
+	case RowSkipped:
+		rep.Skipped++
+	case RowFailed:
+		rep.Failed++
+	}
+	rep.Rows = append(rep.Rows, row)
+}
+
+// одна запись файла: фильм или актёр в зависимости от вида импорта
+type importRecord struct {
+	line  int
+	film  sqlite.Film
+	actor sqlite.Actor
+	err   error
+}
+
+type importDecoder interface {
+	// next возвращает io.EOF после последней записи.
+	// Ошибка разбора одной записи попадает в importRecord.err.
+	next() (importRecord, error)
+}
+
+func (opts ImportOptions) validate() error {
+	if _, ok := importColumns[opts.Kind]; !ok {
+		return fmt.Errorf("wrong kind %q", opts.Kind)
+	}
+	if opts.Format != FormatCSV && opts.Format != FormatJSONL {
+		return fmt.Errorf("wrong format %q", opts.Format)
+	}
+	if opts.OnConflict != ConflictSkip && opts.OnConflict != ConflictUpdate {
+		return fmt.Errorf("wrong onConflict %q", opts.OnConflict)
+	}
+	return nil
+}
+
+// Import загружает фильмы или актёров из CSV или JSON Lines.
+// Записи проверяются теми же правилами, что и в PostFilm и PostActor,
+// и сохраняются транзакциями по importBatchSize строк.
+// При DryRun всё выполняется в одной транзакции, которая затем откатывается.
+//
+// Ошибка чтения или хранилища откатывает текущую пачку, уже сохранённые пачки остаются.
+// Отчёт тогда описывает только их, а импорт можно продолжить со строки report.Stopped.Line.
+func Import(s *sqlite.Storage, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{DryRun: opts.DryRun, Rows: []ImportRow{}}
+
+	err := opts.validate()
+	if err != nil {
+		return report, err
+	}
+
+	dec, err := newImportDecoder(r, opts)
+	if err != nil {
+		return report, err
+	}
+
+	// строка последней прочитанной записи
+	line := 0
+	for done := false; !done; {
+		saved := report
+		// первая строка пачки
+		first := 0
+		err = sqlite.RunBatch(s, opts.DryRun, func(b *sqlite.Batch) error {
+			for n := 0; opts.DryRun || n < importBatchSize; n++ {
+				rec, err := dec.next()
+				if err == io.EOF {
+					done = true
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+
+				line = rec.line
+				if first == 0 {
+					first = rec.line
+				}
+				report.add(importOne(b, rec, opts))
+			}
+			return nil
+		})
+		if err != nil {
+			// строки откатанной пачки не сохранены
+			if !opts.DryRun {
+				rows := report.Rows[:len(saved.Rows)]
+				report = saved
+				report.Rows = rows
+			}
+			if first == 0 {
+				first = line + 1
+			}
+			report.Stopped = &ImportRow{Line: first, Status: RowFailed, Error: err.Error()}
+			return report, err
+		}
+
+		if !opts.DryRun {
+			report.Committed = len(report.Rows)
+		}
+	}
+
+	return report, nil
+}
+
+func importOne(b *sqlite.Batch, rec importRecord, opts ImportOptions) ImportRow {
+	row := ImportRow{Line: rec.line}
+
+	err := rec.err
+	if err == nil {
+		err = b.Row(func() error {
+			var err error
+			if opts.Kind == ImportFilms {
+				row.Status, row.Id, err = importFilm(b, rec.film, opts)
+			} else {
+				row.Status, row.Id, err = importActor(b, rec.actor, opts)
+			}
+			return err
+		})
+	}
+
+	if err != nil {
+		row.Status = RowFailed
+		row.Id = 0
+		row.Error = err.Error()
+	}
+
+	return row
+}
+
+// фильм ищется по id, а без него по названию
+func importFilm(b *sqlite.Batch, film sqlite.Film, opts ImportOptions) (string, int, error) {
+	err := ValidateFilm(film)
+	if err != nil {
+		return RowFailed, 0, err
+	}
+
+	id, err := b.FindFilm(sqlite.Ref{Id: film.FilmId, Name: film.Title})
+	if errors.Is(err, sqlite.ErrUnknownRef) && film.FilmId == 0 {
+		id, err = b.PostFilm(film, opts.CreateMissing)
+		return RowCreated, id, err
+	}
+	if err != nil {
+		return RowFailed, 0, err
+	}
+
+	if opts.OnConflict == ConflictSkip {
+		return RowSkipped, id, nil
+	}
+
+	film.FilmId = id
+	return RowUpdated, id, b.UpdateFilm(film, opts.CreateMissing)
+}
+
+// актёр ищется по id, а без него по имени, если оно уникально
+func importActor(b *sqlite.Batch, actor sqlite.Actor, opts ImportOptions) (string, int, error) {
+	err := ValidateActor(actor)
+	if err != nil {
+		return RowFailed, 0, err
+	}
+
+	id, err := b.FindActor(sqlite.Ref{Id: actor.ActorId, Name: actor.Name})
+	if errors.Is(err, sqlite.ErrUnknownRef) && actor.ActorId == 0 {
+		id, err = b.PostActor(actor, opts.CreateMissing)
+		return RowCreated, id, err
+	}
+	if err != nil {
+		return RowFailed, 0, err
+	}
+
+	if opts.OnConflict == ConflictSkip {
+		return RowSkipped, id, nil
+	}
+
+	actor.ActorId = id
+	return RowUpdated, id, b.UpdateActor(actor, opts.CreateMissing)
+}
+
+func newImportDecoder(r io.Reader, opts ImportOptions) (importDecoder, error) {
+	if opts.Format == FormatJSONL {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		return &jsonlDecoder{scanner: scanner, kind: opts.Kind}, nil
+	}
+
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+
+	allowed := map[string]bool{}
+	for _, name := range importColumns[opts.Kind] {
+		allowed[name] = true
+	}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if !allowed[name] {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		header[i] = name
+	}
+
+	return &csvDecoder{reader: cr, header: header, kind: opts.Kind}, nil
+}
+
+type jsonlDecoder struct {
+	scanner *bufio.Scanner
+	kind    string
+	line    int
+}
+
+func (d *jsonlDecoder) next() (importRecord, error) {
+	for d.scanner.Scan() {
+		d.line++
+		data := strings.TrimSpace(d.scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		rec := importRecord{line: d.line}
+		if d.kind == ImportFilms {
+			rec.err = json.Unmarshal([]byte(data), &rec.film)
+		} else {
+			rec.err = json.Unmarshal([]byte(data), &rec.actor)
+		}
+		return rec, nil
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return importRecord{}, err
+	}
+	return importRecord{}, io.EOF
+}
+
+type csvDecoder struct {
+	reader *csv.Reader
+	header []string
+	kind   string
+}
+
+func (d *csvDecoder) next() (importRecord, error) {
+	fields, err := d.reader.Read()
+	if err == io.EOF {
+		return importRecord{}, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return importRecord{line: parseErr.StartLine, err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return importRecord{}, err
+	}
+
+	line, _ := d.reader.FieldPos(0)
+	rec := importRecord{line: line}
+
+	values := map[string]string{}
+	for i, name := range d.header {
+		values[name] = strings.TrimSpace(fields[i])
+	}
+
+	if d.kind == ImportFilms {
+		rec.film, rec.err = filmFromCSV(values)
+	} else {
+		rec.actor, rec.err = actorFromCSV(values)
+	}
+	return rec, nil
+}
+
+func filmFromCSV(values map[string]string) (sqlite.Film, error) {
+	film := sqlite.Film{
+		Title:       values["title"],
+		Description: values["description"],
+		ReleaseDate: values["releaseDate"],
+		Actors:      csvRefs(values["actors"]),
+		Genres:      csvList(values["genres"]),
+	}
+
+	var err error
+	film.FilmId, err = csvInt(values["id"], "id")
+	if err != nil {
+		return film, err
+	}
+	film.CriticRating, err = csvInt(values["criticRating"], "criticRating")
+	return film, err
+}
+
+func actorFromCSV(values map[string]string) (sqlite.Actor, error) {
+	actor := sqlite.Actor{
+		Name:      values["name"],
+		Gender:    values["gender"],
+		BirthDate: values["birthdate"],
+		Films:     csvRefs(values["films"]),
+	}
+
+	var err error
+	actor.ActorId, err = csvInt(values["id"], "id")
+	return actor, err
+}
+
+func csvInt(value, column string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("wrong %s %q", column, value)
+	}
+	return n, nil
+}
+
+// списки в ячейке разделяются ";"
+func csvList(value string) []string {
+	res := []string{}
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// ссылка "#12" задаёт id, иначе элемент списка считается именем или названием
+func csvRefs(value string) []sqlite.Ref {
+	res := []sqlite.Ref{}
+	for _, item := range csvList(value) {
+		id, err := strconv.Atoi(strings.TrimPrefix(item, "#"))
+		if strings.HasPrefix(item, "#") && err == nil {
+			res = append(res, sqlite.Ref{Id: id})
+			continue
+		}
+		res = append(res, sqlite.Ref{Name: item})
+	}
+	return res
+}
+
+// ImportOptionsFromQuery читает параметры импорта из запроса.
+// Формат без параметра format определяется по Content-Type.
+func ImportOptionsFromQuery(r *http.Request) ImportOptions {
+	query := r.URL.Query()
+
+	opts := ImportOptions{
+		Kind:          query.Get("kind"),
+		Format:        query.Get("format"),
+		DryRun:        query.Get("dryRun") == "true",
+		OnConflict:    query.Get("onConflict"),
+		CreateMissing: query.Get("createMissing") == "true",
+	}
+
+	if opts.Format == "" {
+		opts.Format = FormatCSV
+		contentType := r.Header.Get("Content-Type")
+		if strings.Contains(contentType, "json") {
+			opts.Format = FormatJSONL
+		}
+	}
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictSkip
+	}
+
+	return opts
+}
+
+func PostImport(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	opts := ImportOptionsFromQuery(r)
+
+	err := opts.validate()
+	if err != nil {
+		log.Error("wrong import options", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// большой файл загружается дольше, чем ReadTimeout и WriteTimeout сервера
+	rc := http.NewResponseController(w)
+	err = rc.SetReadDeadline(time.Time{})
+	if err != nil {
+		log.Warn("cant reset read deadline", slog.Any("error", err))
+	}
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		log.Warn("cant reset write deadline", slog.Any("error", err))
+	}
+
+	report, err := Import(s.As(user), r.Body, opts)
+	if err != nil && report.Stopped == nil {
+		log.Error("error to import", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// прерванный импорт отвечает отчётом о сохранённых строках, чтобы его можно было продолжить
+	status := http.StatusOK
+	if err != nil {
+		log.Error("import stopped", slog.Int("committed", report.Committed),
+			slog.Int("line", report.Stopped.Line), slog.Any("error", err))
+		status = http.StatusBadRequest
+	}
+
+	resp, err := json.Marshal(report)
+	if err != nil {
+		log.Error("cant json.marshal import report", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+	if status != http.StatusOK {
+		return
+	}
+	log.Info("import finished",
+		slog.Int("created", report.Created),
+		slog.Int("updated", report.Updated),
+		slog.Int("skipped", report.Skipped),
+		slog.Int("failed", report.Failed))
+}
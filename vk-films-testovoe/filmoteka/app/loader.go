@@ -0,0 +1,102 @@
+package app
+
+import (
+	"sort"
+	"sync"
+)
+
+// loader загружает записи по ID пачками в пределах одного запроса к /graphql.
+//
+// Резолверы выполняются параллельно и в произвольном порядке, поэтому ID заранее
+// регистрируются через prime: список фильмов регистрирует свои ID в загрузчиках
+// связей, загрузка связей регистрирует ID следующего уровня. Первый load выбирает
+// все зарегистрированные ID одним запросом, остальные получают результат из кэша.
+type loader[V any] struct {
+	fetch func(ids []int) (map[int]V, error)
+
+	// одновременно выполняется только одна выборка
+	fetching sync.Mutex
+
+	mu      sync.Mutex
+	pending map[int]bool
+	fetched map[int]bool
+	values  map[int]V
+}
+
+func newLoader[V any](fetch func(ids []int) (map[int]V, error)) *loader[V] {
+	return &loader[V]{
+		fetch:   fetch,
+		pending: map[int]bool{},
+		fetched: map[int]bool{},
+		values:  map[int]V{},
+	}
+}
+
+// prime добавляет ID в следующую выборку
+func (l *loader[V]) prime(ids ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, id := range ids {
+		if !l.fetched[id] {
+			l.pending[id] = true
+		}
+	}
+}
+
+// load возвращает запись по ID, ok = false если записи нет
+func (l *loader[V]) load(id int) (value V, ok bool, err error) {
+	value, ok, done := l.cached(id)
+	if done {
+		return value, ok, nil
+	}
+
+	l.fetching.Lock()
+	defer l.fetching.Unlock()
+
+	// пока ждали, запись могла попасть в чужую выборку
+	value, ok, done = l.cached(id)
+	if done {
+		return value, ok, nil
+	}
+
+	l.mu.Lock()
+	l.pending[id] = true
+	ids := make([]int, 0, len(l.pending))
+	for pendingID := range l.pending {
+		ids = append(ids, pendingID)
+	}
+	l.pending = map[int]bool{}
+	l.mu.Unlock()
+	sort.Ints(ids)
+
+	// fetch может вызывать prime других загрузчиков, но не load,
+	// поэтому fetching разных загрузчиков не ждут друг друга
+	values, err := l.fetch(ids)
+	if err != nil {
+		return value, false, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, fetchedID := range ids {
+		l.fetched[fetchedID] = true
+		if v, found := values[fetchedID]; found {
+			l.values[fetchedID] = v
+		}
+	}
+
+	value, ok = l.values[id]
+	return value, ok, nil
+}
+
+func (l *loader[V]) cached(id int) (value V, ok bool, done bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.fetched[id] {
+		return value, false, false
+	}
+	value, ok = l.values[id]
+	return value, ok, true
+}
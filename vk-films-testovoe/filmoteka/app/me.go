@@ -0,0 +1,287 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+type listEntry struct {
+	Note      string `json:"note"`
+	WatchedAt string `json:"watchedAt"`
+}
+
+// разбирает путь вида /me/watchlist/{filmId}
+func meFilmID(path string) (int, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 4 {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.Atoi(parts[3])
+}
+
+// читает необязательное тело запроса с заметкой и датой просмотра
+func readListEntry(r *http.Request) (listEntry, error) {
+	var entry listEntry
+	var buf bytes.Buffer
+
+	_, err := buf.ReadFrom(r.Body)
+	if err != nil || buf.Len() == 0 {
+		return entry, err
+	}
+
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	return entry, err
+}
+
+func GetMyWatchlist(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	watchlist, err := sqlite.GetWatchlistFromStorage(s, user)
+	if err != nil {
+		log.Error("no watchlist", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(watchlist)
+	if err != nil {
+		log.Error("cant json.marshal watchlist", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get watchlist successfully")
+}
+
+func PostMyWatchlist(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	filmID, err := meFilmID(r.URL.Path)
+	if err != nil {
+		log.Error("invalid film ID", slog.Any("error", err))
+		http.Error(w, "invalid film ID", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := readListEntry(r)
+	if err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(entry.Note) > 1000 {
+		log.Error("too long note")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "too long note")
+		return
+	}
+
+	err = sqlite.AddToWatchlist(s, user, filmID, entry.Note)
+	if err != nil {
+		log.Error("error to add film to watchlist", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Film added to watchlist")
+}
+
+func DeleteMyWatchlist(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	filmID, err := meFilmID(r.URL.Path)
+	if err != nil {
+		log.Error("invalid film ID", slog.Any("error", err))
+		http.Error(w, "invalid film ID", http.StatusBadRequest)
+		return
+	}
+
+	err = sqlite.RemoveFromWatchlist(s, user, filmID)
+	if err != nil {
+		log.Error("no film in watchlist", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("film removed from watchlist successfully")
+}
+
+func GetMyWatched(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	watched, err := sqlite.GetWatchedFromStorage(s, user)
+	if err != nil {
+		log.Error("no watched films", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(watched)
+	if err != nil {
+		log.Error("cant json.marshal watched films", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get watched films successfully")
+}
+
+// без watchedAt фильм отмечается просмотренным сегодня
+func PostMyWatched(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	filmID, err := meFilmID(r.URL.Path)
+	if err != nil {
+		log.Error("invalid film ID", slog.Any("error", err))
+		http.Error(w, "invalid film ID", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := readListEntry(r)
+	if err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(entry.Note) > 1000 {
+		log.Error("too long note")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "too long note")
+		return
+	}
+
+	if entry.WatchedAt == "" {
+		entry.WatchedAt = time.Now().Format("2006-01-02")
+	}
+
+	entry.WatchedAt, err = sqlite.NormalizeDate(entry.WatchedAt)
+	if err != nil {
+		log.Error("wrong WatchedAt", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = sqlite.MarkWatched(s, user, filmID, entry.WatchedAt, entry.Note)
+	if err != nil {
+		log.Error("error to mark film watched", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Film marked as watched")
+}
+
+func DeleteMyWatched(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	filmID, err := meFilmID(r.URL.Path)
+	if err != nil {
+		log.Error("invalid film ID", slog.Any("error", err))
+		http.Error(w, "invalid film ID", http.StatusBadRequest)
+		return
+	}
+
+	err = sqlite.UnmarkWatched(s, user, filmID)
+	if err != nil {
+		log.Error("no film in watched", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("film removed from watched successfully")
+}
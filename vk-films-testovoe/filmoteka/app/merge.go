@@ -0,0 +1,141 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// MergeRequest - тело POST /films/{id}/merge и /actors/{id}/merge.
+// Запись mergeId сливается с записью из пути и удаляется, её ID становится псевдонимом.
+type MergeRequest struct {
+	MergeId int    `json:"mergeId"`
+	Policy  string `json:"policy"`
+}
+
+// /films/{id}/merge - слияние дубля фильма, в ответе оставшийся фильм
+func PostFilmMerge(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	merge(log, s, w, r, "film", sqlite.MergeFilms, func(id int) (any, error) {
+		return sqlite.GetOneFilmFromStorage(s, id)
+	})
+}
+
+// /actors/{id}/merge - слияние дубля человека, в ответе оставшийся актёр
+func PostActorMerge(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	merge(log, s, w, r, "actor", sqlite.MergeActors, func(id int) (any, error) {
+		return sqlite.GetOneActorFromStorage(s, id, log)
+	})
+}
+
+func merge(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request, entity string,
+	fn func(s *sqlite.Storage, targetID, sourceID int, policy string) error, get func(id int) (any, error)) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	targetID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid "+entity+" ID", slog.Any("error", err))
+		http.Error(w, "invalid "+entity+" ID", http.StatusBadRequest)
+		return
+	}
+
+	var req MergeRequest
+	var buf bytes.Buffer
+
+	_, err = buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = json.Unmarshal(buf.Bytes(), &req); err != nil {
+		log.Error("cant unmarshal merge request", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Policy == "" {
+		req.Policy = sqlite.MergeFill
+	}
+	if req.MergeId <= 0 || !sqlite.ValidMergePolicy(req.Policy) {
+		log.Error("invalid merge request")
+		http.Error(w, "invalid merge request", http.StatusBadRequest)
+		return
+	}
+
+	err = fn(s.As(user), targetID, req.MergeId, req.Policy)
+	if errors.Is(err, sqlite.ErrSelfMerge) {
+		log.Error("invalid merge request", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Error("no "+entity+" to merge", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("error to merge "+entity, slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	merged, err := get(targetID)
+	if err != nil {
+		log.Error("no merged "+entity, slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(merged)
+	if err != nil {
+		log.Error("cant json.marshal "+entity, slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info(entity+" merged successfully", slog.Int("id", targetID), slog.Int("merged", req.MergeId))
+}
+
+// redirectAlias перенаправляет запрос по ID слитого дубля на оставшуюся запись.
+// Возвращает false, если такого псевдонима нет.
+func redirectAlias(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request, entity string, id int) bool {
+	target, err := sqlite.ResolveAlias(s, entity, id)
+	if err != nil {
+		return false
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	parts[2] = strconv.Itoa(target)
+	log.Info("redirect merged record", slog.Int("id", id), slog.Int("target", target))
+	http.Redirect(w, r, strings.Join(parts, "/"), http.StatusMovedPermanently)
+	return true
+}
@@ -0,0 +1,193 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+func GetAllPeople(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	role := r.URL.Query().Get("role")
+	if role != "" && !sqlite.ValidRole(role) {
+		log.Error("wrong credit role")
+		http.Error(w, "wrong credit role", http.StatusBadRequest)
+		return
+	}
+
+	sliceOfPeople, err := sqlite.GetAllPeopleFromStorage(s, log, role)
+	if err != nil {
+		log.Error("no list of people", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(sliceOfPeople)
+	if err != nil {
+		log.Error("cant json.marshal people", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get people successfully")
+}
+
+func PostPerson(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	var person sqlite.Person
+	var buf bytes.Buffer
+
+	_, err := buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), &person); err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if person.Name == "" {
+		log.Error("wrong name")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong name")
+		return
+	}
+
+	// у съёмочной группы пол и дата рождения могут быть неизвестны
+	if person.Gender != "" && person.Gender != "male" && person.Gender != "female" {
+		log.Error("wrong gender")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong gender")
+		return
+	}
+
+	if person.BirthDate != "" {
+		_, err = sqlite.NormalizeDate(person.BirthDate)
+		if err != nil {
+			log.Error("wrong BirthDate")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	for _, credit := range person.Credits {
+		if !sqlite.ValidRole(credit.Role) {
+			log.Error("wrong credit role")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "wrong credit role")
+			return
+		}
+		if credit.FilmId == 0 && credit.Title == "" {
+			log.Error("credit without film")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "credit without film")
+			return
+		}
+	}
+
+	createMissing := r.URL.Query().Get("createMissing") == "true"
+
+	err = sqlite.PostPersonToStorage(s.As(user), person, createMissing)
+	if err != nil {
+		log.Error("error to post person to storage", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Person posted")
+}
+
+func GetOnePerson(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	personID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid person ID", slog.Any("error", err))
+		http.Error(w, "invalid person ID", http.StatusBadRequest)
+		return
+	}
+
+	person, err := sqlite.GetOnePersonFromStorage(s, personID)
+	if errors.Is(err, sql.ErrNoRows) && redirectAlias(log, s, w, r, sqlite.EntityPerson, personID) {
+		return
+	}
+	if err != nil {
+		log.Error("no person", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	resp, err := json.Marshal(person)
+	if err != nil {
+		log.Error("cant json.marshal person", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get person successfully")
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// RateLimit пропускает запросы к next через limiter: превысившие лимит и запросы с закрытого адреса
+// или логина получают 429 с Retry-After, не доходя до проверки пароля.
+// Ответ 401 на запрос с логином означает и неверный пароль, и нехватку прав, поэтому
+// неудачей считается только то, что повторная проверка пароля не прошла.
+func RateLimit(log *slog.Logger, s *sqlite.Storage, limiter *verify.Limiter, trustProxy bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r, trustProxy)
+		user, pass, ok := r.BasicAuth()
+
+		wait, err := limiter.Allow(r.Context(), ip, user)
+		if err != nil {
+			// без хранилища лимитов API остаётся доступным
+			log.Error("rate limiter failed", slog.Any("error", err))
+			next.ServeHTTP(w, r)
+			return
+		}
+		if wait > 0 {
+			log.Warn("too many requests", slog.String("ip", ip), slog.String("user", user))
+			tooManyRequests(w, wait)
+			return
+		}
+
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status != http.StatusUnauthorized {
+			return
+		}
+
+		_, err = verify.Authenticate(s, user, pass)
+		if !errors.Is(err, verify.ErrWrongCredentials) {
+			return
+		}
+
+		lockout, err := limiter.Failure(r.Context(), ip, user)
+		if err != nil {
+			log.Error("rate limiter failed", slog.Any("error", err))
+			return
+		}
+		if lockout > 0 {
+			log.Warn("login locked", slog.String("ip", ip), slog.String("user", user), slog.Duration("lockout", lockout))
+		}
+	})
+}
+
+// clientIP - адрес клиента. За прокси это последний адрес X-Forwarded-For:
+// его дописывает сам прокси, а более ранние мог прислать клиент
+func clientIP(r *http.Request, trustProxy bool) string {
+	if forwarded := r.Header.Values("X-Forwarded-For"); trustProxy && len(forwarded) > 0 {
+		hops := strings.Split(forwarded[len(forwarded)-1], ",")
+		if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := max(int(math.Ceil(wait.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
+
+// statusWriter запоминает код ответа, Unwrap нужен http.ResponseController для потока /events
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+type myRating struct {
+	Rating int `json:"rating"`
+}
+
+// оценку ставит любой пользователь с правом чтения, поэтому проверяется ReadPermission
+func PutMyRating(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	filmID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid film ID", slog.Any("error", err))
+		http.Error(w, "invalid film ID", http.StatusBadRequest)
+		return
+	}
+
+	var rating myRating
+	var buf bytes.Buffer
+
+	_, err = buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), &rating); err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if rating.Rating < 1 || rating.Rating > 10 {
+		log.Error("wrong rating")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong rating")
+		return
+	}
+
+	err = sqlite.RateFilm(s, user, filmID, rating.Rating)
+	if err != nil {
+		log.Error("error to rate film", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Rating saved")
+}
+
+func GetMyRating(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	filmID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid film ID", slog.Any("error", err))
+		http.Error(w, "invalid film ID", http.StatusBadRequest)
+		return
+	}
+
+	rating, err := sqlite.GetUserRating(s, user, filmID)
+	if err != nil {
+		log.Error("no rating", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	resp, err := json.Marshal(myRating{Rating: rating})
+	if err != nil {
+		log.Error("cant json.marshal rating", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get rating successfully")
+}
+
+func DeleteMyRating(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	filmID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid film ID", slog.Any("error", err))
+		http.Error(w, "invalid film ID", http.StatusBadRequest)
+		return
+	}
+
+	err = sqlite.DeleteUserRating(s, user, filmID)
+	if err != nil {
+		log.Error("no rating", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("rating deleted successfully")
+}
@@ -0,0 +1,402 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type reviewText struct {
+	Text string `json:"text"`
+}
+
+type reviewStatus struct {
+	Status string `json:"status"`
+}
+
+// pageParams читает page и limit из запроса, по умолчанию первая страница из 20 записей
+func pageParams(r *http.Request) (int, int, error) {
+	page, limit := 1, defaultPageLimit
+
+	var err error
+	if v := r.URL.Query().Get("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return 0, 0, strconv.ErrSyntax
+		}
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, strconv.ErrRange
+		}
+	}
+
+	return page, limit, nil
+}
+
+// обычные пользователи видят только одобренные рецензии, модераторы - любые
+func GetFilmReviews(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	filmID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid film ID", slog.Any("error", err))
+		http.Error(w, "invalid film ID", http.StatusBadRequest)
+		return
+	}
+
+	page, limit, err := pageParams(r)
+	if err != nil {
+		log.Error("wrong pagination", slog.Any("error", err))
+		http.Error(w, "wrong pagination", http.StatusBadRequest)
+		return
+	}
+
+	status := sqlite.ReviewApproved
+	if verify.HasPermission(s, user, verify.ModeratePermission) {
+		status = r.URL.Query().Get("status")
+		if status != "" && !sqlite.ValidReviewStatus(status) {
+			log.Error("wrong review status")
+			http.Error(w, "wrong review status", http.StatusBadRequest)
+			return
+		}
+	}
+
+	reviews, err := sqlite.GetFilmReviewsFromStorage(s, filmID, status, page, limit)
+	if err != nil {
+		log.Error("no list of reviews", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(reviews)
+	if err != nil {
+		log.Error("cant json.marshal reviews", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get reviews successfully")
+}
+
+func PostReview(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	filmID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid film ID", slog.Any("error", err))
+		http.Error(w, "invalid film ID", http.StatusBadRequest)
+		return
+	}
+
+	var text reviewText
+	var buf bytes.Buffer
+
+	_, err = buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), &text); err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(text.Text) < 1 || len(text.Text) > 5000 {
+		log.Error("wrong review text")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong review text")
+		return
+	}
+
+	_, err = sqlite.PostReviewToStorage(s.As(user), sqlite.Review{FilmId: filmID, Login: user, Text: text.Text})
+	if err != nil {
+		log.Error("error to post review to storage", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Review posted")
+}
+
+// неодобренную рецензию видят только автор и модераторы
+func GetOneReview(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	reviewID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid review ID", slog.Any("error", err))
+		http.Error(w, "invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	review, err := sqlite.GetOneReviewFromStorage(s, reviewID)
+	if err == nil && review.Status != sqlite.ReviewApproved && review.Login != user && !verify.HasPermission(s, user, verify.ModeratePermission) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		log.Error("no review", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	resp, err := json.Marshal(review)
+	if err != nil {
+		log.Error("cant json.marshal review", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get review successfully")
+}
+
+func PutOneReview(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	reviewID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid review ID", slog.Any("error", err))
+		http.Error(w, "invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	var text reviewText
+	var buf bytes.Buffer
+
+	_, err = buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), &text); err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(text.Text) < 1 || len(text.Text) > 5000 {
+		log.Error("wrong review text")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong review text")
+		return
+	}
+
+	err = sqlite.UpdateReview(s.As(user), sqlite.Review{ReviewId: reviewID, Login: user, Text: text.Text})
+	if err != nil {
+		log.Error("error to update review in storage", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Review updated")
+}
+
+// автор удаляет свою рецензию, модератор - любую
+func DeleteOneReview(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok = verify.User(user, pass, log, verify.ReadPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	reviewID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid review ID", slog.Any("error", err))
+		http.Error(w, "invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	owner := user
+	if verify.HasPermission(s, user, verify.ModeratePermission) {
+		owner = ""
+	}
+
+	err = sqlite.DeleteReview(s.As(user), reviewID, owner)
+	if err != nil {
+		log.Error("no review", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("review deleted successfully")
+}
+
+func PutReviewStatus(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.ModeratePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	reviewID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid review ID", slog.Any("error", err))
+		http.Error(w, "invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	var status reviewStatus
+	var buf bytes.Buffer
+
+	_, err = buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), &status); err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !sqlite.ValidReviewStatus(status.Status) {
+		log.Error("wrong review status")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "wrong review status")
+		return
+	}
+
+	err = sqlite.SetReviewStatus(s.As(user), reviewID, status.Status)
+	if err != nil {
+		log.Error("error to moderate review", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, "Review moderated")
+}
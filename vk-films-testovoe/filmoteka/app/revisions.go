@@ -0,0 +1,205 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// /films/{id}/revisions - прежние версии фильма с отличиями от следующей версии
+func GetFilmRevisions(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	getRevisions(log, s, w, r, sqlite.EntityFilm)
+}
+
+// /actors/{id}/revisions - прежние версии человека с отличиями от следующей версии
+func GetActorRevisions(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	getRevisions(log, s, w, r, sqlite.EntityPerson)
+}
+
+// /films/{id}/revisions/diff?from=1&to=3 - отличия между двумя версиями фильма
+func GetFilmRevisionDiff(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	getRevisionDiff(log, s, w, r, sqlite.EntityFilm)
+}
+
+// /actors/{id}/revisions/diff?from=1&to=3 - отличия между двумя версиями человека
+func GetActorRevisionDiff(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	getRevisionDiff(log, s, w, r, sqlite.EntityPerson)
+}
+
+// /films/{id}/revisions/{number}/revert - записывает старую версию фильма как новое изменение
+func PostFilmRevert(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	revert(log, s, w, r, sqlite.RevertFilm)
+}
+
+// /actors/{id}/revisions/{number}/revert - записывает старую версию человека как новое изменение
+func PostActorRevert(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	revert(log, s, w, r, sqlite.RevertActor)
+}
+
+// историю правок видят те, кто может править
+func revisionsAuth(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return "", false
+	}
+	log.Info("authorization was successful")
+	return user, true
+}
+
+// revisionPath разбирает /films/{id}/revisions/{number}/..., number = 0 если его нет
+func revisionPath(path string) (int, int, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 {
+		return 0, 0, errors.New("invalid URL path")
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(parts) < 5 || parts[4] == "" || parts[4] == "diff" {
+		return id, 0, nil
+	}
+	number, err := strconv.Atoi(parts[4])
+	if err != nil {
+		return 0, 0, err
+	}
+	return id, number, nil
+}
+
+func getRevisions(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request, entity string) {
+	_, ok := revisionsAuth(log, s, w, r)
+	if !ok {
+		return
+	}
+
+	id, _, err := revisionPath(r.URL.Path)
+	if err != nil {
+		log.Error("invalid URL path", slog.Any("error", err))
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := sqlite.GetRevisionsFromStorage(s, entity, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Error("no "+entity, slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("no list of revisions", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(revisions)
+	if err != nil {
+		log.Error("cant json.marshal revisions", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get revisions successfully")
+}
+
+func getRevisionDiff(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request, entity string) {
+	_, ok := revisionsAuth(log, s, w, r)
+	if !ok {
+		return
+	}
+
+	id, _, err := revisionPath(r.URL.Path)
+	if err != nil {
+		log.Error("invalid URL path", slog.Any("error", err))
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+
+	// to не указан - сравнение с текущей записью
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || from < 1 {
+		log.Error("wrong revision numbers")
+		http.Error(w, "wrong revision numbers", http.StatusBadRequest)
+		return
+	}
+	to := 0
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = strconv.Atoi(value)
+		if err != nil || to < 1 {
+			log.Error("wrong revision numbers")
+			http.Error(w, "wrong revision numbers", http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, err := sqlite.DiffRevisions(s, entity, id, from, to)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Error("no revision", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("cant diff revisions", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(changes)
+	if err != nil {
+		log.Error("cant json.marshal changes", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("get revision diff successfully")
+}
+
+func revert(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request, fn func(s *sqlite.Storage, id, number int) error) {
+	user, ok := revisionsAuth(log, s, w, r)
+	if !ok {
+		return
+	}
+
+	id, number, err := revisionPath(r.URL.Path)
+	if err != nil || number < 1 {
+		log.Error("invalid URL path", slog.Any("error", err))
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+
+	err = fn(s.As(user), id, number)
+	// старая версия ссылается на удалённые фильмы или людей
+	if errors.Is(err, sqlite.ErrUnknownRef) {
+		log.Error("revision references missing records", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error("no revision", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("revision reverted successfully", slog.Int("id", id), slog.Int("number", number))
+}
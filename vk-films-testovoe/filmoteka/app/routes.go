@@ -0,0 +1,369 @@
+package app
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"vk-testovoe/filmoteka/config"
+	"vk-testovoe/filmoteka/openapi"
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// NewHandler собирает маршруты API за проверкой по спецификации, ключами API и ограничением запросов limiter,
+// nil limiter - без ограничений. Сама спецификация и Swagger UI отдаются без авторизации
+func NewHandler(log *slog.Logger, s *sqlite.Storage, cfg *config.Config, validation openapi.Options, limiter *verify.Limiter) (http.Handler, error) {
+	api, err := openapi.Middleware(log, Routes(log, s, cfg), validation)
+	if err != nil {
+		return nil, err
+	}
+	api = KeyAuth(log, s, api)
+	if limiter != nil {
+		api = RateLimit(log, s, limiter, cfg.RateLimit.TrustProxy, api)
+	}
+
+	r := http.NewServeMux()
+	r.HandleFunc("/openapi.yaml", openapi.ServeSpec)
+	r.HandleFunc("/docs", openapi.ServeDocs)
+	r.Handle("/", api)
+	return r, nil
+}
+
+// Routes - все маршруты REST API без проверки по спецификации
+func Routes(log *slog.Logger, s *sqlite.Storage, cfg *config.Config) *http.ServeMux {
+	r := http.NewServeMux()
+
+	//Актёры
+	r.HandleFunc("/actors", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetAllActors(log, s, w, r)
+		case http.MethodPost:
+			PostActor(log, s, w, r)
+		}
+	})
+	r.HandleFunc("/actors/", func(w http.ResponseWriter, r *http.Request) {
+		switch subresource(r.URL.Path) {
+		case "restore":
+			if r.Method == http.MethodPost {
+				PostActorRestore(log, s, w, r)
+			}
+			return
+		case "merge":
+			if r.Method == http.MethodPost {
+				PostActorMerge(log, s, w, r)
+			}
+			return
+		case "revisions":
+			switch {
+			case revisionAction(r.URL.Path) == "revert" && r.Method == http.MethodPost:
+				PostActorRevert(log, s, w, r)
+			case revisionAction(r.URL.Path) == "diff" && r.Method == http.MethodGet:
+				GetActorRevisionDiff(log, s, w, r)
+			case revisionAction(r.URL.Path) == "" && r.Method == http.MethodGet:
+				GetActorRevisions(log, s, w, r)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			GetOneActor(log, s, w, r)
+		case http.MethodPut:
+			PutOneActor(log, s, w, r)
+		case http.MethodDelete:
+			DeleteOneActor(log, s, w, r)
+		}
+	})
+
+	//Фильмы
+	r.HandleFunc("/films", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetAllFilms(log, s, w, r)
+		case http.MethodPost:
+			PostFilm(log, s, w, r)
+		}
+	})
+
+	r.HandleFunc("/films/", func(w http.ResponseWriter, r *http.Request) {
+		switch subresource(r.URL.Path) {
+		case "cast":
+			switch r.Method {
+			case http.MethodPost:
+				PostCastMember(log, s, w, r)
+			case http.MethodDelete:
+				DeleteCastMember(log, s, w, r)
+			}
+			return
+		case "my-rating":
+			switch r.Method {
+			case http.MethodGet:
+				GetMyRating(log, s, w, r)
+			case http.MethodPut:
+				PutMyRating(log, s, w, r)
+			case http.MethodDelete:
+				DeleteMyRating(log, s, w, r)
+			}
+			return
+		case "reviews":
+			switch r.Method {
+			case http.MethodGet:
+				GetFilmReviews(log, s, w, r)
+			case http.MethodPost:
+				PostReview(log, s, w, r)
+			}
+			return
+		case "restore":
+			if r.Method == http.MethodPost {
+				PostFilmRestore(log, s, w, r)
+			}
+			return
+		case "merge":
+			if r.Method == http.MethodPost {
+				PostFilmMerge(log, s, w, r)
+			}
+			return
+		case "revisions":
+			switch {
+			case revisionAction(r.URL.Path) == "revert" && r.Method == http.MethodPost:
+				PostFilmRevert(log, s, w, r)
+			case revisionAction(r.URL.Path) == "diff" && r.Method == http.MethodGet:
+				GetFilmRevisionDiff(log, s, w, r)
+			case revisionAction(r.URL.Path) == "" && r.Method == http.MethodGet:
+				GetFilmRevisions(log, s, w, r)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			GetOneFilm(log, s, w, r)
+		case http.MethodPut:
+			PutOneFilm(log, s, w, r)
+		case http.MethodDelete:
+			DeleteOneFilm(log, s, w, r)
+		}
+	})
+
+	//Жанры
+	r.HandleFunc("/genres", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetAllGenres(log, s, w, r)
+		case http.MethodPost:
+			PostGenre(log, s, w, r)
+		}
+	})
+
+	r.HandleFunc("/genres/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetOneGenre(log, s, w, r)
+		case http.MethodPut:
+			PutOneGenre(log, s, w, r)
+		case http.MethodDelete:
+			DeleteOneGenre(log, s, w, r)
+		}
+	})
+
+	//Люди
+	r.HandleFunc("/people", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetAllPeople(log, s, w, r)
+		case http.MethodPost:
+			PostPerson(log, s, w, r)
+		}
+	})
+
+	r.HandleFunc("/people/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetOnePerson(log, s, w, r)
+		}
+	})
+
+	//Рецензии
+	r.HandleFunc("/reviews/", func(w http.ResponseWriter, r *http.Request) {
+		if subresource(r.URL.Path) == "status" {
+			if r.Method == http.MethodPut {
+				PutReviewStatus(log, s, w, r)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			GetOneReview(log, s, w, r)
+		case http.MethodPut:
+			PutOneReview(log, s, w, r)
+		case http.MethodDelete:
+			DeleteOneReview(log, s, w, r)
+		}
+	})
+
+	//Импорт
+	r.HandleFunc("/import", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			PostImport(log, s, w, r)
+		}
+	})
+
+	//Экспорт
+	r.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetExport(log, s, w, r)
+		}
+	})
+
+	//Резервные копии
+	r.HandleFunc("/backup", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			PostBackup(log, s, cfg.Backup.Dir, cfg.Backup.Keep, w, r)
+		}
+	})
+
+	//Поиск дублей
+	r.HandleFunc("/duplicates", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetDuplicateJobs(log, s, w, r)
+		case http.MethodPost:
+			PostDuplicates(log, s, w, r)
+		}
+	})
+
+	r.HandleFunc("/duplicates/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetDuplicateJob(log, s, w, r)
+		}
+	})
+
+	//GraphQL
+	r.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			GraphQL(log, s, w, r)
+		}
+	})
+
+	//Журнал изменений
+	r.HandleFunc("/audit", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetAuditLog(log, s, w, r)
+		}
+	})
+
+	//Лента изменений
+	r.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetEvents(log, s, cfg.Events.PollInterval, w, r)
+		}
+	})
+
+	//Подписки на изменения
+	r.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetWebhooks(log, s, w, r)
+		case http.MethodPost:
+			PostWebhook(log, s, w, r)
+		}
+	})
+
+	r.HandleFunc("/webhooks/", func(w http.ResponseWriter, r *http.Request) {
+		if subresource(r.URL.Path) == "deliveries" {
+			switch {
+			case revisionAction(r.URL.Path) == "retry" && r.Method == http.MethodPost:
+				PostDeliveryRetry(log, s, w, r)
+			case revisionAction(r.URL.Path) == "" && r.Method == http.MethodGet:
+				GetWebhookDeliveries(log, s, w, r)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			GetOneWebhook(log, s, w, r)
+		case http.MethodPut:
+			PutOneWebhook(log, s, w, r)
+		case http.MethodDelete:
+			DeleteOneWebhook(log, s, w, r)
+		}
+	})
+
+	//Ключи API
+	r.HandleFunc("/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetAPIKeys(log, s, w, r)
+		case http.MethodPost:
+			PostAPIKey(log, s, w, r)
+		}
+	})
+
+	r.HandleFunc("/api-keys/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetOneAPIKey(log, s, w, r)
+		case http.MethodDelete:
+			DeleteOneAPIKey(log, s, w, r)
+		}
+	})
+
+	//Личные списки
+	r.HandleFunc("/me/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+		if len(parts) < 3 {
+			http.NotFound(w, r)
+			return
+		}
+		list, item := parts[2], len(parts) > 3
+
+		switch {
+		case list == "watchlist" && !item && r.Method == http.MethodGet:
+			GetMyWatchlist(log, s, w, r)
+		case list == "watchlist" && item && r.Method == http.MethodPost:
+			PostMyWatchlist(log, s, w, r)
+		case list == "watchlist" && item && r.Method == http.MethodDelete:
+			DeleteMyWatchlist(log, s, w, r)
+		case list == "watched" && !item && r.Method == http.MethodGet:
+			GetMyWatched(log, s, w, r)
+		case list == "watched" && item && r.Method == http.MethodPost:
+			PostMyWatched(log, s, w, r)
+		case list == "watched" && item && r.Method == http.MethodDelete:
+			DeleteMyWatched(log, s, w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	return r
+}
+
+// subresource возвращает часть пути после ID: "cast" для /films/1/cast/2
+func subresource(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) < 4 {
+		return ""
+	}
+	return parts[3]
+}
+
+// revisionAction возвращает действие над историей: "diff" для /films/1/revisions/diff,
+// "revert" для /films/1/revisions/2/revert и пустую строку для самого списка
+func revisionAction(path string) string {
+	parts := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	if len(parts) < 5 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// SchedulePurge раз в interval окончательно удаляет записи, пролежавшие в корзине дольше retention.
+// retention <= 0 выключает очистку.
+func SchedulePurge(log *slog.Logger, s *sqlite.Storage, retention, interval time.Duration) {
+	if retention <= 0 || interval <= 0 {
+		return
+	}
+
+	log.Info("trash purge enabled", slog.Duration("retention", retention), slog.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := sqlite.PurgeDeleted(s, retention)
+		if err != nil {
+			log.Error("trash purge failed", slog.Any("error", err))
+			continue
+		}
+		if purged > 0 {
+			log.Info("trash purged", slog.Int("count", purged))
+		}
+	}
+}
+
+// deletedParam разбирает ?deleted=true: корзину видят только пользователи с правом записи
+func deletedParam(log *slog.Logger, s *sqlite.Storage, user string, w http.ResponseWriter, r *http.Request) (bool, bool) {
+	if r.URL.Query().Get("deleted") != "true" {
+		return false, true
+	}
+	if !verify.HasPermission(s, user, verify.WritePermission) {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return false, false
+	}
+	return true, true
+}
+
+// /films/{id}/restore возвращает фильм из корзины вместе с составом и жанрами
+func PostFilmRestore(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	restore(log, s, w, r, "film", sqlite.RestoreFilm)
+}
+
+// /actors/{id}/restore возвращает человека из корзины вместе с его ролями
+func PostActorRestore(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	restore(log, s, w, r, "actor", sqlite.RestoreActor)
+}
+
+func restore(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request, entity string, fn func(s *sqlite.Storage, id int) error) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok = verify.User(user, pass, log, verify.WritePermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return
+	}
+	log.Info("authorization was successful")
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid "+entity+" ID", slog.Any("error", err))
+		http.Error(w, "invalid "+entity+" ID", http.StatusBadRequest)
+		return
+	}
+
+	err = fn(s.As(user), id)
+	if errors.Is(err, sqlite.ErrTitleTaken) {
+		log.Error(entity+" title is taken", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error("no deleted "+entity, slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info(entity+" restored successfully", slog.Int("id", id))
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"errors"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+)
+
+// ValidateFilm проверяет фильм по тем же правилам для POST, PUT и импорта
+func ValidateFilm(film sqlite.Film) error {
+	if len(film.Title) < 1 || len(film.Title) > 150 {
+		return errors.New("wrong title")
+	}
+
+	if len(film.Description) > 1000 {
+		return errors.New("too long description")
+	}
+
+	if film.CriticRating < 0 || film.CriticRating > 10 {
+		return errors.New("wrong rating")
+	}
+
+	for _, actor := range film.Actors {
+		if actor.Id == 0 && actor.Name == "" {
+			return errors.New("actor without id and name")
+		}
+	}
+
+	for _, genre := range film.Genres {
+		if strings.TrimSpace(genre) == "" {
+			return sqlite.ErrEmptyGenre
+		}
+	}
+
+	for _, credit := range film.Credits {
+		if credit.Role != "" && !sqlite.ValidRole(credit.Role) {
+			return errors.New("wrong credit role")
+		}
+		if credit.PersonId == 0 && credit.Name == "" {
+			return errors.New("credit without person")
+		}
+	}
+
+	_, err := sqlite.NormalizeDate(film.ReleaseDate)
+	return err
+}
+
+// ValidateActor проверяет актёра по тем же правилам для POST, PUT и импорта
+func ValidateActor(actor sqlite.Actor) error {
+	if actor.Gender != "male" && actor.Gender != "female" {
+		return errors.New("wrong gender")
+	}
+
+	_, err := sqlite.NormalizeDate(actor.BirthDate)
+	if err != nil {
+		return err
+	}
+
+	for _, film := range actor.Films {
+		if film.Id == 0 && film.Name == "" {
+			return errors.New("film without id and name")
+		}
+	}
+
+	return nil
+}
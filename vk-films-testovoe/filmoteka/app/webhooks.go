@@ -0,0 +1,503 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vk-testovoe/filmoteka/config"
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// заголовки доставки. Подпись - "sha256=" и HMAC-SHA256 от "<timestamp>.<тело>" на секрете подписки,
+// см. SignWebhook. Получатель по X-Filmoteka-Timestamp отбрасывает старые повторы
+const (
+	WebhookEventHeader     = "X-Filmoteka-Event"
+	WebhookDeliveryHeader  = "X-Filmoteka-Delivery"
+	WebhookTimestampHeader = "X-Filmoteka-Timestamp"
+	WebhookSignatureHeader = "X-Filmoteka-Signature"
+
+	// сколько доставок отправляется за проход
+	webhookBatch = 100
+	// сколько ответа подписчика сохраняется в журнал при ошибке
+	webhookErrorBody = 200
+)
+
+// SignWebhook возвращает значение X-Filmoteka-Signature для тела доставки
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateWebhook проверяет адрес подписки и типы событий
+func ValidateWebhook(webhook sqlite.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("wrong webhook url")
+	}
+
+	if len(webhook.Events) == 0 {
+		return errors.New("no webhook events")
+	}
+	for _, event := range webhook.Events {
+		if !sqlite.ValidWebhookEvent(event) {
+			return fmt.Errorf("wrong webhook event %q", event)
+		}
+	}
+
+	return nil
+}
+
+// DispatchWebhooks раз в cfg.PollInterval отправляет подписчикам доставки, время которых наступило
+func DispatchWebhooks(log *slog.Logger, s *sqlite.Storage, cfg config.Webhooks) {
+	if cfg.PollInterval <= 0 {
+		return
+	}
+
+	log.Info("webhooks dispatcher enabled", slog.Duration("interval", cfg.PollInterval))
+
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+		// перенаправление POST превратилось бы в GET без тела, поэтому 3xx - неудачная попытка
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for {
+			sent, err := DeliverWebhooks(context.Background(), log, s, client, cfg, time.Now())
+			if err != nil {
+				log.Error("webhooks delivery failed", slog.Any("error", err))
+			}
+			// неполная пачка - очередь на это время разобрана
+			if err != nil || sent < webhookBatch {
+				break
+			}
+		}
+	}
+}
+
+// DeliverWebhooks отправляет одну пачку доставок, время которых наступило к now,
+// и возвращает число сделанных попыток. Неудачная попытка откладывает доставку
+// с удвоением паузы, а после cfg.MaxAttempts попыток переводит её в dead.
+//
+// Подписчикам доставки уходят параллельно, чтобы медленный получатель не задерживал
+// остальных, а одному подписчику - по порядку событий.
+func DeliverWebhooks(ctx context.Context, log *slog.Logger, s *sqlite.Storage, client *http.Client, cfg config.Webhooks, now time.Time) (int, error) {
+	deliveries, err := sqlite.DueDeliveries(s, now, webhookBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	queues := map[int][]sqlite.Delivery{}
+	for _, delivery := range deliveries {
+		queues[delivery.WebhookId] = append(queues[delivery.WebhookId], delivery)
+	}
+
+	var wg sync.WaitGroup
+	// попытки записываются по одной: SQLite не принимает параллельные записи
+	var mu sync.Mutex
+	var recordErr error
+	for _, queue := range queues {
+		wg.Add(1)
+		go func(queue []sqlite.Delivery) {
+			defer wg.Done()
+			for _, delivery := range queue {
+				attempt := sendWebhook(ctx, client, delivery)
+
+				mu.Lock()
+				if recordErr == nil {
+					recordErr = recordWebhookAttempt(log, s, cfg, now, delivery, attempt)
+				}
+				failed := recordErr != nil
+				mu.Unlock()
+				if failed {
+					return
+				}
+			}
+		}(queue)
+	}
+	wg.Wait()
+
+	if recordErr != nil {
+		return 0, recordErr
+	}
+	return len(deliveries), nil
+}
+
+// recordWebhookAttempt сохраняет попытку и решает, что дальше с доставкой
+func recordWebhookAttempt(log *slog.Logger, s *sqlite.Storage, cfg config.Webhooks, now time.Time, delivery sqlite.Delivery, attempt sqlite.DeliveryAttempt) error {
+	attempts := delivery.Attempts + 1
+
+	status, next := sqlite.DeliveryPending, time.Time{}
+	switch {
+	case attempt.Error == "":
+		status = sqlite.DeliveryDelivered
+	case attempts >= cfg.MaxAttempts:
+		status = sqlite.DeliveryDead
+		log.Warn("webhook delivery is dead", slog.Int("delivery", delivery.DeliveryId),
+			slog.Int("webhook", delivery.WebhookId), slog.String("error", attempt.Error))
+	default:
+		next = now.Add(webhookBackoff(cfg, attempts))
+		log.Info("webhook delivery failed", slog.Int("delivery", delivery.DeliveryId),
+			slog.Int("attempts", attempts), slog.String("error", attempt.Error))
+	}
+
+	return sqlite.RecordAttempt(s, delivery.DeliveryId, attempt, status, next)
+}
+
+// webhookBackoff - пауза после attempts неудачных попыток: Backoff, затем вдвое больше до MaxBackoff
+func webhookBackoff(cfg config.Webhooks, attempts int) time.Duration {
+	backoff := cfg.Backoff
+	for i := 1; i < attempts && (cfg.MaxBackoff <= 0 || backoff < cfg.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if cfg.MaxBackoff > 0 {
+		backoff = min(backoff, cfg.MaxBackoff)
+	}
+	return backoff
+}
+
+// sendWebhook делает одну попытку доставки. Успех - ответ 2xx, иначе причина в Error
+func sendWebhook(ctx context.Context, client *http.Client, delivery sqlite.Delivery) sqlite.DeliveryAttempt {
+	start := time.Now()
+	attempt := sqlite.DeliveryAttempt{AttemptedAt: start.UTC().Format(time.DateTime)}
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "filmoteka-webhooks")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(delivery.DeliveryId))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	attempt.DurationMs = int(time.Since(start).Milliseconds())
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBody))
+		attempt.Error = strings.TrimSpace(fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, body))
+	}
+	return attempt
+}
+
+func webhooksAuth(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		log.Error("unauthorized request")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	ok = verify.User(user, pass, log, verify.WebhooksPermission, s)
+	if !ok {
+		log.Error("wrong role")
+		http.Error(w, "wrong role", http.StatusUnauthorized)
+		return "", false
+	}
+	log.Info("authorization was successful")
+	return user, true
+}
+
+// webhookIDs разбирает ID подписки и, для /webhooks/{id}/deliveries/{deliveryId}/retry, ID доставки
+func webhookIDs(log *slog.Logger, w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	parts := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		log.Error("invalid URL path")
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Error("invalid webhook ID", slog.Any("error", err))
+		http.Error(w, "invalid webhook ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	if len(parts) < 5 {
+		return id, 0, true
+	}
+	deliveryID, err := strconv.Atoi(parts[4])
+	if err != nil {
+		log.Error("invalid delivery ID", slog.Any("error", err))
+		http.Error(w, "invalid delivery ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return id, deliveryID, true
+}
+
+// readWebhook разбирает тело запроса поверх webhook: отсутствующие поля остаются как были
+func readWebhook(log *slog.Logger, w http.ResponseWriter, r *http.Request, webhook *sqlite.Webhook) bool {
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(r.Body)
+	if err != nil {
+		log.Error("wrong input", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), webhook); err != nil {
+		log.Error("wrong unmarshal inputted", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if err = ValidateWebhook(*webhook); err != nil {
+		log.Error("wrong webhook", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// GET /webhooks - подписки без секретов
+func GetWebhooks(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	if _, ok := webhooksAuth(log, s, w, r); !ok {
+		return
+	}
+
+	webhooks, err := sqlite.ListWebhooks(s)
+	if err != nil {
+		log.Error("no webhooks", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	writeJSON(log, w, http.StatusOK, webhooks)
+	log.Info("get webhooks successfully")
+}
+
+// POST /webhooks создаёт подписку. Без secret он генерируется; секрет виден только в этом ответе
+func PostWebhook(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, ok := webhooksAuth(log, s, w, r)
+	if !ok {
+		return
+	}
+
+	webhook := sqlite.Webhook{Active: true}
+	if !readWebhook(log, w, r, &webhook) {
+		return
+	}
+
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			log.Error("cant generate webhook secret", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	id, err := sqlite.CreateWebhook(s.As(user), webhook)
+	if err != nil {
+		log.Error("error to post webhook to storage", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	webhook, err = sqlite.GetWebhook(s, id)
+	if err != nil {
+		log.Error("no webhook", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/webhooks/"+strconv.Itoa(id))
+	writeJSON(log, w, http.StatusCreated, webhook)
+	log.Info("webhook created", slog.Int("id", id))
+}
+
+// GET /webhooks/{id} - подписка без секрета
+func GetOneWebhook(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	if _, ok := webhooksAuth(log, s, w, r); !ok {
+		return
+	}
+	id, _, ok := webhookIDs(log, w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := sqlite.GetWebhook(s, id)
+	if err != nil {
+		log.Error("no webhook", slog.Any("error", err))
+		http.Error(w, "no such webhook", http.StatusNotFound)
+		return
+	}
+	webhook.Secret = ""
+
+	writeJSON(log, w, http.StatusOK, webhook)
+	log.Info("get webhook successfully", slog.Int("id", id))
+}
+
+// PUT /webhooks/{id} меняет переданные поля подписки, без secret секрет остаётся прежним
+func PutOneWebhook(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, ok := webhooksAuth(log, s, w, r)
+	if !ok {
+		return
+	}
+	id, _, ok := webhookIDs(log, w, r)
+	if !ok {
+		return
+	}
+
+	stored, err := sqlite.GetWebhook(s, id)
+	if err != nil {
+		log.Error("no webhook", slog.Any("error", err))
+		http.Error(w, "no such webhook", http.StatusNotFound)
+		return
+	}
+
+	webhook := stored
+	if !readWebhook(log, w, r, &webhook) {
+		return
+	}
+	webhook.WebhookId, webhook.CreatedAt = stored.WebhookId, stored.CreatedAt
+	if webhook.Secret == "" {
+		webhook.Secret = stored.Secret
+	}
+
+	err = sqlite.UpdateWebhook(s.As(user), webhook)
+	if err != nil {
+		log.Error("error to update webhook", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	webhook.Secret = ""
+
+	writeJSON(log, w, http.StatusOK, webhook)
+	log.Info("webhook updated", slog.Int("id", id))
+}
+
+// DELETE /webhooks/{id} удаляет подписку вместе с очередью и журналом доставок
+func DeleteOneWebhook(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	user, ok := webhooksAuth(log, s, w, r)
+	if !ok {
+		return
+	}
+	id, _, ok := webhookIDs(log, w, r)
+	if !ok {
+		return
+	}
+
+	err := sqlite.DeleteWebhook(s.As(user), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Error("no webhook", slog.Any("error", err))
+		http.Error(w, "no such webhook", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("error to delete webhook", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("webhook deleted", slog.Int("id", id))
+}
+
+// GET /webhooks/{id}/deliveries?status=dead - журнал доставок подписки, новые первыми
+func GetWebhookDeliveries(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	if _, ok := webhooksAuth(log, s, w, r); !ok {
+		return
+	}
+	id, _, ok := webhookIDs(log, w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && !sqlite.ValidDeliveryStatus(status) {
+		log.Error("wrong delivery status")
+		http.Error(w, "wrong status", http.StatusBadRequest)
+		return
+	}
+
+	page, limit, err := pageParams(r)
+	if err != nil {
+		log.Error("wrong pagination", slog.Any("error", err))
+		http.Error(w, "wrong pagination", http.StatusBadRequest)
+		return
+	}
+
+	_, err = sqlite.GetWebhook(s, id)
+	if err != nil {
+		log.Error("no webhook", slog.Any("error", err))
+		http.Error(w, "no such webhook", http.StatusNotFound)
+		return
+	}
+
+	deliveries, err := sqlite.GetDeliveries(s, id, status, page, limit)
+	if err != nil {
+		log.Error("no deliveries", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(log, w, http.StatusOK, deliveries)
+	log.Info("get webhook deliveries successfully", slog.Int("id", id))
+}
+
+// POST /webhooks/{id}/deliveries/{deliveryId}/retry возвращает доставку из dead в очередь
+func PostDeliveryRetry(log *slog.Logger, s *sqlite.Storage, w http.ResponseWriter, r *http.Request) {
+	if _, ok := webhooksAuth(log, s, w, r); !ok {
+		return
+	}
+	id, deliveryID, ok := webhookIDs(log, w, r)
+	if !ok {
+		return
+	}
+
+	err := sqlite.RetryDelivery(s, id, deliveryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Error("no dead delivery", slog.Any("error", err))
+		http.Error(w, "no such dead delivery", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("error to retry delivery", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("delivery queued again", slog.Int("webhook", id), slog.Int("delivery", deliveryID))
+}
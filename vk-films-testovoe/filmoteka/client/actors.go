@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ListActors возвращает актёров, с deleted - только из корзины (нужно право write)
+func (c *Client) ListActors(ctx context.Context, deleted bool) ([]Actor, error) {
+	query := url.Values{}
+	setBool(query, "deleted", deleted)
+
+	var actors []Actor
+	err := c.do(ctx, http.MethodGet, "/actors", query, nil, &actors)
+	return actors, err
+}
+
+// GetActor возвращает актёра, по ID слитого дубля - оставшуюся запись
+func (c *Client) GetActor(ctx context.Context, id int) (*Actor, error) {
+	var actor Actor
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/actors/%d", id), nil, nil, &actor)
+	if err != nil {
+		return nil, err
+	}
+	return &actor, nil
+}
+
+// CreateActor добавляет актёра, с createMissing неизвестные фильмы создаются
+func (c *Client) CreateActor(ctx context.Context, actor Actor, createMissing bool) error {
+	query := url.Values{}
+	setBool(query, "createMissing", createMissing)
+	return c.do(ctx, http.MethodPost, "/actors", query, actor.writable(), nil)
+}
+
+func (c *Client) UpdateActor(ctx context.Context, id int, actor Actor, createMissing bool) error {
+	query := url.Values{}
+	setBool(query, "createMissing", createMissing)
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/actors/%d", id), query, actor.writable(), nil)
+}
+
+// DeleteActor переносит актёра в корзину
+func (c *Client) DeleteActor(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/actors/%d", id), nil, nil, nil)
+}
+
+func (c *Client) RestoreActor(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/actors/%d/restore", id), nil, nil, nil)
+}
+
+// MergeActor сливает дубль mergeId в актёра id, policy - MergeKeep, MergeFill или MergeTake
+func (c *Client) MergeActor(ctx context.Context, id, mergeId int, policy string) (*Actor, error) {
+	var actor Actor
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/actors/%d/merge", id), nil, mergeRequest{MergeId: mergeId, Policy: policy}, &actor)
+	if err != nil {
+		return nil, err
+	}
+	return &actor, nil
+}
+
+func (c *Client) ActorRevisions(ctx context.Context, id int) ([]Revision, error) {
+	var revisions []Revision
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/actors/%d/revisions", id), nil, nil, &revisions)
+	return revisions, err
+}
+
+// ActorRevisionDiff - отличия версии from от версии to, при to = 0 - от текущей записи
+func (c *Client) ActorRevisionDiff(ctx context.Context, id, from, to int) ([]FieldChange, error) {
+	var changes []FieldChange
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/actors/%d/revisions/diff", id), revisionRange(from, to), nil, &changes)
+	return changes, err
+}
+
+func (c *Client) RevertActor(ctx context.Context, id, number int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/actors/%d/revisions/%d/revert", id, number), nil, nil, nil)
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ImportOptions - параметры массового импорта
+type ImportOptions struct {
+	// films или actors
+	Kind string
+	// csv или jsonl
+	Format string
+	// проверить файл без сохранения
+	DryRun bool
+	// skip или update, по умолчанию skip
+	OnConflict    string
+	CreateMissing bool
+}
+
+// Import загружает CSV или JSON Lines. Запрос не повторяется: тело читается один раз.
+func (c *Client) Import(ctx context.Context, data io.Reader, opts ImportOptions) (*ImportReport, error) {
+	query := url.Values{}
+	query.Set("kind", opts.Kind)
+	setString(query, "format", opts.Format)
+	setBool(query, "dryRun", opts.DryRun)
+	setString(query, "onConflict", opts.OnConflict)
+	setBool(query, "createMissing", opts.CreateMissing)
+
+	contentType := "text/csv"
+	if opts.Format == "jsonl" {
+		contentType = "application/x-ndjson"
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, "/import", query, contentType, func() io.Reader { return data })
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var report ImportReport
+	err = decode(resp, &report)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Export пишет в w выгрузку каталога в формате jsonl, csv (zip-архив) или sql
+func (c *Client) Export(ctx context.Context, format string, w io.Writer) error {
+	query := url.Values{}
+	setString(query, "format", format)
+
+	resp, err := c.send(ctx, http.MethodGet, "/export", query, "", noBody)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Backup делает резервную копию базы на сервере, ErrUnavailable - если каталог для копий не настроен
+func (c *Client) Backup(ctx context.Context) (*BackupInfo, error) {
+	var info BackupInfo
+	err := c.do(ctx, http.MethodPost, "/backup", nil, nil, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// FindDuplicates запускает фоновый поиск дублей. kind - people или films, пустой - оба,
+// threshold 0 - порог по умолчанию. Прогресс возвращает DuplicateJob.
+func (c *Client) FindDuplicates(ctx context.Context, kind string, threshold float64) (*DuplicateJob, error) {
+	query := url.Values{}
+	setString(query, "kind", kind)
+	if threshold != 0 {
+		query.Set("threshold", strconv.FormatFloat(threshold, 'f', -1, 64))
+	}
+
+	var job DuplicateJob
+	err := c.do(ctx, http.MethodPost, "/duplicates", query, nil, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// DuplicateJobs - последние поиски дублей без найденных пар
+func (c *Client) DuplicateJobs(ctx context.Context) ([]DuplicateJob, error) {
+	var jobs []DuplicateJob
+	err := c.do(ctx, http.MethodGet, "/duplicates", nil, nil, &jobs)
+	return jobs, err
+}
+
+func (c *Client) DuplicateJob(ctx context.Context, id int) (*DuplicateJob, error) {
+	var job DuplicateJob
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/duplicates/%d", id), nil, nil, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// AuditFilter - фильтры журнала изменений, From и To - RFC3339 или yyyy-mm-dd
+type AuditFilter struct {
+	User     string
+	Entity   string
+	EntityId int
+	From     string
+	To       string
+	Page     int
+	Limit    int
+}
+
+// Audit читает журнал изменений, нужно право audit
+func (c *Client) Audit(ctx context.Context, filter AuditFilter) (*AuditPage, error) {
+	query := url.Values{}
+	setString(query, "user", filter.User)
+	setString(query, "entity", filter.Entity)
+	setInt(query, "entityId", filter.EntityId)
+	setString(query, "from", filter.From)
+	setString(query, "to", filter.To)
+	setInt(query, "page", filter.Page)
+	setInt(query, "limit", filter.Limit)
+
+	var page AuditPage
+	err := c.do(ctx, http.MethodGet, "/audit", query, nil, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// APIKey - ключ API для сервиса. Key сервер возвращает только при создании,
+// Prefix - начало ключа, по нему ключ можно узнать в списке
+type APIKey struct {
+	Id          int      `json:"id"`
+	Name        string   `json:"name"`
+	Prefix      string   `json:"prefix"`
+	Permissions []string `json:"permissions"`
+	CreatedBy   string   `json:"createdBy"`
+	CreatedAt   string   `json:"createdAt"`
+	ExpiresAt   string   `json:"expiresAt,omitempty"`
+	LastUsedAt  string   `json:"lastUsedAt,omitempty"`
+	RevokedAt   string   `json:"revokedAt,omitempty"`
+	Key         string   `json:"key,omitempty"`
+}
+
+type apiKeyRequest struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	ExpiresAt   string   `json:"expiresAt,omitempty"`
+}
+
+// ListAPIKeys возвращает все ключи без самих ключей, в том числе отозванные, нужно право keys
+func (c *Client) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	err := c.do(ctx, http.MethodGet, "/api-keys", nil, nil, &keys)
+	return keys, err
+}
+
+func (c *Client) GetAPIKey(ctx context.Context, id int) (*APIKey, error) {
+	var key APIKey
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api-keys/%d", id), nil, nil, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CreateAPIKey выпускает ключ с правами permissions, нулевой expiresAt - ключ бессрочный.
+// Key есть только в ответе, с ним ключ передаётся в TokenAuth. ErrConflict - активный ключ с таким именем уже есть
+func (c *Client) CreateAPIKey(ctx context.Context, name string, permissions []string, expiresAt time.Time) (*APIKey, error) {
+	req := apiKeyRequest{Name: name, Permissions: permissions}
+	if !expiresAt.IsZero() {
+		req.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+
+	var key APIKey
+	err := c.do(ctx, http.MethodPost, "/api-keys", nil, req, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey отзывает ключ, ErrNotFound - если его нет или он уже отозван
+func (c *Client) RevokeAPIKey(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api-keys/%d", id), nil, nil, nil)
+}
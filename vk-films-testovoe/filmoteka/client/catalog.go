@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ListGenres возвращает жанры с количеством фильмов в каждом
+func (c *Client) ListGenres(ctx context.Context) ([]Genre, error) {
+	var genres []Genre
+	err := c.do(ctx, http.MethodGet, "/genres", nil, nil, &genres)
+	return genres, err
+}
+
+func (c *Client) GetGenre(ctx context.Context, id int) (*Genre, error) {
+	var genre Genre
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/genres/%d", id), nil, nil, &genre)
+	if err != nil {
+		return nil, err
+	}
+	return &genre, nil
+}
+
+func (c *Client) CreateGenre(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/genres", nil, Genre{Name: name}, nil)
+}
+
+func (c *Client) RenameGenre(ctx context.Context, id int, name string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/genres/%d", id), nil, Genre{Name: name}, nil)
+}
+
+func (c *Client) DeleteGenre(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/genres/%d", id), nil, nil, nil)
+}
+
+// ListPeople возвращает актёров и съёмочную группу с фильмографией,
+// role (actor, director, writer, composer, producer) оставляет только людей с этой ролью
+func (c *Client) ListPeople(ctx context.Context, role string) ([]Person, error) {
+	query := url.Values{}
+	setString(query, "role", role)
+
+	var people []Person
+	err := c.do(ctx, http.MethodGet, "/people", query, nil, &people)
+	return people, err
+}
+
+func (c *Client) GetPerson(ctx context.Context, id int) (*Person, error) {
+	var person Person
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/people/%d", id), nil, nil, &person)
+	if err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
+
+// CreatePerson добавляет человека, с createMissing неизвестные фильмы из credits создаются
+func (c *Client) CreatePerson(ctx context.Context, person Person, createMissing bool) error {
+	query := url.Values{}
+	setBool(query, "createMissing", createMissing)
+	return c.do(ctx, http.MethodPost, "/people", query, person, nil)
+}
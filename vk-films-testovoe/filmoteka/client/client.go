@@ -0,0 +1,226 @@
+// Package client - типизированный клиент REST API фильмотеки.
+//
+//	c := client.New("http://localhost:8080", client.WithAuth(client.BasicAuth("User", "User")))
+//	films, err := c.ListFilms(ctx, client.FilmFilter{Sort: "score", Desc: true})
+//
+// Ошибки API возвращаются как *Error и сравниваются через errors.Is с ErrNotFound и другими.
+// Идемпотентные запросы (GET, PUT, DELETE) повторяются при сетевых ошибках и ответах 5xx и 429.
+// Повтор после 429 ждёт не меньше Retry-After, а если сервер просит ждать дольше MaxBackoff, ошибка возвращается сразу.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	baseURL string
+	http    *http.Client
+	auth    Auth
+	retry   Retry
+}
+
+// Retry - повторы идемпотентных запросов
+type Retry struct {
+	// всего попыток, 1 - без повторов
+	Attempts int
+	// пауза перед второй попыткой, дальше удваивается до MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultRetry = Retry{Attempts: 3, Backoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+type Option func(c *Client)
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+func WithAuth(auth Auth) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+func WithRetry(retry Retry) Option {
+	return func(c *Client) {
+		c.retry = retry
+	}
+}
+
+// New создаёт клиент для сервера baseURL, например http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    http.DefaultClient,
+		retry:   DefaultRetry,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Auth добавляет к запросу данные для входа
+type Auth interface {
+	Apply(r *http.Request)
+}
+
+type basicAuth struct {
+	user, pass string
+}
+
+func (a basicAuth) Apply(r *http.Request) {
+	r.SetBasicAuth(a.user, a.pass)
+}
+
+// BasicAuth - вход по логину и паролю
+func BasicAuth(user, pass string) Auth {
+	return basicAuth{user: user, pass: pass}
+}
+
+type tokenAuth string
+
+func (a tokenAuth) Apply(r *http.Request) {
+	r.Header.Set("Authorization", "Bearer "+string(a))
+}
+
+// TokenAuth - вход по токену в заголовке Authorization: Bearer
+func TokenAuth(token string) Auth {
+	return tokenAuth(token)
+}
+
+// do отправляет in как JSON и разбирает JSON-ответ в out, nil in или out - без тела
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body []byte
+	contentType := ""
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+
+	newBody := noBody
+	if body != nil {
+		newBody = func() io.Reader { return bytes.NewReader(body) }
+	}
+
+	resp, err := c.send(ctx, method, path, query, contentType, newBody)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decode(resp, out)
+}
+
+// decode разбирает JSON-ответ в out, при nil out тело дочитывается, чтобы соединение переиспользовалось
+func decode(resp *http.Response, out any) error {
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func noBody() io.Reader {
+	return nil
+}
+
+// send выполняет запрос с повторами и возвращает успешный ответ, который закрывает вызывающий.
+// body вызывается на каждую попытку и должен каждый раз возвращать тело заново.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, contentType string, body func() io.Reader) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	attempts := 1
+	if idempotent(method) && c.retry.Attempts > 1 {
+		attempts = c.retry.Attempts
+	}
+	backoff := c.retry.Backoff
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, u, body())
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if c.auth != nil {
+			c.auth.Apply(req)
+		}
+
+		resp, err := c.http.Do(req)
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			return resp, nil
+		}
+
+		retry := false
+		wait := backoff
+		if err == nil {
+			apiErr := readError(resp)
+			retry = apiErr.temporary() && apiErr.RetryAfter <= c.retry.MaxBackoff
+			wait = max(wait, apiErr.RetryAfter)
+			err = apiErr
+		} else {
+			retry = ctx.Err() == nil
+		}
+		if !retry || attempt >= attempts {
+			return nil, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, c.retry.MaxBackoff)
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// setInt добавляет в запрос числовой параметр, если он задан
+func setInt(query url.Values, key string, value int) {
+	if value != 0 {
+		query.Set(key, strconv.Itoa(value))
+	}
+}
+
+// setBool добавляет в запрос параметр =true, если он задан
+func setBool(query url.Values, key string, value bool) {
+	if value {
+		query.Set(key, "true")
+	}
+}
+
+// setString добавляет в запрос строковый параметр, если он задан
+func setString(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
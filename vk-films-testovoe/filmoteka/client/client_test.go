@@ -0,0 +1,377 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"vk-testovoe/filmoteka/app"
+	"vk-testovoe/filmoteka/config"
+	"vk-testovoe/filmoteka/openapi"
+	"vk-testovoe/filmoteka/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newServer поднимает настоящие обработчики со строгой проверкой по спецификации,
+// так что запрос клиента, не совпадающий с openapi3.yaml, тоже ломает тест
+func newServer(t *testing.T) *httptest.Server {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	s, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		Backup: config.Backup{Dir: t.TempDir(), Keep: 1},
+		Events: config.Events{PollInterval: 10 * time.Millisecond},
+	}
+	handler, err := app.NewHandler(log, s, cfg, openapi.Options{Requests: true, Responses: true, Strict: true}, nil)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	admin := New(srv.URL, WithAuth(BasicAuth("Admin", "Admin")))
+	user := New(srv.URL, WithAuth(BasicAuth("User", "User")))
+
+	require.NoError(t, admin.CreateGenre(ctx, "Драма"))
+	require.NoError(t, admin.CreateActor(ctx, Actor{Name: "Олег Янковский", Gender: "male", BirthDate: "1944-02-23"}, false))
+	require.NoError(t, admin.CreateFilm(ctx, Film{
+		Title:        "Полёты во сне и наяву",
+		CriticRating: 9,
+		ReleaseDate:  "1983",
+		Actors:       []Ref{{Name: "Олег Янковский"}},
+		Genres:       []string{"Драма"},
+	}, false))
+	require.NoError(t, admin.CreatePerson(ctx, Person{Name: "Роман Балаян", Credits: []Credit{{FilmId: 1, Role: "director"}}}, false))
+
+	films, err := user.ListFilms(ctx, FilmFilter{Sort: "score", Desc: true, Genre: "Драма"})
+	require.NoError(t, err)
+	require.Len(t, films, 1)
+	require.Equal(t, "1983", films[0].ReleaseDate)
+
+	film, err := user.GetFilm(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []Ref{{Id: 1, Name: "Олег Янковский"}}, film.Actors)
+
+	film.CriticRating = 10
+	require.NoError(t, admin.UpdateFilm(ctx, film.Id, *film, false))
+	require.NoError(t, admin.AddCastMember(ctx, 1, 1, CastMember{Character: "Сергей Макаров"}))
+
+	actor, err := user.GetActor(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, "male", actor.Gender)
+
+	people, err := user.ListPeople(ctx, "director")
+	require.NoError(t, err)
+	require.Len(t, people, 1)
+
+	genres, err := user.ListGenres(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, genres[0].FilmsCount)
+
+	require.NoError(t, user.RateFilm(ctx, 1, 9))
+	rating, err := user.MyRating(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, 9, rating)
+
+	require.NoError(t, user.CreateReview(ctx, 1, "Лучший фильм о кризисе среднего возраста"))
+	require.NoError(t, admin.SetReviewStatus(ctx, 1, ReviewApproved))
+	reviews, err := user.ListReviews(ctx, 1, ReviewFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, 1, reviews.Total)
+
+	require.NoError(t, user.AddToWatchlist(ctx, 1, "пересмотреть"))
+	watchlist, err := user.Watchlist(ctx)
+	require.NoError(t, err)
+	require.Len(t, watchlist, 1)
+	require.NoError(t, user.MarkWatched(ctx, 1, ListEntry{WatchedAt: "01.02.2024"}))
+	watched, err := user.Watched(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "2024-02-01", watched[0].WatchedAt)
+
+	revisions, err := admin.FilmRevisions(ctx, 1)
+	require.NoError(t, err)
+	require.NotEmpty(t, revisions)
+	changes, err := admin.FilmRevisionDiff(ctx, 1, revisions[0].Number, 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, changes)
+
+	var data struct {
+		Film struct {
+			Title string `json:"title"`
+		} `json:"film"`
+	}
+	require.NoError(t, user.GraphQL(ctx, `query($id: ID!) { film(id: $id) { title } }`, map[string]any{"id": "1"}, &data))
+	require.Equal(t, "Полёты во сне и наяву", data.Film.Title)
+	var gqlErrs GraphQLErrors
+	require.ErrorAs(t, user.GraphQL(ctx, `{ nope }`, nil, nil), &gqlErrs)
+
+	report, err := admin.Import(ctx, strings.NewReader("name,gender,birthdate\nОлег Табаков,male,1935-08-17\n"),
+		ImportOptions{Kind: "actors", Format: "csv"})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Created)
+
+	var dump bytes.Buffer
+	require.NoError(t, admin.Export(ctx, "jsonl", &dump))
+	require.Contains(t, dump.String(), "Олег Табаков")
+
+	backup, err := admin.Backup(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, backup.Path)
+
+	job, err := admin.FindDuplicates(ctx, "people", 0.9)
+	require.NoError(t, err)
+	job, err = admin.DuplicateJob(ctx, job.Id)
+	require.NoError(t, err)
+	require.Equal(t, []string{"people"}, job.Kinds)
+
+	require.NoError(t, admin.DeleteFilm(ctx, 1))
+	deleted, err := admin.ListFilms(ctx, FilmFilter{Deleted: true})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.NoError(t, admin.RestoreFilm(ctx, 1))
+
+	audit, err := admin.Audit(ctx, AuditFilter{Entity: "film", EntityId: 1})
+	require.NoError(t, err)
+	require.NotZero(t, audit.Total)
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	user := New(srv.URL, WithAuth(BasicAuth("User", "User")))
+
+	_, err := user.GetFilm(ctx, 100)
+	require.ErrorIs(t, err, ErrNotFound)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	err = user.CreateGenre(ctx, "Драма")
+	require.ErrorIs(t, err, ErrUnauthorized)
+
+	err = user.RateFilm(ctx, 1, 11)
+	require.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = New(srv.URL).ListFilms(ctx, FilmFilter{})
+	require.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		if calls.Add(1) <= 2 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"id":1,"name":"Драма","filmsCount":3}]`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithAuth(TokenAuth("secret")), WithRetry(Retry{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+
+	genres, err := c.ListGenres(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []Genre{{Id: 1, Name: "Драма", FilmsCount: 3}}, genres)
+	require.EqualValues(t, 3, calls.Load())
+
+	// POST не идемпотентен и не повторяется
+	calls.Store(0)
+	err = c.CreateGenre(context.Background(), "Драма")
+	require.ErrorIs(t, err, ErrUnavailable)
+	require.EqualValues(t, 1, calls.Load())
+
+	// попытки кончились
+	calls.Store(-10)
+	_, err = c.ListGenres(context.Background())
+	require.ErrorIs(t, err, ErrUnavailable)
+	require.EqualValues(t, -7, calls.Load())
+
+	// отмена контекста прерывает ожидание между попытками
+	calls.Store(-10)
+	slow := New(srv.URL, WithAuth(TokenAuth("secret")), WithRetry(Retry{Attempts: 5, Backoff: time.Hour, MaxBackoff: time.Hour}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = slow.ListGenres(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// сервер просит подождать дольше MaxBackoff - ошибка возвращается без повторов
+	calls.Store(0)
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+
+	_, err = New(limited.URL, WithRetry(DefaultRetry)).ListGenres(context.Background())
+	require.ErrorIs(t, err, ErrRateLimited)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, time.Minute, apiErr.RetryAfter)
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestClientEvents(t *testing.T) {
+	srv := newServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	admin := New(srv.URL, WithAuth(BasicAuth("Admin", "Admin")))
+	user := New(srv.URL, WithAuth(BasicAuth("User", "User")))
+
+	require.NoError(t, admin.CreateActor(ctx, Actor{Name: "Олег Янковский", Gender: "male", BirthDate: "1944-02-23"}, false))
+	require.NoError(t, admin.CreateFilm(ctx, Film{Title: "Полёты во сне и наяву", ReleaseDate: "1983", Actors: []Ref{{Id: 1}}}, false))
+
+	// collect читает n событий после lastEventID
+	stop := errors.New("stop")
+	collect := func(lastEventID, n int) []Event {
+		events := []Event{}
+		err := user.Events(ctx, lastEventID, func(event Event) error {
+			events = append(events, event)
+			if len(events) == n {
+				return stop
+			}
+			return nil
+		})
+		require.ErrorIs(t, err, stop)
+		return events
+	}
+
+	events := collect(1, 2)
+	require.Equal(t, 2, events[0].Id)
+	require.Equal(t, EventCreated, events[0].Type)
+	require.Equal(t, "film", events[0].Entity)
+	require.Equal(t, Event{Id: 3, Type: EventUpdated, Entity: "person", EntityId: 1, CreatedAt: events[1].CreatedAt}, events[1])
+
+	// сервер не знает таких событий, например база восстановлена из копии
+	events = collect(50, 2)
+	require.Equal(t, Event{Type: EventReset}, events[0])
+	require.Equal(t, 1, events[1].Id)
+
+	// отмена контекста завершает ожидание новых событий
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	err := user.Events(short, 3, func(event Event) error { return nil })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	err = New(srv.URL).Events(ctx, 0, func(event Event) error { return nil })
+	require.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestClientWebhooks(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	admin := New(srv.URL, WithAuth(BasicAuth("Admin", "Admin")))
+
+	_, err := New(srv.URL, WithAuth(BasicAuth("User", "User"))).ListWebhooks(ctx)
+	require.ErrorIs(t, err, ErrUnauthorized)
+	_, err = admin.CreateWebhook(ctx, Webhook{URL: "http://127.0.0.1:9/hook", Events: []string{"genre.created"}})
+	require.ErrorIs(t, err, ErrBadRequest)
+
+	webhook, err := admin.CreateWebhook(ctx, Webhook{URL: "http://127.0.0.1:9/hook", Events: []string{"film.created"}, Active: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, webhook.Id)
+	require.Len(t, webhook.Secret, 64)
+
+	// полученную подписку можно изменить и отправить обратно, секрет остаётся прежним
+	got, err := admin.GetWebhook(ctx, webhook.Id)
+	require.NoError(t, err)
+	require.Empty(t, got.Secret)
+	got.Events = append(got.Events, "film.deleted")
+	updated, err := admin.UpdateWebhook(ctx, got.Id, *got)
+	require.NoError(t, err)
+	require.Equal(t, []string{"film.created", "film.deleted"}, updated.Events)
+
+	require.NoError(t, admin.CreateFilm(ctx, Film{Title: "Полёты во сне и наяву", ReleaseDate: "1983"}, false))
+	page, err := admin.WebhookDeliveries(ctx, webhook.Id, DeliveryPending, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, page.Total)
+	require.Equal(t, "film.created", page.Deliveries[0].Event)
+	require.Equal(t, Event{Id: 1, Type: EventCreated, Entity: "film", EntityId: 1, CreatedAt: page.Deliveries[0].CreatedAt}, page.Deliveries[0].Payload)
+
+	require.ErrorIs(t, admin.RetryDelivery(ctx, webhook.Id, page.Deliveries[0].Id), ErrNotFound)
+
+	webhooks, err := admin.ListWebhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+
+	require.NoError(t, admin.DeleteWebhook(ctx, webhook.Id))
+	_, err = admin.GetWebhook(ctx, webhook.Id)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestClientAPIKeys(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	admin := New(srv.URL, WithAuth(BasicAuth("Admin", "Admin")))
+
+	_, err := admin.CreateAPIKey(ctx, "import", []string{"read"}, time.Now().Add(-time.Hour))
+	require.ErrorIs(t, err, ErrBadRequest)
+
+	key, err := admin.CreateAPIKey(ctx, "import", []string{"read", "write"}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, key.Id)
+	require.NotEmpty(t, key.Key)
+	_, err = admin.CreateAPIKey(ctx, "import", []string{"read"}, time.Time{})
+	require.ErrorIs(t, err, ErrConflict)
+
+	service := New(srv.URL, WithAuth(TokenAuth(key.Key)))
+	require.NoError(t, service.CreateGenre(ctx, "Комедия"))
+	_, err = service.ListAPIKeys(ctx)
+	require.ErrorIs(t, err, ErrUnauthorized)
+
+	got, err := admin.GetAPIKey(ctx, key.Id)
+	require.NoError(t, err)
+	require.Empty(t, got.Key)
+	require.Equal(t, key.Prefix, got.Prefix)
+
+	require.NoError(t, admin.RevokeAPIKey(ctx, key.Id))
+	require.ErrorIs(t, admin.RevokeAPIKey(ctx, key.Id), ErrNotFound)
+	_, err = service.ListGenres(ctx)
+	require.ErrorIs(t, err, ErrUnauthorized)
+
+	keys, err := admin.ListAPIKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NotEmpty(t, keys[0].RevokedAt)
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := `{"id":7,"type":"deleted","entity":"person","entityId":3,"createdAt":"2024-05-01 12:00:00"}`
+	request := func(secret string, sent time.Time) *http.Request {
+		timestamp := strconv.FormatInt(sent.Unix(), 10)
+		r := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+		r.Header.Set(WebhookTimestampHeader, timestamp)
+		r.Header.Set(WebhookSignatureHeader, app.SignWebhook(secret, timestamp, []byte(body)))
+		return r
+	}
+
+	event, err := VerifyWebhook(request("s3cret", time.Now()), "s3cret", 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, Event{Id: 7, Type: EventDeleted, Entity: "person", EntityId: 3, CreatedAt: "2024-05-01 12:00:00"}, event)
+
+	_, err = VerifyWebhook(request("other", time.Now()), "s3cret", 5*time.Minute)
+	require.ErrorIs(t, err, ErrWebhookSignature)
+	_, err = VerifyWebhook(request("s3cret", time.Now().Add(-time.Hour)), "s3cret", 5*time.Minute)
+	require.ErrorIs(t, err, ErrWebhookSignature)
+	_, err = VerifyWebhook(request("s3cret", time.Now().Add(-time.Hour)), "s3cret", 0)
+	require.NoError(t, err)
+}
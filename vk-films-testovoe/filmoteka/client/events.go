@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+	// события после lastEventID уже удалены на сервере, каталог нужно перечитать целиком
+	EventReset = "reset"
+)
+
+// Event - изменение фильма или человека из ленты /events. Entity - film или person
+type Event struct {
+	Id        int    `json:"id"`
+	Type      string `json:"type"`
+	Entity    string `json:"entity"`
+	EntityId  int    `json:"entityId"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Events читает ленту изменений и передаёт события в fn, пока не отменён ctx или fn не вернёт ошибку.
+// lastEventID > 0 продолжает после этого события, 0 - с новых событий.
+// После обрыва соединения поток открывается снова с последнего полученного события,
+// поэтому, чтобы продолжить после перезапуска, достаточно сохранять Event.Id.
+func (c *Client) Events(ctx context.Context, lastEventID int, fn func(Event) error) error {
+	for {
+		query := url.Values{}
+		setInt(query, "lastEventId", lastEventID)
+
+		resp, err := c.send(ctx, http.MethodGet, "/events", query, "", noBody)
+		if err != nil {
+			return err
+		}
+
+		err = readEvents(resp.Body, &lastEventID, fn)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		// соединение оборвалось или сервер закрыл поток
+		timer := time.NewTimer(c.retry.Backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// readEvents разбирает поток text/event-stream до его конца и обновляет lastEventID.
+// Возвращает только ошибки fn и разбора данных, обрыв чтения - не ошибка.
+func readEvents(body io.Reader, lastEventID *int, fn func(Event) error) error {
+	scanner := bufio.NewScanner(body)
+	var id, name, data string
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			name = value
+		case "data":
+			if data != "" {
+				data += "\n"
+			}
+			data += value
+		case "":
+			// пустая строка завершает событие, строка с ":" в начале - комментарий
+			if line != "" {
+				continue
+			}
+			if data == "" {
+				id, name = "", ""
+				continue
+			}
+
+			var event Event
+			if name == EventReset {
+				event.Type = EventReset
+			} else if err := json.Unmarshal([]byte(data), &event); err != nil {
+				return err
+			}
+			if n, err := strconv.Atoi(id); err == nil {
+				event.Id = n
+				*lastEventID = n
+			}
+			id, name, data = "", "", ""
+
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// FilmFilter - параметры списка фильмов, пустые поля не учитываются
+type FilmFilter struct {
+	// title, rating, release_date или score
+	Sort string
+	Desc bool
+	// название жанра
+	Genre string
+	// даты выхода yyyy, yyyy-mm или yyyy-mm-dd включительно
+	ReleasedFrom string
+	ReleasedTo   string
+	// только фильмы из корзины, нужно право write
+	Deleted bool
+}
+
+func (c *Client) ListFilms(ctx context.Context, filter FilmFilter) ([]Film, error) {
+	query := url.Values{}
+	setString(query, "sort", filter.Sort)
+	if filter.Desc {
+		query.Set("order", "desc")
+	}
+	setString(query, "genre", filter.Genre)
+	setString(query, "released_from", filter.ReleasedFrom)
+	setString(query, "released_to", filter.ReleasedTo)
+	setBool(query, "deleted", filter.Deleted)
+
+	var films []Film
+	err := c.do(ctx, http.MethodGet, "/films", query, nil, &films)
+	return films, err
+}
+
+// GetFilm возвращает фильм, по ID слитого дубля - оставшуюся запись
+func (c *Client) GetFilm(ctx context.Context, id int) (*Film, error) {
+	var film Film
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/films/%d", id), nil, nil, &film)
+	if err != nil {
+		return nil, err
+	}
+	return &film, nil
+}
+
+// CreateFilm добавляет фильм, с createMissing неизвестные актёры и жанры создаются
+func (c *Client) CreateFilm(ctx context.Context, film Film, createMissing bool) error {
+	query := url.Values{}
+	setBool(query, "createMissing", createMissing)
+	return c.do(ctx, http.MethodPost, "/films", query, film.writable(), nil)
+}
+
+func (c *Client) UpdateFilm(ctx context.Context, id int, film Film, createMissing bool) error {
+	query := url.Values{}
+	setBool(query, "createMissing", createMissing)
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/films/%d", id), query, film.writable(), nil)
+}
+
+// DeleteFilm переносит фильм в корзину
+func (c *Client) DeleteFilm(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/films/%d", id), nil, nil, nil)
+}
+
+func (c *Client) RestoreFilm(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/films/%d/restore", id), nil, nil, nil)
+}
+
+// MergeFilm сливает дубль mergeId в фильм id, policy - MergeKeep, MergeFill или MergeTake
+func (c *Client) MergeFilm(ctx context.Context, id, mergeId int, policy string) (*Film, error) {
+	var film Film
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/films/%d/merge", id), nil, mergeRequest{MergeId: mergeId, Policy: policy}, &film)
+	if err != nil {
+		return nil, err
+	}
+	return &film, nil
+}
+
+func (c *Client) FilmRevisions(ctx context.Context, id int) ([]Revision, error) {
+	var revisions []Revision
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/films/%d/revisions", id), nil, nil, &revisions)
+	return revisions, err
+}
+
+// FilmRevisionDiff - отличия версии from от версии to, при to = 0 - от текущей записи
+func (c *Client) FilmRevisionDiff(ctx context.Context, id, from, to int) ([]FieldChange, error) {
+	var changes []FieldChange
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/films/%d/revisions/diff", id), revisionRange(from, to), nil, &changes)
+	return changes, err
+}
+
+func (c *Client) RevertFilm(ctx context.Context, id, number int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/films/%d/revisions/%d/revert", id, number), nil, nil, nil)
+}
+
+// AddCastMember добавляет актёра в состав или меняет его роль и позицию, позиция 0 - в конец списка
+func (c *Client) AddCastMember(ctx context.Context, filmId, actorId int, member CastMember) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/films/%d/cast/%d", filmId, actorId), nil, member, nil)
+}
+
+func (c *Client) RemoveCastMember(ctx context.Context, filmId, actorId int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/films/%d/cast/%d", filmId, actorId), nil, nil, nil)
+}
+
+type myRating struct {
+	Rating int `json:"rating"`
+}
+
+// MyRating возвращает оценку фильма текущим пользователем, ErrNotFound - если её нет
+func (c *Client) MyRating(ctx context.Context, filmId int) (int, error) {
+	var rating myRating
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/films/%d/my-rating", filmId), nil, nil, &rating)
+	return rating.Rating, err
+}
+
+// RateFilm ставит или меняет оценку от 1 до 10
+func (c *Client) RateFilm(ctx context.Context, filmId, rating int) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/films/%d/my-rating", filmId), nil, myRating{Rating: rating}, nil)
+}
+
+func (c *Client) DeleteMyRating(ctx context.Context, filmId int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/films/%d/my-rating", filmId), nil, nil, nil)
+}
+
+type mergeRequest struct {
+	MergeId int    `json:"mergeId"`
+	Policy  string `json:"policy,omitempty"`
+}
+
+func revisionRange(from, to int) url.Values {
+	query := url.Values{}
+	setInt(query, "from", from)
+	setInt(query, "to", to)
+	return query
+}
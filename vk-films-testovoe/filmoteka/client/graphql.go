@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// GraphQLError - ошибка выполнения запроса GraphQL
+type GraphQLError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// GraphQLErrors возвращается, если в ответе есть ошибки, data при этом всё равно разбирается в out
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+// GraphQL выполняет запрос к /graphql и разбирает поле data в out
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]any, out any) error {
+	var resp graphQLResponse
+	err := c.do(ctx, http.MethodPost, "/graphql", nil, graphQLRequest{Query: query, Variables: variables}, &resp)
+	if err != nil {
+		return err
+	}
+
+	if out != nil && len(resp.Data) > 0 && string(resp.Data) != "null" {
+		err = json.Unmarshal(resp.Data, out)
+		if err != nil {
+			return err
+		}
+	}
+	if len(resp.Errors) > 0 {
+		return resp.Errors
+	}
+	return nil
+}
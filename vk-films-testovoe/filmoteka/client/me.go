@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ListEntry - заметка к фильму в личном списке и дата просмотра (dd.mm.yyyy)
+type ListEntry struct {
+	Note      string `json:"note,omitempty"`
+	WatchedAt string `json:"watchedAt,omitempty"`
+}
+
+// Watchlist - список "буду смотреть" текущего пользователя
+func (c *Client) Watchlist(ctx context.Context) ([]WatchlistEntry, error) {
+	var entries []WatchlistEntry
+	err := c.do(ctx, http.MethodGet, "/me/watchlist", nil, nil, &entries)
+	return entries, err
+}
+
+// AddToWatchlist добавляет фильм в список или меняет заметку
+func (c *Client) AddToWatchlist(ctx context.Context, filmId int, note string) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/me/watchlist/%d", filmId), nil, ListEntry{Note: note}, nil)
+}
+
+func (c *Client) RemoveFromWatchlist(ctx context.Context, filmId int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/me/watchlist/%d", filmId), nil, nil, nil)
+}
+
+// Watched - история просмотров текущего пользователя
+func (c *Client) Watched(ctx context.Context) ([]WatchedEntry, error) {
+	var entries []WatchedEntry
+	err := c.do(ctx, http.MethodGet, "/me/watched", nil, nil, &entries)
+	return entries, err
+}
+
+// MarkWatched отмечает фильм просмотренным и убирает его из списка "буду смотреть",
+// без entry.WatchedAt используется текущая дата
+func (c *Client) MarkWatched(ctx context.Context, filmId int, entry ListEntry) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/me/watched/%d", filmId), nil, entry, nil)
+}
+
+func (c *Client) UnmarkWatched(ctx context.Context, filmId int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/me/watched/%d", filmId), nil, nil, nil)
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ReviewFilter - страница рецензий, Status учитывается только для модераторов
+type ReviewFilter struct {
+	Page   int
+	Limit  int
+	Status string
+}
+
+func (c *Client) ListReviews(ctx context.Context, filmId int, filter ReviewFilter) (*ReviewPage, error) {
+	query := url.Values{}
+	setInt(query, "page", filter.Page)
+	setInt(query, "limit", filter.Limit)
+	setString(query, "status", filter.Status)
+
+	var page ReviewPage
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/films/%d/reviews", filmId), query, nil, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) GetReview(ctx context.Context, id int) (*Review, error) {
+	var review Review
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/reviews/%d", id), nil, nil, &review)
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+type reviewText struct {
+	Text string `json:"text"`
+}
+
+// CreateReview пишет рецензию на фильм, она попадает на модерацию
+func (c *Client) CreateReview(ctx context.Context, filmId int, text string) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/films/%d/reviews", filmId), nil, reviewText{Text: text}, nil)
+}
+
+// UpdateReview меняет текст своей рецензии, она снова попадает на модерацию
+func (c *Client) UpdateReview(ctx context.Context, id int, text string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/reviews/%d", id), nil, reviewText{Text: text}, nil)
+}
+
+func (c *Client) DeleteReview(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/reviews/%d", id), nil, nil, nil)
+}
+
+type reviewStatus struct {
+	Status string `json:"status"`
+}
+
+// SetReviewStatus меняет статус модерации, нужно право moderate
+func (c *Client) SetReviewStatus(ctx context.Context, id int, status string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/reviews/%d/status", id), nil, reviewStatus{Status: status}, nil)
+}
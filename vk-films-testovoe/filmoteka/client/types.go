@@ -0,0 +1,207 @@
+package client
+
+import "encoding/json"
+
+// Поля только для чтения (оценки пользователей, отметки списков, дата удаления) сервер
+// не принимает, методы записи очищают их, так что полученную запись можно изменить и отправить обратно.
+
+type Ref struct {
+	Id   int    `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type Film struct {
+	Id           int        `json:"id,omitempty"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	CriticRating int        `json:"criticRating"`
+	ReleaseDate  string     `json:"releaseDate"`
+	Actors       []Ref      `json:"actors"`
+	Genres       []string   `json:"genres"`
+	Credits      []Credit   `json:"credits"`
+	UserScore    *FilmScore `json:"userScore,omitempty"`
+	InWatchlist  bool       `json:"inWatchlist,omitempty"`
+	Watched      bool       `json:"watched,omitempty"`
+	DeletedAt    string     `json:"deletedAt,omitempty"`
+}
+
+func (f Film) writable() Film {
+	f.UserScore, f.InWatchlist, f.Watched, f.DeletedAt = nil, false, false, ""
+	return f
+}
+
+type FilmScore struct {
+	Average   float64 `json:"average"`
+	Votes     int     `json:"votes"`
+	Histogram [10]int `json:"histogram"`
+}
+
+type Actor struct {
+	Id        int    `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Gender    string `json:"gender"`
+	BirthDate string `json:"birthdate"`
+	Films     []Ref  `json:"films"`
+	DeletedAt string `json:"deletedAt,omitempty"`
+}
+
+func (a Actor) writable() Actor {
+	a.DeletedAt = ""
+	return a
+}
+
+type Person struct {
+	Id        int      `json:"id,omitempty"`
+	Name      string   `json:"name"`
+	Gender    string   `json:"gender"`
+	BirthDate string   `json:"birthdate"`
+	Credits   []Credit `json:"credits"`
+}
+
+type Credit struct {
+	PersonId  int    `json:"personId,omitempty"`
+	Name      string `json:"name,omitempty"`
+	FilmId    int    `json:"filmId,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Role      string `json:"role"`
+	Character string `json:"character,omitempty"`
+	Job       string `json:"job,omitempty"`
+	Position  int    `json:"position"`
+}
+
+type Genre struct {
+	Id         int    `json:"id,omitempty"`
+	Name       string `json:"name"`
+	FilmsCount int    `json:"filmsCount,omitempty"`
+}
+
+type CastMember struct {
+	Character string `json:"character"`
+	Position  int    `json:"position"`
+}
+
+type Review struct {
+	Id        int    `json:"id"`
+	FilmId    int    `json:"filmId"`
+	Login     string `json:"login"`
+	Text      string `json:"text"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type ReviewPage struct {
+	Reviews []Review `json:"reviews"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+	Total   int      `json:"total"`
+}
+
+// Статусы модерации рецензий
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+type WatchlistEntry struct {
+	Film    Ref    `json:"film"`
+	Note    string `json:"note"`
+	AddedAt string `json:"addedAt"`
+}
+
+type WatchedEntry struct {
+	Film      Ref    `json:"film"`
+	Note      string `json:"note"`
+	WatchedAt string `json:"watchedAt"`
+}
+
+type Revision struct {
+	Number     int             `json:"number"`
+	ReplacedBy string          `json:"replacedBy"`
+	ReplacedAt string          `json:"replacedAt"`
+	Snapshot   json.RawMessage `json:"snapshot"`
+	Changes    []FieldChange   `json:"changes"`
+}
+
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Политики слияния дублей: keep - поля остаются как есть, fill - пустые заполняются из дубля,
+// take - берутся из дубля
+const (
+	MergeKeep = "keep"
+	MergeFill = "fill"
+	MergeTake = "take"
+)
+
+type AuditEntry struct {
+	Id         int             `json:"id"`
+	Principal  string          `json:"principal"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entityType"`
+	EntityId   int             `json:"entityId"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  string          `json:"createdAt"`
+}
+
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Page    int          `json:"page"`
+	Limit   int          `json:"limit"`
+	Total   int          `json:"total"`
+}
+
+type ImportRow struct {
+	Line   int    `json:"line"`
+	Status string `json:"status"`
+	Id     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun    bool        `json:"dryRun"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Skipped   int         `json:"skipped"`
+	Failed    int         `json:"failed"`
+	Committed int         `json:"committed"`
+	Rows      []ImportRow `json:"rows"`
+	Stopped   *ImportRow  `json:"stopped,omitempty"`
+}
+
+type BackupInfo struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type DuplicateJob struct {
+	Id         int             `json:"id"`
+	Kinds      []string        `json:"kinds"`
+	Threshold  float64         `json:"threshold"`
+	Status     string          `json:"status"`
+	Progress   JobProgress     `json:"progress"`
+	StartedAt  string          `json:"startedAt"`
+	FinishedAt string          `json:"finishedAt,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Pairs      []DuplicatePair `json:"pairs,omitempty"`
+}
+
+type JobProgress struct {
+	Stage string `json:"stage"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+}
+
+type DuplicatePair struct {
+	Kind     string  `json:"kind"`
+	First    Ref     `json:"first"`
+	Second   Ref     `json:"second"`
+	Score    float64 `json:"score"`
+	Distance int     `json:"distance"`
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// заголовки доставки webhook
+const (
+	WebhookEventHeader     = "X-Filmoteka-Event"
+	WebhookDeliveryHeader  = "X-Filmoteka-Delivery"
+	WebhookTimestampHeader = "X-Filmoteka-Timestamp"
+	WebhookSignatureHeader = "X-Filmoteka-Signature"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// ErrWebhookSignature - подпись доставки не совпала с секретом или доставка слишком старая
+var ErrWebhookSignature = errors.New("wrong webhook signature")
+
+// Webhook - подписка на события ленты. Events - типы вида film.created или person.deleted.
+// Secret сервер возвращает только при создании, Active false - подписка выключена.
+type Webhook struct {
+	Id        int      `json:"id,omitempty"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	Active    bool     `json:"active"`
+	CreatedAt string   `json:"createdAt,omitempty"`
+}
+
+func (w Webhook) writable() Webhook {
+	w.Id, w.CreatedAt = 0, ""
+	return w
+}
+
+type Delivery struct {
+	Id            int               `json:"id"`
+	WebhookId     int               `json:"webhookId"`
+	EventId       int               `json:"eventId"`
+	Event         string            `json:"event"`
+	Payload       Event             `json:"payload"`
+	Status        string            `json:"status"`
+	Attempts      int               `json:"attempts"`
+	NextAttemptAt string            `json:"nextAttemptAt,omitempty"`
+	LastError     string            `json:"lastError,omitempty"`
+	CreatedAt     string            `json:"createdAt"`
+	DeliveredAt   string            `json:"deliveredAt,omitempty"`
+	Log           []DeliveryAttempt `json:"log"`
+}
+
+// DeliveryAttempt - попытка доставки, StatusCode 0 - ответа не было
+type DeliveryAttempt struct {
+	StatusCode  int    `json:"statusCode"`
+	Error       string `json:"error,omitempty"`
+	DurationMs  int    `json:"durationMs"`
+	AttemptedAt string `json:"attemptedAt"`
+}
+
+type DeliveryPage struct {
+	Deliveries []Delivery `json:"deliveries"`
+	Page       int        `json:"page"`
+	Limit      int        `json:"limit"`
+	Total      int        `json:"total"`
+}
+
+// ListWebhooks возвращает подписки без секретов, нужно право webhooks
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := c.do(ctx, http.MethodGet, "/webhooks", nil, nil, &webhooks)
+	return webhooks, err
+}
+
+func (c *Client) GetWebhook(ctx context.Context, id int) (*Webhook, error) {
+	var webhook Webhook
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/webhooks/%d", id), nil, nil, &webhook)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// CreateWebhook создаёт подписку и возвращает её вместе с секретом: пустой Secret сервер генерирует сам
+func (c *Client) CreateWebhook(ctx context.Context, webhook Webhook) (*Webhook, error) {
+	var created Webhook
+	err := c.do(ctx, http.MethodPost, "/webhooks", nil, webhook.writable(), &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateWebhook заменяет подписку, пустой Secret оставляет прежний
+func (c *Client) UpdateWebhook(ctx context.Context, id int, webhook Webhook) (*Webhook, error) {
+	var updated Webhook
+	err := c.do(ctx, http.MethodPut, fmt.Sprintf("/webhooks/%d", id), nil, webhook.writable(), &updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteWebhook удаляет подписку вместе с очередью и журналом доставок
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/webhooks/%d", id), nil, nil, nil)
+}
+
+// WebhookDeliveries читает журнал доставок подписки, новые первыми. Пустой status - в любом состоянии
+func (c *Client) WebhookDeliveries(ctx context.Context, id int, status string, page, limit int) (*DeliveryPage, error) {
+	query := url.Values{}
+	setString(query, "status", status)
+	setInt(query, "page", page)
+	setInt(query, "limit", limit)
+
+	var deliveries DeliveryPage
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", id), query, nil, &deliveries)
+	if err != nil {
+		return nil, err
+	}
+	return &deliveries, nil
+}
+
+// RetryDelivery возвращает доставку из dead в очередь, ErrNotFound - если она не в dead
+func (c *Client) RetryDelivery(ctx context.Context, id, deliveryId int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/webhooks/%d/deliveries/%d/retry", id, deliveryId), nil, nil, nil)
+}
+
+// VerifyWebhook проверяет подпись доставки на стороне получателя и возвращает событие из тела.
+// Доставка, отправленная раньше чем tolerance назад, отклоняется, tolerance 0 - без проверки времени.
+// Одна доставка может прийти повторно, её ID - в заголовке X-Filmoteka-Delivery.
+func VerifyWebhook(r *http.Request, secret string, tolerance time.Duration) (Event, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Event{}, err
+	}
+
+	timestamp := r.Header.Get(WebhookTimestampHeader)
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Event{}, ErrWebhookSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(sent, 0)) > tolerance {
+		return Event{}, ErrWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(WebhookSignatureHeader))) {
+		return Event{}, ErrWebhookSignature
+	}
+
+	var event Event
+	err = json.Unmarshal(body, &event)
+	return event, err
+}
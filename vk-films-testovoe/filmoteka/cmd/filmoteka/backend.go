@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"vk-testovoe/filmoteka/app"
+	"vk-testovoe/filmoteka/client"
+	"vk-testovoe/filmoteka/storage"
+)
+
+// backend - операции с каталогом, которые умеют и база, и HTTP API.
+// *client.Client реализует его как есть, localBackend - поверх хранилища.
+type backend interface {
+	ListFilms(ctx context.Context, filter client.FilmFilter) ([]client.Film, error)
+	GetFilm(ctx context.Context, id int) (*client.Film, error)
+	CreateFilm(ctx context.Context, film client.Film, createMissing bool) error
+	UpdateFilm(ctx context.Context, id int, film client.Film, createMissing bool) error
+	DeleteFilm(ctx context.Context, id int) error
+
+	ListActors(ctx context.Context, deleted bool) ([]client.Actor, error)
+	GetActor(ctx context.Context, id int) (*client.Actor, error)
+	CreateActor(ctx context.Context, actor client.Actor, createMissing bool) error
+	UpdateActor(ctx context.Context, id int, actor client.Actor, createMissing bool) error
+	DeleteActor(ctx context.Context, id int) error
+
+	Import(ctx context.Context, data io.Reader, opts client.ImportOptions) (*client.ImportReport, error)
+	Export(ctx context.Context, format string, w io.Writer) error
+}
+
+// localBackend работает с базой напрямую, изменения пишутся в журнал от имени system.
+// Проверки те же, что у обработчиков HTTP API.
+type localBackend struct {
+	log *slog.Logger
+	s   *sqlite.Storage
+}
+
+func (b *localBackend) ListFilms(ctx context.Context, filter client.FilmFilter) ([]client.Film, error) {
+	f := sqlite.FilmFilter{
+		Sort:    filter.Sort,
+		Desc:    filter.Desc,
+		Genre:   filter.Genre,
+		Deleted: filter.Deleted,
+	}
+	if f.Sort != "" && !sqlite.ValidFilmSort(f.Sort) {
+		return nil, fmt.Errorf("wrong sort %q", f.Sort)
+	}
+
+	var err error
+	f.ReleasedFrom, err = normalizeBound(filter.ReleasedFrom)
+	if err != nil {
+		return nil, err
+	}
+	f.ReleasedTo, err = normalizeBound(filter.ReleasedTo)
+	if err != nil {
+		return nil, err
+	}
+
+	films, err := sqlite.GetAllFilmsFromStorage(b.s, b.log, f)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []client.Film
+	err = convert(films, &res)
+	return res, err
+}
+
+func (b *localBackend) GetFilm(ctx context.Context, id int) (*client.Film, error) {
+	film, err := sqlite.GetOneFilmFromStorage(b.s, id)
+	if err != nil {
+		return nil, notFound("film", id, err)
+	}
+
+	var res client.Film
+	return &res, convert(film, &res)
+}
+
+func (b *localBackend) CreateFilm(ctx context.Context, film client.Film, createMissing bool) error {
+	var f sqlite.Film
+	if err := convert(film, &f); err != nil {
+		return err
+	}
+	if err := app.ValidateFilm(f); err != nil {
+		return err
+	}
+	return sqlite.PostFilmToStorage(b.s, f, createMissing)
+}
+
+func (b *localBackend) UpdateFilm(ctx context.Context, id int, film client.Film, createMissing bool) error {
+	var f sqlite.Film
+	if err := convert(film, &f); err != nil {
+		return err
+	}
+	f.FilmId = id
+	if err := app.ValidateFilm(f); err != nil {
+		return err
+	}
+	return notFound("film", id, sqlite.UpdateFilm(b.s, f, createMissing))
+}
+
+func (b *localBackend) DeleteFilm(ctx context.Context, id int) error {
+	return notFound("film", id, sqlite.DeleteFilm(b.s, id))
+}
+
+func (b *localBackend) ListActors(ctx context.Context, deleted bool) ([]client.Actor, error) {
+	actors, err := sqlite.GetAllActorsFromStorage(b.s, b.log, deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []client.Actor
+	err = convert(actors, &res)
+	return res, err
+}
+
+func (b *localBackend) GetActor(ctx context.Context, id int) (*client.Actor, error) {
+	actor, err := sqlite.GetOneActorFromStorage(b.s, id, b.log)
+	if err != nil {
+		return nil, notFound("actor", id, err)
+	}
+
+	var res client.Actor
+	return &res, convert(actor, &res)
+}
+
+func (b *localBackend) CreateActor(ctx context.Context, actor client.Actor, createMissing bool) error {
+	var a sqlite.Actor
+	if err := convert(actor, &a); err != nil {
+		return err
+	}
+	if err := app.ValidateActor(a); err != nil {
+		return err
+	}
+	return sqlite.PostActorToStorage(b.s, a, createMissing)
+}
+
+func (b *localBackend) UpdateActor(ctx context.Context, id int, actor client.Actor, createMissing bool) error {
+	var a sqlite.Actor
+	if err := convert(actor, &a); err != nil {
+		return err
+	}
+	a.ActorId = id
+	if err := app.ValidateActor(a); err != nil {
+		return err
+	}
+	return notFound("actor", id, sqlite.UpdateActor(b.s, a, createMissing))
+}
+
+func (b *localBackend) DeleteActor(ctx context.Context, id int) error {
+	return notFound("actor", id, sqlite.DeleteActor(b.s, id))
+}
+
+func (b *localBackend) Import(ctx context.Context, data io.Reader, opts client.ImportOptions) (*client.ImportReport, error) {
+	if opts.Format == "" {
+		opts.Format = app.FormatCSV
+	}
+	if opts.OnConflict == "" {
+		opts.OnConflict = app.ConflictSkip
+	}
+
+	report, err := app.Import(b.s, data, app.ImportOptions{
+		Kind:          opts.Kind,
+		Format:        opts.Format,
+		DryRun:        opts.DryRun,
+		OnConflict:    opts.OnConflict,
+		CreateMissing: opts.CreateMissing,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res client.ImportReport
+	return &res, convert(report, &res)
+}
+
+func (b *localBackend) Export(ctx context.Context, format string, w io.Writer) error {
+	if format == "" {
+		format = app.FormatJSONL
+	}
+	return app.Export(b.s, w, format)
+}
+
+// пустая граница даты не ограничивает выборку
+func normalizeBound(date string) (string, error) {
+	if date == "" {
+		return "", nil
+	}
+	return sqlite.NormalizeDate(date)
+}
+
+// convert перекладывает запись хранилища в тип клиента и обратно: JSON у них совпадает
+func convert(from, to any) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
+
+// notFound приводит отсутствие записи к той же ошибке, что и у HTTP API
+func notFound(entity string, id int, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s %d: %w", entity, id, client.ErrNotFound)
+	}
+	return err
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"vk-testovoe/filmoteka/client"
+
+	"github.com/spf13/cobra"
+)
+
+var filmColumns = []column[client.Film]{
+	{"ID", func(f client.Film) string { return strconv.Itoa(f.Id) }},
+	{"TITLE", func(f client.Film) string { return f.Title }},
+	{"RELEASED", func(f client.Film) string { return f.ReleaseDate }},
+	{"RATING", func(f client.Film) string { return strconv.Itoa(f.CriticRating) }},
+	{"SCORE", func(f client.Film) string {
+		if f.UserScore == nil || f.UserScore.Votes == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f (%d)", f.UserScore.Average, f.UserScore.Votes)
+	}},
+	{"GENRES", func(f client.Film) string { return strings.Join(f.Genres, ", ") }},
+}
+
+var actorColumns = []column[client.Actor]{
+	{"ID", func(a client.Actor) string { return strconv.Itoa(a.Id) }},
+	{"NAME", func(a client.Actor) string { return a.Name }},
+	{"GENDER", func(a client.Actor) string { return a.Gender }},
+	{"BIRTHDATE", func(a client.Actor) string { return a.BirthDate }},
+	{"FILMS", func(a client.Actor) string { return strconv.Itoa(len(a.Films)) }},
+}
+
+func newFilmCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "film",
+		Short: "List and edit films",
+	}
+
+	var filter client.FilmFilter
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List films",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			films, err := b.ListFilms(cmd.Context(), filter)
+			if err != nil {
+				return err
+			}
+			return render(cmd.OutOrStdout(), o.output, films, films, filmColumns)
+		},
+	}
+	list.Flags().StringVar(&filter.Sort, "sort", "", "title, rating, release_date or score")
+	list.Flags().BoolVar(&filter.Desc, "desc", false, "sort in descending order")
+	list.Flags().StringVar(&filter.Genre, "genre", "", "only films of the genre")
+	list.Flags().StringVar(&filter.ReleasedFrom, "released-from", "", "released not before yyyy, yyyy-mm or yyyy-mm-dd")
+	list.Flags().StringVar(&filter.ReleasedTo, "released-to", "", "released not after yyyy, yyyy-mm or yyyy-mm-dd")
+	list.Flags().BoolVar(&filter.Deleted, "deleted", false, "list films in the trash")
+	list.RegisterFlagCompletionFunc("sort", fixedCompletion("title", "rating", "release_date", "score"))
+
+	get := &cobra.Command{
+		Use:   "get ID",
+		Short: "Show a film",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			film, err := b.GetFilm(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			return render(cmd.OutOrStdout(), o.output, film, []client.Film{*film}, filmColumns)
+		},
+	}
+
+	var fields filmFields
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Add a film from flags or a JSON file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var film client.Film
+			if err := fields.apply(cmd, &film); err != nil {
+				return err
+			}
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			if err = b.CreateFilm(cmd.Context(), film, fields.createMissing); err != nil {
+				return err
+			}
+			cmd.PrintErrln("film created")
+			return nil
+		},
+	}
+	fields.register(create)
+
+	var updateFields filmFields
+	update := &cobra.Command{
+		Use:   "update ID",
+		Short: "Change a film, fields without flags stay as they are",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			film, err := b.GetFilm(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			if err = updateFields.apply(cmd, film); err != nil {
+				return err
+			}
+			if err = b.UpdateFilm(cmd.Context(), id, *film, updateFields.createMissing); err != nil {
+				return err
+			}
+			cmd.PrintErrln("film updated")
+			return nil
+		},
+	}
+	updateFields.register(update)
+
+	del := &cobra.Command{
+		Use:   "delete ID",
+		Short: "Move a film to the trash",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			if err = b.DeleteFilm(cmd.Context(), id); err != nil {
+				return err
+			}
+			cmd.PrintErrln("film deleted")
+			return nil
+		},
+	}
+
+	cmd.AddCommand(list, get, create, update, del)
+	return cmd
+}
+
+// filmFields - флаги полей фильма для create и update
+type filmFields struct {
+	file          string
+	title         string
+	description   string
+	rating        int
+	released      string
+	actors        []string
+	genres        []string
+	createMissing bool
+}
+
+func (f *filmFields) register(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.file, "file", "f", "", `JSON file with the film, "-" for stdin`)
+	cmd.Flags().StringVar(&f.title, "title", "", "title")
+	cmd.Flags().StringVar(&f.description, "description", "", "description")
+	cmd.Flags().IntVar(&f.rating, "rating", 0, "critic rating from 0 to 10")
+	cmd.Flags().StringVar(&f.released, "released", "", "release date yyyy, yyyy-mm or yyyy-mm-dd")
+	cmd.Flags().StringArrayVar(&f.actors, "actor", nil, `actor name or "#id", can be repeated`)
+	cmd.Flags().StringArrayVar(&f.genres, "genre", nil, "genre, can be repeated")
+	cmd.Flags().BoolVar(&f.createMissing, "create-missing", false, "create actors that are not found")
+	cmd.MarkFlagsMutuallyExclusive("file", "title")
+	cmd.MarkFlagFilename("file", "json")
+}
+
+// apply заполняет film из файла или из заданных флагов, остальные поля не меняются
+func (f *filmFields) apply(cmd *cobra.Command, film *client.Film) error {
+	if f.file != "" {
+		return readJSON(cmd, f.file, film)
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("title") {
+		film.Title = f.title
+	}
+	if flags.Changed("description") {
+		film.Description = f.description
+	}
+	if flags.Changed("rating") {
+		film.CriticRating = f.rating
+	}
+	if flags.Changed("released") {
+		film.ReleaseDate = f.released
+	}
+	if flags.Changed("actor") {
+		film.Actors = parseRefs(f.actors)
+	}
+	if flags.Changed("genre") {
+		film.Genres = f.genres
+	}
+	return nil
+}
+
+func newActorCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "actor",
+		Short: "List and edit actors",
+	}
+
+	var deleted bool
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List actors",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			actors, err := b.ListActors(cmd.Context(), deleted)
+			if err != nil {
+				return err
+			}
+			return render(cmd.OutOrStdout(), o.output, actors, actors, actorColumns)
+		},
+	}
+	list.Flags().BoolVar(&deleted, "deleted", false, "list actors in the trash")
+
+	get := &cobra.Command{
+		Use:   "get ID",
+		Short: "Show an actor",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			actor, err := b.GetActor(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			return render(cmd.OutOrStdout(), o.output, actor, []client.Actor{*actor}, actorColumns)
+		},
+	}
+
+	var fields actorFields
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Add an actor from flags or a JSON file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var actor client.Actor
+			if err := fields.apply(cmd, &actor); err != nil {
+				return err
+			}
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			if err = b.CreateActor(cmd.Context(), actor, fields.createMissing); err != nil {
+				return err
+			}
+			cmd.PrintErrln("actor created")
+			return nil
+		},
+	}
+	fields.register(create)
+
+	var updateFields actorFields
+	update := &cobra.Command{
+		Use:   "update ID",
+		Short: "Change an actor, fields without flags stay as they are",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			actor, err := b.GetActor(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			if err = updateFields.apply(cmd, actor); err != nil {
+				return err
+			}
+			if err = b.UpdateActor(cmd.Context(), id, *actor, updateFields.createMissing); err != nil {
+				return err
+			}
+			cmd.PrintErrln("actor updated")
+			return nil
+		},
+	}
+	updateFields.register(update)
+
+	del := &cobra.Command{
+		Use:   "delete ID",
+		Short: "Move an actor to the trash",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			if err = b.DeleteActor(cmd.Context(), id); err != nil {
+				return err
+			}
+			cmd.PrintErrln("actor deleted")
+			return nil
+		},
+	}
+
+	cmd.AddCommand(list, get, create, update, del)
+	return cmd
+}
+
+// actorFields - флаги полей актёра для create и update
+type actorFields struct {
+	file          string
+	name          string
+	gender        string
+	birthdate     string
+	films         []string
+	createMissing bool
+}
+
+func (f *actorFields) register(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.file, "file", "f", "", `JSON file with the actor, "-" for stdin`)
+	cmd.Flags().StringVar(&f.name, "name", "", "name")
+	cmd.Flags().StringVar(&f.gender, "gender", "", "male or female")
+	cmd.Flags().StringVar(&f.birthdate, "birthdate", "", "birth date yyyy, yyyy-mm or yyyy-mm-dd")
+	cmd.Flags().StringArrayVar(&f.films, "film", nil, `film title or "#id", can be repeated`)
+	cmd.Flags().BoolVar(&f.createMissing, "create-missing", false, "create films that are not found")
+	cmd.MarkFlagsMutuallyExclusive("file", "name")
+	cmd.MarkFlagFilename("file", "json")
+	cmd.RegisterFlagCompletionFunc("gender", fixedCompletion("male", "female"))
+}
+
+// apply заполняет actor из файла или из заданных флагов, остальные поля не меняются
+func (f *actorFields) apply(cmd *cobra.Command, actor *client.Actor) error {
+	if f.file != "" {
+		return readJSON(cmd, f.file, actor)
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("name") {
+		actor.Name = f.name
+	}
+	if flags.Changed("gender") {
+		actor.Gender = f.gender
+	}
+	if flags.Changed("birthdate") {
+		actor.BirthDate = f.birthdate
+	}
+	if flags.Changed("film") {
+		actor.Films = parseRefs(f.films)
+	}
+	return nil
+}
+
+func parseID(value string) (int, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("wrong id %q", value)
+	}
+	return id, nil
+}
+
+// parseRefs разбирает ссылки как в CSV импорта: "#12" задаёт id, иначе это имя или название
+func parseRefs(values []string) []client.Ref {
+	refs := []client.Ref{}
+	for _, value := range values {
+		id, err := strconv.Atoi(strings.TrimPrefix(value, "#"))
+		if strings.HasPrefix(value, "#") && err == nil {
+			refs = append(refs, client.Ref{Id: id})
+			continue
+		}
+		refs = append(refs, client.Ref{Name: value})
+	}
+	return refs
+}
+
+// readJSON читает запись из файла path, "-" - из stdin
+func readJSON(cmd *cobra.Command, path string, v any) error {
+	in := cmd.InOrStdin()
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	dec := json.NewDecoder(in)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
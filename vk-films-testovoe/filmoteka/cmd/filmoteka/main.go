@@ -0,0 +1,170 @@
+// filmoteka - консольная утилита администратора: каталог, пользователи, импорт и выгрузка, миграции.
+//
+// Без --remote команды работают напрямую с базой storage_path из конфига, с --remote - через HTTP API:
+//
+//	filmoteka film list --sort score --desc
+//	filmoteka --remote http://localhost:8080 --user Admin film get 1 -o yaml
+//	filmoteka user create alice --role admin < password.txt
+//	source <(filmoteka completion bash)
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+
+	"vk-testovoe/filmoteka/client"
+	"vk-testovoe/filmoteka/config"
+	"vk-testovoe/filmoteka/storage"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// options - общие флаги всех команд
+type options struct {
+	configPath  string
+	storagePath string
+	remote      string
+	user        string
+	password    string
+	token       string
+	output      string
+	verbose     bool
+}
+
+var errLocalOnly = errors.New("command works only with local storage, run it without --remote")
+
+func newRootCommand() *cobra.Command {
+	o := &options{}
+
+	root := &cobra.Command{
+		Use:   "filmoteka",
+		Short: "Filmoteka admin tool",
+		Long: `Filmoteka admin tool.
+
+Without --remote commands open the storage from the config directly (the server may keep running).
+With --remote they go through the HTTP API; credentials can also be set with
+FILMOTEKA_URL, FILMOTEKA_USER, FILMOTEKA_PASSWORD and FILMOTEKA_TOKEN.`,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			switch o.output {
+			case outputTable, outputJSON, outputYAML:
+				return nil
+			}
+			return errors.New("wrong output format, use table, json or yaml")
+		},
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&o.configPath, "config", "config.yaml", "path to the server config")
+	flags.StringVar(&o.storagePath, "storage", "", "path to the storage, storage_path from config if empty")
+	flags.StringVar(&o.remote, "remote", "", "server URL, work over HTTP API instead of local storage")
+	flags.StringVar(&o.user, "user", "", "login for --remote")
+	flags.StringVar(&o.password, "password", "", "password for --remote")
+	flags.StringVar(&o.token, "token", "", "bearer token for --remote instead of login and password")
+	flags.StringVarP(&o.output, "output", "o", outputTable, "output format: table, json or yaml")
+	flags.BoolVarP(&o.verbose, "verbose", "v", false, "print debug logs to stderr")
+
+	root.RegisterFlagCompletionFunc("output", fixedCompletion(outputTable, outputJSON, outputYAML))
+	root.MarkPersistentFlagFilename("config", "yaml", "yml")
+	root.MarkPersistentFlagFilename("storage", "db")
+
+	root.AddCommand(
+		newFilmCommand(o),
+		newActorCommand(o),
+		newUserCommand(o),
+		newImportCommand(o),
+		newExportCommand(o),
+		newMigrateCommand(o),
+	)
+
+	return root
+}
+
+func (o *options) logger() *slog.Logger {
+	level := slog.LevelWarn
+	if o.verbose {
+		level = slog.LevelDebug
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+func (o *options) isRemote() bool {
+	return o.remote != "" || os.Getenv("FILMOTEKA_URL") != ""
+}
+
+// localStoragePath - --storage или storage_path из конфига
+func (o *options) localStoragePath() (string, error) {
+	if o.storagePath != "" {
+		return o.storagePath, nil
+	}
+
+	cfg, err := config.Load(o.configPath)
+	if err != nil {
+		return "", err
+	}
+	return cfg.StoragePath, nil
+}
+
+// localStorage открывает базу напрямую, миграции при этом применяются
+func (o *options) localStorage() (*sqlite.Storage, error) {
+	if o.isRemote() {
+		return nil, errLocalOnly
+	}
+
+	path, err := o.localStoragePath()
+	if err != nil {
+		return nil, err
+	}
+	return sqlite.New(path, o.logger())
+}
+
+// backend - локальная база или HTTP API, смотря по --remote
+func (o *options) backend() (backend, error) {
+	if !o.isRemote() {
+		s, err := o.localStorage()
+		if err != nil {
+			return nil, err
+		}
+		return &localBackend{log: o.logger(), s: s}, nil
+	}
+
+	url := firstNonEmpty(o.remote, os.Getenv("FILMOTEKA_URL"))
+	token := firstNonEmpty(o.token, os.Getenv("FILMOTEKA_TOKEN"))
+	user := firstNonEmpty(o.user, os.Getenv("FILMOTEKA_USER"))
+	password := firstNonEmpty(o.password, os.Getenv("FILMOTEKA_PASSWORD"))
+
+	var auth client.Auth
+	switch {
+	case token != "":
+		auth = client.TokenAuth(token)
+	case user != "":
+		auth = client.BasicAuth(user, password)
+	default:
+		return nil, errors.New("set --user and --password or --token for --remote")
+	}
+
+	return client.New(url, client.WithAuth(auth)), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// fixedCompletion дополняет значение флага или аргумента из списка
+func fixedCompletion(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vk-testovoe/filmoteka/app"
+	"vk-testovoe/filmoteka/client"
+	"vk-testovoe/filmoteka/config"
+	"vk-testovoe/filmoteka/openapi"
+	"vk-testovoe/filmoteka/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// run выполняет команду и возвращает stdout
+func run(t *testing.T, stdin string, args ...string) (string, error) {
+	cmd := newRootCommand()
+	var out, errOut bytes.Buffer
+	cmd.SetArgs(args)
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestLocal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.db")
+
+	out, err := run(t, "", "--storage", path, "migrate", "-o", "json")
+	require.NoError(t, err)
+	var status migrateStatus
+	require.NoError(t, json.Unmarshal([]byte(out), &status))
+	require.Equal(t, sqlite.SchemaVersion(), status.Version)
+	require.Equal(t, sqlite.SchemaVersion(), status.Applied)
+
+	_, err = run(t, "", "--storage", path, "migrate", "--check")
+	require.NoError(t, err)
+
+	_, err = run(t, "", "--storage", path, "actor", "create", "--name", "Олег Янковский", "--gender", "male", "--birthdate", "1944-02-23")
+	require.NoError(t, err)
+	_, err = run(t, "", "--storage", path, "film", "create", "--title", "Полёты во сне и наяву", "--released", "1983",
+		"--actor", "#1", "--genre", "Драма", "--create-missing")
+	require.NoError(t, err)
+	_, err = run(t, "", "--storage", path, "film", "update", "1", "--rating", "10")
+	require.NoError(t, err)
+
+	out, err = run(t, "", "--storage", path, "film", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, "Полёты во сне и наяву  1983      10")
+
+	out, err = run(t, "", "--storage", path, "film", "get", "1", "-o", "yaml")
+	require.NoError(t, err)
+	require.Contains(t, out, "releaseDate: \"1983\"\n")
+	require.Contains(t, out, "genres:\n  - Драма\n")
+
+	_, err = run(t, "", "--storage", path, "film", "get", "2")
+	require.ErrorIs(t, err, client.ErrNotFound)
+
+	_, err = run(t, `{"title":"Курьер","releaseDate":"1986"}`, "--storage", path, "film", "create", "-f", "-")
+	require.NoError(t, err)
+	_, err = run(t, "", "--storage", path, "film", "delete", "2")
+	require.NoError(t, err)
+	out, err = run(t, "", "--storage", path, "film", "list", "--deleted", "-o", "json")
+	require.NoError(t, err)
+	require.Contains(t, out, `"title": "Курьер"`)
+
+	out, err = run(t, "name,gender,birthdate\nОлег Табаков,male,1935-08-17\nБезымянный,,\n", "--storage", path, "import", "--kind", "actors")
+	require.ErrorContains(t, err, "1 rows failed")
+	require.Contains(t, out, "created")
+
+	out, err = run(t, "", "--storage", path, "export")
+	require.NoError(t, err)
+	require.Contains(t, out, "Олег Табаков")
+
+	_, err = run(t, "secret\n", "--storage", path, "user", "create", "alice")
+	require.NoError(t, err)
+	_, err = run(t, "", "--storage", path, "user", "role", "alice", "admin")
+	require.NoError(t, err)
+	_, err = run(t, "", "--storage", path, "user", "passwd", "alice", "--new-password", "changed")
+	require.NoError(t, err)
+	_, err = run(t, "", "--storage", path, "user", "role", "alice", "root")
+	require.ErrorContains(t, err, "wrong role")
+
+	out, err = run(t, "", "--storage", path, "user", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, "alice  admin")
+
+	// новый пользователь с новой ролью сразу может входить в API
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	s, err := sqlite.New(path, log)
+	require.NoError(t, err)
+	srv := httptest.NewServer(app.Routes(log, s, &config.Config{}))
+	defer srv.Close()
+	require.NoError(t, client.New(srv.URL, client.WithAuth(client.BasicAuth("alice", "changed"))).DeleteFilm(context.Background(), 1))
+}
+
+func TestRemote(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	s, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	handler, err := app.NewHandler(log, s, &config.Config{}, openapi.Options{Requests: true, Responses: true, Strict: true}, nil)
+	require.NoError(t, err)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	remote := []string{"--remote", srv.URL, "--user", "Admin", "--password", "Admin"}
+
+	_, err = run(t, "", append(remote, "actor", "create", "--name", "Олег Янковский", "--gender", "male", "--birthdate", "1944")...)
+	require.NoError(t, err)
+	_, err = run(t, "", append(remote, "actor", "update", "1", "--birthdate", "1944-02-23")...)
+	require.NoError(t, err)
+
+	out, err := run(t, "", append(remote, "actor", "list", "-o", "json")...)
+	require.NoError(t, err)
+	var actors []client.Actor
+	require.NoError(t, json.Unmarshal([]byte(out), &actors))
+	require.Equal(t, "1944-02-23", actors[0].BirthDate)
+
+	_, err = run(t, "", append(remote, "actor", "get", "5")...)
+	require.ErrorIs(t, err, client.ErrNotFound)
+
+	_, err = run(t, "", "--remote", srv.URL, "--user", "User", "--password", "User", "actor", "delete", "1")
+	require.ErrorIs(t, err, client.ErrUnauthorized)
+
+	_, err = run(t, "", append(remote, "user", "list")...)
+	require.ErrorIs(t, err, errLocalOnly)
+}
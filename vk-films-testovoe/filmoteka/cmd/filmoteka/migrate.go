@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"vk-testovoe/filmoteka/storage"
+
+	"github.com/spf13/cobra"
+)
+
+type migrateStatus struct {
+	Path      string `json:"path"`
+	Version   int    `json:"version"`
+	Supported int    `json:"supported"`
+	Applied   int    `json:"applied"`
+}
+
+var migrateColumns = []column[migrateStatus]{
+	{"PATH", func(m migrateStatus) string { return m.Path }},
+	{"VERSION", func(m migrateStatus) string { return strconv.Itoa(m.Version) }},
+	{"SUPPORTED", func(m migrateStatus) string { return strconv.Itoa(m.Supported) }},
+	{"APPLIED", func(m migrateStatus) string { return strconv.Itoa(m.Applied) }},
+}
+
+func newMigrateCommand(o *options) *cobra.Command {
+	var check bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply storage migrations (local storage only)",
+		Long: `Apply storage migrations. The server applies them on start as well,
+migrate lets you do it ahead of a deploy. With --check nothing is changed
+and the command fails if migrations are pending.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.isRemote() {
+				return errLocalOnly
+			}
+			path, err := o.localStoragePath()
+			if err != nil {
+				return err
+			}
+
+			status := migrateStatus{Path: path, Supported: sqlite.SchemaVersion()}
+			if _, err = os.Stat(path); err == nil {
+				status.Version, err = sqlite.StorageVersion(path)
+				if err != nil {
+					return err
+				}
+			} else if !errors.Is(err, os.ErrNotExist) || check {
+				return err
+			}
+
+			if status.Version > status.Supported {
+				return fmt.Errorf("storage schema version %d is newer than supported %d", status.Version, status.Supported)
+			}
+
+			if check {
+				err = render(cmd.OutOrStdout(), o.output, status, []migrateStatus{status}, migrateColumns)
+				if err == nil && status.Version < status.Supported {
+					err = fmt.Errorf("%d migrations pending", status.Supported-status.Version)
+				}
+				return err
+			}
+
+			before := status.Version
+			if _, err = sqlite.New(path, o.logger()); err != nil {
+				return err
+			}
+			status.Version, err = sqlite.StorageVersion(path)
+			if err != nil {
+				return err
+			}
+			status.Applied = status.Version - before
+
+			return render(cmd.OutOrStdout(), o.output, status, []migrateStatus{status}, migrateColumns)
+		},
+	}
+
+	cmd.Flags().BoolVar(&check, "check", false, "only report the schema version, fail if migrations are pending")
+	return cmd
+}
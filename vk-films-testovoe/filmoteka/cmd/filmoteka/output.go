@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// column - столбец таблицы для записей типа T
+type column[T any] struct {
+	title string
+	value func(T) string
+}
+
+// render выводит data в формате --output. В JSON и YAML data выводится целиком,
+// в таблице - строки rows по столбцам cols.
+func render[T any](w io.Writer, format string, data any, rows []T, cols []column[T]) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case outputYAML:
+		return writeYAML(w, data)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	titles := make([]string, len(cols))
+	for i, c := range cols {
+		titles[i] = c.title
+	}
+	fmt.Fprintln(tw, strings.Join(titles, "\t"))
+
+	for _, row := range rows {
+		values := make([]string, len(cols))
+		for i, c := range cols {
+			values[i] = c.value(row)
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// writeYAML выводит v с ключами из json-тегов: JSON разбирается в дерево YAML,
+// которому сбрасывается однострочный стиль
+func writeYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	err = yaml.Unmarshal(data, &node)
+	if err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err = enc.Encode(&node)
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
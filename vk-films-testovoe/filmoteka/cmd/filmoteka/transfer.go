@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"vk-testovoe/filmoteka/client"
+
+	"github.com/spf13/cobra"
+)
+
+var importRowColumns = []column[client.ImportRow]{
+	{"LINE", func(r client.ImportRow) string { return strconv.Itoa(r.Line) }},
+	{"STATUS", func(r client.ImportRow) string { return r.Status }},
+	{"ID", func(r client.ImportRow) string {
+		if r.Id == 0 {
+			return ""
+		}
+		return strconv.Itoa(r.Id)
+	}},
+	{"ERROR", func(r client.ImportRow) string { return r.Error }},
+}
+
+func newImportCommand(o *options) *cobra.Command {
+	var opts client.ImportOptions
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import films or actors from CSV or JSON Lines",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if file != "" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+			report, err := b.Import(cmd.Context(), in, opts)
+			if err != nil {
+				return err
+			}
+
+			err = render(cmd.OutOrStdout(), o.output, report, report.Rows, importRowColumns)
+			if err != nil {
+				return err
+			}
+			cmd.PrintErrf("created %d, updated %d, skipped %d, failed %d\n", report.Created, report.Updated, report.Skipped, report.Failed)
+
+			if report.Failed > 0 {
+				return fmt.Errorf("%d rows failed", report.Failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Kind, "kind", "films", "films or actors")
+	cmd.Flags().StringVar(&opts.Format, "format", "csv", "csv or jsonl")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "path to the file, stdin if empty")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "check the file without saving")
+	cmd.Flags().StringVar(&opts.OnConflict, "on-conflict", "skip", "skip or update existing records")
+	cmd.Flags().BoolVar(&opts.CreateMissing, "create-missing", false, "create referenced actors and films that are not found")
+	cmd.RegisterFlagCompletionFunc("kind", fixedCompletion("films", "actors"))
+	cmd.RegisterFlagCompletionFunc("format", fixedCompletion("csv", "jsonl"))
+	cmd.RegisterFlagCompletionFunc("on-conflict", fixedCompletion("skip", "update"))
+	cmd.MarkFlagFilename("file", "csv", "jsonl")
+
+	return cmd
+}
+
+func newExportCommand(o *options) *cobra.Command {
+	var format, file string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the whole catalogue",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := o.backend()
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if file != "" {
+				f, err := os.Create(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+
+			return b.Export(cmd.Context(), format, out)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "jsonl", "jsonl, csv (zip archive) or sql")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "path to the output file, stdout if empty")
+	cmd.RegisterFlagCompletionFunc("format", fixedCompletion("jsonl", "csv", "sql"))
+
+	return cmd
+}
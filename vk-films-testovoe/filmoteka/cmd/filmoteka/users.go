@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+
+	"github.com/spf13/cobra"
+)
+
+var userColumns = []column[sqlite.User]{
+	{"LOGIN", func(u sqlite.User) string { return u.Login }},
+	{"ROLE", func(u sqlite.User) string { return u.Role }},
+}
+
+var roles = []string{verify.AdminRole, verify.UserRole}
+
+// у HTTP API нет методов для пользователей, поэтому команды user работают только с локальной базой
+func newUserCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage users and roles (local storage only)",
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List users with their roles",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.localStorage()
+			if err != nil {
+				return err
+			}
+			users, err := sqlite.ListUsers(s)
+			if err != nil {
+				return err
+			}
+			return render(cmd.OutOrStdout(), o.output, users, users, userColumns)
+		},
+	}
+
+	var role, password string
+	create := &cobra.Command{
+		Use:   "create LOGIN",
+		Short: "Add a user, the password is read from stdin without --new-password",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !verify.ValidRole(role) {
+				return fmt.Errorf("wrong role %q, use %s", role, strings.Join(roles, " or "))
+			}
+			if verify.IsKeyLogin(args[0]) {
+				return sqlite.ErrReservedLogin
+			}
+			pass, err := readPassword(cmd, password)
+			if err != nil {
+				return err
+			}
+			s, err := o.localStorage()
+			if err != nil {
+				return err
+			}
+			err = sqlite.CreateUser(s, sqlite.User{Login: args[0], Role: role, Password: verify.HashPassword(pass)})
+			if err != nil {
+				return err
+			}
+			cmd.PrintErrln("user created")
+			return nil
+		},
+	}
+	create.Flags().StringVar(&role, "role", verify.UserRole, "admin or user")
+	create.Flags().StringVar(&password, "new-password", "", "password of the new user, stdin if empty")
+	create.RegisterFlagCompletionFunc("role", fixedCompletion(roles...))
+
+	var newPassword string
+	passwd := &cobra.Command{
+		Use:   "passwd LOGIN",
+		Short: "Change a password, the new one is read from stdin without --new-password",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pass, err := readPassword(cmd, newPassword)
+			if err != nil {
+				return err
+			}
+			s, err := o.localStorage()
+			if err != nil {
+				return err
+			}
+			err = userNotFound(args[0], sqlite.SetUserPassword(s, args[0], verify.HashPassword(pass)))
+			if err != nil {
+				return err
+			}
+			cmd.PrintErrln("password changed")
+			return nil
+		},
+	}
+	passwd.Flags().StringVar(&newPassword, "new-password", "", "new password, stdin if empty")
+
+	setRole := &cobra.Command{
+		Use:   "role LOGIN ROLE",
+		Short: "Assign a role to a user",
+		Args:  cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 1 {
+				return roles, cobra.ShellCompDirectiveNoFileComp
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !verify.ValidRole(args[1]) {
+				return fmt.Errorf("wrong role %q, use %s", args[1], strings.Join(roles, " or "))
+			}
+			s, err := o.localStorage()
+			if err != nil {
+				return err
+			}
+			err = userNotFound(args[0], sqlite.SetUserRole(s, args[0], args[1]))
+			if err != nil {
+				return err
+			}
+			cmd.PrintErrln("role assigned")
+			return nil
+		},
+	}
+
+	cmd.AddCommand(list, create, passwd, setRole)
+	return cmd
+}
+
+// readPassword возвращает пароль из флага или первую строку stdin
+func readPassword(cmd *cobra.Command, flagValue string) (string, error) {
+	pass := flagValue
+	if pass == "" {
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && line == "" {
+			return "", errors.New("no password in stdin")
+		}
+		pass = strings.TrimRight(line, "\r\n")
+	}
+	if pass == "" {
+		return "", errors.New("empty password")
+	}
+	return pass, nil
+}
+
+func userNotFound(login string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user %q", login)
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	slog "log/slog"
+	"os"
+
+	"vk-testovoe/filmoteka/app"
+	"vk-testovoe/filmoteka/config"
+	"vk-testovoe/filmoteka/storage"
+)
+
+// runCommand выполняет команду из командной строки вместо запуска сервера
+// и возвращает код выхода
+func runCommand(log *slog.Logger, cfg *config.Config, storage *sqlite.Storage, args []string) int {
+	switch args[0] {
+	case "import":
+		return importCommand(log, storage, args[1:])
+	case "export":
+		return exportCommand(log, storage, args[1:])
+	case "backup":
+		return backupCommand(log, cfg, storage, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		return 2
+	}
+}
+
+// main import -kind films -format csv -file films.csv [-dry-run] [-on-conflict update] [-create-missing]
+func importCommand(log *slog.Logger, storage *sqlite.Storage, args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	kind := fs.String("kind", app.ImportFilms, "films or actors")
+	format := fs.String("format", app.FormatCSV, "csv or jsonl")
+	file := fs.String("file", "", "path to the file, stdin if empty")
+	dryRun := fs.Bool("dry-run", false, "check the file without saving")
+	onConflict := fs.String("on-conflict", app.ConflictSkip, "skip or update existing records")
+	createMissing := fs.Bool("create-missing", false, "create referenced actors and films that are not found")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	in := os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Error("cant open import file", slog.Any("error", err))
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	report, err := app.Import(storage, in, app.ImportOptions{
+		Kind:          *kind,
+		Format:        *format,
+		DryRun:        *dryRun,
+		OnConflict:    *onConflict,
+		CreateMissing: *createMissing,
+	})
+	if err != nil {
+		log.Error("error to import", slog.Any("error", err))
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Error("cant write import report", slog.Any("error", err))
+		return 1
+	}
+
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// main export -format jsonl|csv|sql [-file filmoteka.jsonl]
+func exportCommand(log *slog.Logger, storage *sqlite.Storage, args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", app.FormatJSONL, "jsonl, csv (zip archive) or sql")
+	file := fs.String("file", "", "path to the output file, stdout if empty")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if !app.ValidExportFormat(*format) {
+		fmt.Fprintf(os.Stderr, "wrong format %q\n", *format)
+		return 2
+	}
+
+	out := os.Stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			log.Error("cant create export file", slog.Any("error", err))
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	err := app.Export(storage, out, *format)
+	if err != nil {
+		log.Error("error to export", slog.Any("error", err))
+		return 1
+	}
+
+	return 0
+}
+
+// main backup [-file backup.db]
+//
+// Без -file копия сохраняется в каталог backup.dir из конфига.
+func backupCommand(log *slog.Logger, cfg *config.Config, storage *sqlite.Storage, args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	file := fs.String("file", "", "path to the backup file, backup.dir from config if empty")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	path := *file
+	var err error
+	switch {
+	case path != "":
+		err = sqlite.Backup(storage, path)
+	case cfg.Backup.Dir != "":
+		path, err = sqlite.BackupToDir(storage, cfg.Backup.Dir)
+		if err == nil {
+			_, err = sqlite.PruneBackups(cfg.Backup.Dir, cfg.Backup.Keep)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "set -file or backup.dir in config")
+		return 2
+	}
+	if err != nil {
+		log.Error("error to backup storage", slog.Any("error", err))
+		return 1
+	}
+
+	fmt.Println(path)
+	return 0
+}
+
+// main restore -file backup.db
+//
+// Сервер на время восстановления должен быть остановлен.
+func restoreCommand(log *slog.Logger, storagePath string, args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	file := fs.String("file", "", "path to the backup file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "-file is required")
+		return 2
+	}
+
+	version, err := sqlite.CheckBackup(*file)
+	if err != nil {
+		log.Error("backup check failed", slog.Any("error", err))
+		return 1
+	}
+	log.Info("backup checked", slog.Int("version", version), slog.Int("supported", sqlite.SchemaVersion()))
+
+	err = sqlite.Restore(*file, storagePath)
+	if err != nil {
+		log.Error("error to restore storage", slog.Any("error", err))
+		return 1
+	}
+
+	log.Info("storage restored", slog.String("from", *file), slog.String("previous", storagePath+".before-restore"))
+	return 0
+}
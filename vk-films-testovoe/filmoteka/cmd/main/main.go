@@ -8,6 +8,9 @@ import (
 	"vk-testovoe/filmoteka/config"
 	"vk-testovoe/filmoteka/storage"
 	"vk-testovoe/filmoteka/app"
+	"vk-testovoe/filmoteka/openapi"
+	"vk-testovoe/filmoteka/rpc"
+	"vk-testovoe/filmoteka/verify"
 
 	_ "modernc.org/sqlite"
 )
@@ -15,11 +18,22 @@ import (
 func main() {
 	cfg := config.MustLoad()
 
-	log:=settupLogger()
+	// команды пишут результат в stdout, поэтому их логи уходят в stderr
+	logOut := os.Stdout
+	if len(os.Args) > 1 {
+		logOut = os.Stderr
+	}
+
+	log:=settupLogger(logOut)
 
 	log.Info("starting vk-films-testovoe")
 	log.Debug("debug messages are enabled")
 
+	// restore подменяет файл базы, поэтому выполняется до её открытия
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		os.Exit(restoreCommand(log, cfg.StoragePath, os.Args[2:]))
+	}
+
 	storage, err := sqlite.New(cfg.StoragePath, log)
 	if err != nil {
 		log.Error("failed to init storage")
@@ -28,72 +42,52 @@ func main() {
 
 	log.Info("storage connected")
 
-	r := http.NewServeMux()
-
-	//Актёры
-	r.HandleFunc("/actors", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			app.GetAllActors(log, storage, w, r)
-		case http.MethodPost:
-			app.PostActor(log, storage, w, r)
-		}
-	})
-	r.HandleFunc("/actors/", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			app.GetOneActor(log, storage, w, r)
-		case http.MethodPut:
-			app.PutOneActor(log, storage, w, r)
-		case http.MethodDelete:
-			app.DeleteOneActor(log, storage, w, r)
-		}
-	})
-
-	//Фильмы
-	r.HandleFunc("/films", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			app.GetAllFilms(log, storage, w, r)
-		case http.MethodPost:
-			app.PostFilm(log, storage, w, r)
-		}
-	})
-
-	r.HandleFunc("/films/", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			app.GetOneFilm(log, storage, w, r)
-		case http.MethodPut:
-			app.PutOneFilm(log, storage, w, r)
-		case http.MethodDelete:
-			app.DeleteOneFilm(log, storage, w, r)
-		}
-	})
+	// main import ... и другие команды выполняются без запуска сервера
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(log, cfg, storage, os.Args[1:]))
+	}
+
+	// один limiter на HTTP и gRPC, чтобы перебор паролей нельзя было разделить между ними
+	limiter := verify.NewLimiter(cfg.RateLimit, verify.NewMemoryStore())
+
+	handler, err := app.NewHandler(log, storage, cfg, openapi.Options{
+		Requests:  cfg.OpenAPI.ValidateRequests,
+		Responses: cfg.OpenAPI.ValidateResponses,
+	}, limiter)
+	if err != nil {
+		log.Error("failed to load openapi spec", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	go app.ScheduleBackups(log, storage, cfg.Backup.Dir, cfg.Backup.Interval, cfg.Backup.Keep)
+	go app.SchedulePurge(log, storage, cfg.Trash.Retention, cfg.Trash.PurgeInterval)
+	go app.ScheduleEventsPrune(log, storage, cfg.Events.Retention, cfg.Events.PruneInterval)
+	go app.DispatchWebhooks(log, storage, cfg.Webhooks)
+	go rpc.Serve(log, storage, cfg.GRPC.Address, limiter)
 
 	srv := &http.Server{
 		Addr:         cfg.Address,
 		ReadTimeout:  cfg.HTTPServer.Timeout,
 		WriteTimeout: cfg.HTTPServer.Timeout,
 		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
-		Handler:      r,
+		Handler:      handler,
 	}
 
 	log.Info("starting vk-films-testovoe on server", slog.String("server", cfg.Address))
 
 	err = srv.ListenAndServe()
 	if err != nil {
-		log.Error("failed to start server:", err)
+		log.Error("failed to start server", slog.Any("error", err))
 		return
 	}
 
 	log.Info("server started")
 }
 
-func settupLogger() *slog.Logger {
+func settupLogger(out *os.File) *slog.Logger {
 	var log *slog.Logger
 	log=slog.New(
-		slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		slog.NewTextHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}),
 	)
 	return log
 }
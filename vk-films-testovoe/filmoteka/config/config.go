@@ -10,6 +10,13 @@ import (
 type Config struct {
 	StoragePath string `yaml:"storage_path" env-required:"true"`
 	HTTPServer  `yaml:"http_server"`
+	GRPC        GRPC    `yaml:"grpc"`
+	OpenAPI     OpenAPI `yaml:"openapi"`
+	Backup      `yaml:"backup"`
+	Trash       `yaml:"trash"`
+	Events      Events   `yaml:"events"`
+	Webhooks    Webhooks  `yaml:"webhooks"`
+	RateLimit   RateLimit `yaml:"rate_limit"`
 }
 
 type HTTPServer struct {
@@ -18,14 +25,83 @@ type HTTPServer struct {
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 }
 
+// GRPC - сервер для внутренних сервисов рядом с HTTP. Пустой Address выключает его
+type GRPC struct {
+	Address string `yaml:"address" env-default:":9090"`
+}
+
+// OpenAPI - проверка запросов и ответов по спецификации openapi3.yaml.
+// Неверный запрос отклоняется с 400, неверный ответ только записывается в лог
+type OpenAPI struct {
+	ValidateRequests  bool `yaml:"validate_requests" env-default:"false"`
+	ValidateResponses bool `yaml:"validate_responses" env-default:"false"`
+}
+
+// Backup - плановые резервные копии базы. Пустой Dir выключает их, Keep <= 0 хранит все копии
+type Backup struct {
+	Dir      string        `yaml:"dir"`
+	Interval time.Duration `yaml:"interval" env-default:"24h"`
+	Keep     int           `yaml:"keep" env-default:"7"`
+}
+
+// Trash - корзина удалённых фильмов и людей. Retention <= 0 хранит их бессрочно
+type Trash struct {
+	Retention     time.Duration `yaml:"retention" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+// Events - лента изменений /events. PollInterval - как часто поток проверяет новые события,
+// Retention - сколько они и завершённые доставки /webhooks хранятся, <= 0 хранит бессрочно
+type Events struct {
+	PollInterval  time.Duration `yaml:"poll_interval" env-default:"1s"`
+	Retention     time.Duration `yaml:"retention" env-default:"168h"`
+	PruneInterval time.Duration `yaml:"prune_interval" env-default:"1h"`
+}
+
+// Webhooks - отправка событий подписчикам /webhooks. Попытка, не получившая 2xx за Timeout,
+// повторяется через Backoff, дальше пауза удваивается до MaxBackoff. После MaxAttempts попыток
+// доставка переходит в dead и ждёт ручного повтора. PollInterval <= 0 выключает отправку
+type Webhooks struct {
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"1s"`
+	Timeout      time.Duration `yaml:"timeout" env-default:"10s"`
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"8"`
+	Backoff      time.Duration `yaml:"backoff" env-default:"30s"`
+	MaxBackoff   time.Duration `yaml:"max_backoff" env-default:"1h"`
+}
+
+// RateLimit - ограничение запросов с авторизацией и защита от перебора паролей.
+// IPRequests и LoginRequests - сколько запросов за Window принимается с одного адреса и под одним логином.
+// После LoginFailures неверных паролей к логину или IPFailures с адреса за FailureWindow они закрываются
+// на Lockout, каждая следующая неудача удваивает блокировку до MaxLockout. Нулевой лимит выключает его.
+// TrustProxy берёт адрес клиента из X-Forwarded-For, включать только за своим прокси
+type RateLimit struct {
+	IPRequests    int           `yaml:"ip_requests" env-default:"600"`
+	LoginRequests int           `yaml:"login_requests" env-default:"300"`
+	Window        time.Duration `yaml:"window" env-default:"1m"`
+	LoginFailures int           `yaml:"login_failures" env-default:"5"`
+	IPFailures    int           `yaml:"ip_failures" env-default:"20"`
+	FailureWindow time.Duration `yaml:"failure_window" env-default:"15m"`
+	Lockout       time.Duration `yaml:"lockout" env-default:"1m"`
+	MaxLockout    time.Duration `yaml:"max_lockout" env-default:"1h"`
+	TrustProxy    bool          `yaml:"trust_proxy" env-default:"false"`
+}
+
 func MustLoad() *Config {
-	configPath := "config.yaml"
+	cfg, err := Load("config.yaml")
+	if err != nil {
+		log.Fatalf("cannot read config: %s", err)
+	}
+
+	return cfg
+}
 
+// Load читает конфиг из configPath
+func Load(configPath string) (*Config, error) {
 	var cfg Config
 
 	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatalf("cannot read config: %s", err)
+		return nil, err
 	}
 
-	return &cfg
+	return &cfg, nil
 }
\ No newline at end of file
@@ -0,0 +1,46 @@
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// спецификация встроена в бинарник, чтобы документация и проверка не расходились с ним
+//
+//go:embed openapi3.yaml
+var spec []byte
+
+//go:embed docs.html
+var docs []byte
+
+// Load разбирает встроенную спецификацию и проверяет, что она корректна
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	err = doc.Validate(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// ServeSpec отдаёт /openapi.yaml
+func ServeSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(spec)
+}
+
+// ServeDocs отдаёт /docs - Swagger UI, который читает /openapi.yaml
+func ServeDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(docs)
+}
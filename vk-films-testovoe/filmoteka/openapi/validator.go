@@ -0,0 +1,173 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Options - что проверять по спецификации.
+// Strict заменяет ответ, не совпадающий со спецификацией, на 500 и требует описать каждый код ответа,
+// чтобы расхождения кода и openapi3.yaml ломали тесты.
+type Options struct {
+	Requests  bool
+	Responses bool
+	Strict    bool
+}
+
+func init() {
+	// в ошибке достаточно причины, без схемы и значения целиком
+	openapi3.SchemaErrorDetailsDisabled = true
+
+	// тела импорта и выгрузки проверяются только по типу содержимого
+	openapi3filter.RegisterBodyDecoder("application/x-ndjson", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/sql", openapi3filter.FileBodyDecoder)
+}
+
+type validator struct {
+	log    *slog.Logger
+	next   http.Handler
+	router routers.Router
+	opts   Options
+}
+
+// Middleware проверяет запросы к next и его ответы по встроенной спецификации.
+// Неверный запрос отклоняется с 400, путь или метод не из спецификации - с 404 или 405.
+// Неверный ответ записывается в лог, а с Strict заменяется на 500.
+func Middleware(log *slog.Logger, next http.Handler, opts Options) (http.Handler, error) {
+	if !opts.Requests && !opts.Responses {
+		return next, nil
+	}
+
+	doc, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &validator{log: log, next: next, router: router, opts: opts}, nil
+}
+
+func (v *validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, pathParams, err := v.router.FindRoute(r)
+	if err != nil {
+		v.log.Warn("request is not described in openapi spec",
+			slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.Any("error", err))
+		if !v.opts.Requests {
+			v.next.ServeHTTP(w, r)
+			return
+		}
+
+		status := http.StatusNotFound
+		if errors.Is(err, routers.ErrMethodNotAllowed) {
+			status = http.StatusMethodNotAllowed
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			// пароль и права проверяют сами обработчики
+			AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+			SkipSettingDefaults:   true,
+			IncludeResponseStatus: v.opts.Strict,
+		},
+	}
+
+	if v.opts.Requests {
+		err = openapi3filter.ValidateRequest(r.Context(), input)
+		if err != nil {
+			v.log.Error("request does not match openapi spec", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !v.opts.Responses {
+		v.next.ServeHTTP(w, r)
+		return
+	}
+
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+	v.next.ServeHTTP(rec, r)
+	if rec.stream {
+		return
+	}
+
+	// как и net/http, тип ответа без Content-Type определяется по содержимому
+	body := rec.body.Bytes()
+	if w.Header().Get("Content-Type") == "" && len(body) > 0 {
+		w.Header().Set("Content-Type", http.DetectContentType(body))
+	}
+
+	err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rec.status,
+		Header:                 w.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(body)),
+		Options:                input.Options,
+	})
+	if err != nil {
+		v.log.Error("response does not match openapi spec",
+			slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.Any("error", err))
+		if v.opts.Strict {
+			http.Error(w, "response does not match openapi spec: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(rec.status)
+	w.Write(body)
+}
+
+// recorder придерживает ответ, пока он не проверен.
+// Поток text/event-stream не заканчивается, поэтому он уходит клиенту сразу и без проверки.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	stream      bool
+	body        bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		rec.stream = true
+		rec.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	if rec.stream {
+		return rec.ResponseWriter.Write(b)
+	}
+	return rec.body.Write(b)
+}
+
+// Unwrap нужен http.ResponseController, например для SetWriteDeadline в выгрузке
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,197 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"vk-testovoe/filmoteka/filmotekapb"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// методы, которые меняют данные и требуют права write, остальным хватает read
+var writeMethods = map[string]bool{
+	filmotekapb.FilmotekaService_CreateFilm_FullMethodName:  true,
+	filmotekapb.FilmotekaService_UpdateFilm_FullMethodName:  true,
+	filmotekapb.FilmotekaService_DeleteFilm_FullMethodName:  true,
+	filmotekapb.FilmotekaService_CreateActor_FullMethodName: true,
+	filmotekapb.FilmotekaService_UpdateActor_FullMethodName: true,
+	filmotekapb.FilmotekaService_DeleteActor_FullMethodName: true,
+}
+
+type userKey struct{}
+
+// userFrom возвращает логин, под которым прошёл запрос
+func userFrom(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// parseBasicAuth разбирает "Basic base64(login:password)" так же, как http.Request.BasicAuth
+func parseBasicAuth(auth string) (string, string, bool) {
+	const prefix = "Basic "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(decoded), ":")
+}
+
+// parseBearer разбирает "Bearer <ключ API>"
+func parseBearer(auth string) (string, bool) {
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
+}
+
+// authenticate проверяет логин и пароль или ключ API из метаданных authorization
+// теми же правилами, что и HTTP API
+func (srv *Server) authenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+
+	var user, pass string
+	ok := false
+	if len(values) > 0 {
+		user, pass, ok = parseBasicAuth(values[0])
+	}
+
+	ip := peerIP(ctx)
+	err := srv.limit(ctx, ip, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	// ключ API проверяется как пароль к логину key/<имя ключа>, см. app.KeyAuth
+	if token, bearer := parseBearer(values[0]); bearer {
+		key, err := verify.Key(srv.storage, token)
+		if errors.Is(err, verify.ErrWrongCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "wrong api key")
+		}
+		if err != nil {
+			return nil, srv.statusError(err)
+		}
+		user, pass, ok = verify.KeyLogin(key.Name), token, true
+	} else if ok && verify.IsKeyLogin(user) {
+		// логин key/<имя> выдаётся только ключу из Bearer, паролем его не передать
+		return nil, status.Error(codes.Unauthenticated, "use Bearer authorization for api keys")
+	}
+
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "wrong authorization format")
+	}
+
+	permissions, err := verify.Authenticate(srv.storage, user, pass)
+	if errors.Is(err, verify.ErrWrongCredentials) {
+		srv.failure(ctx, ip, user)
+		return nil, status.Error(codes.Unauthenticated, "wrong login or password")
+	}
+	if err != nil {
+		return nil, srv.statusError(err)
+	}
+
+	permission := verify.ReadPermission
+	if writeMethods[method] {
+		permission = verify.WritePermission
+	}
+	if !verify.Allows(permissions, permission) {
+		return nil, status.Error(codes.PermissionDenied, "wrong role")
+	}
+
+	return context.WithValue(ctx, userKey{}, user), nil
+}
+
+// limit отклоняет вызов с ResourceExhausted, если адрес или логин превысили лимит или закрыты
+func (srv *Server) limit(ctx context.Context, ip, user string) error {
+	if srv.limiter == nil {
+		return nil
+	}
+
+	wait, err := srv.limiter.Allow(ctx, ip, user)
+	if err != nil {
+		srv.log.Error("rate limiter failed", slog.Any("error", err))
+		return nil
+	}
+	if wait > 0 {
+		srv.log.Warn("too many requests", slog.String("ip", ip), slog.String("user", user))
+		return status.Errorf(codes.ResourceExhausted, "too many requests, retry after %s", wait.Round(time.Second))
+	}
+	return nil
+}
+
+// failure учитывает неверный пароль в limiter
+func (srv *Server) failure(ctx context.Context, ip, user string) {
+	if srv.limiter == nil {
+		return
+	}
+
+	lockout, err := srv.limiter.Failure(ctx, ip, user)
+	if err != nil {
+		srv.log.Error("rate limiter failed", slog.Any("error", err))
+		return
+	}
+	if lockout > 0 {
+		srv.log.Warn("login locked", slog.String("ip", ip), slog.String("user", user), slog.Duration("lockout", lockout))
+	}
+}
+
+// peerIP - адрес клиента без порта
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func (srv *Server) unaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := srv.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authStream подменяет контекст потока на контекст с логином
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+func (srv *Server) streamAuth(service any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := srv.authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(service, &authStream{ServerStream: stream, ctx: ctx})
+}
@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"vk-testovoe/filmoteka/config"
+	"vk-testovoe/filmoteka/filmotekapb"
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// TestAuth: право проверяется по методу, поэтому ключ только на запись создаёт фильмы,
+// а отказ в чтении не считается неверным паролем и не закрывает логин
+func TestAuth(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	token, prefix, err := verify.NewKey()
+	require.NoError(t, err)
+	_, err = sqlite.CreateAPIKey(s, sqlite.APIKey{Name: "writer", Prefix: prefix, Permissions: []string{verify.WritePermission}}, verify.HashKey(token))
+	require.NoError(t, err)
+
+	limiter := verify.NewLimiter(config.RateLimit{
+		IPRequests:    100,
+		LoginRequests: 100,
+		Window:        time.Minute,
+		LoginFailures: 2,
+		IPFailures:    4,
+		FailureWindow: time.Minute,
+		Lockout:       time.Minute,
+		MaxLockout:    time.Minute,
+	}, verify.NewMemoryStore())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := New(log, s, limiter)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := filmotekapb.NewFilmotekaServiceClient(conn)
+
+	bearer := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	basic := func(user, pass string) context.Context {
+		auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + pass))
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+auth)
+	}
+
+	film, err := client.CreateFilm(bearer, &filmotekapb.CreateFilmRequest{Film: &filmotekapb.Film{Title: "Мимино", ReleaseDate: "1977"}})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = client.GetFilm(bearer, &filmotekapb.GetFilmRequest{Id: film.Id})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+	_, err = client.CreateFilm(bearer, &filmotekapb.CreateFilmRequest{Film: &filmotekapb.Film{Title: "Кин-дза-дза!", ReleaseDate: "1986"}})
+	require.NoError(t, err)
+
+	_, err = client.CreateFilm(basic("User", "User"), &filmotekapb.CreateFilmRequest{Film: &filmotekapb.Film{Title: "Паспорт", ReleaseDate: "1990"}})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.GetFilm(basic("User", "User"), &filmotekapb.GetFilmRequest{Id: film.Id})
+	require.NoError(t, err)
+
+	// логин key/<имя> выдаётся только ключу из Bearer
+	_, err = client.CreateFilm(basic(verify.KeyLogin("writer"), token), &filmotekapb.CreateFilmRequest{Film: &filmotekapb.Film{Title: "Паспорт", ReleaseDate: "1990"}})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
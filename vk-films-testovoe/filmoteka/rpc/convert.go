@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"vk-testovoe/filmoteka/filmotekapb"
+	"vk-testovoe/filmoteka/storage"
+)
+
+// преобразования между моделями хранилища и сообщениями protobuf
+
+func toRefs(refs []sqlite.Ref) []*filmotekapb.Ref {
+	res := make([]*filmotekapb.Ref, 0, len(refs))
+	for _, ref := range refs {
+		res = append(res, &filmotekapb.Ref{Id: int64(ref.Id), Name: ref.Name})
+	}
+	return res
+}
+
+func fromRefs(refs []*filmotekapb.Ref) []sqlite.Ref {
+	res := make([]sqlite.Ref, 0, len(refs))
+	for _, ref := range refs {
+		res = append(res, sqlite.Ref{Id: int(ref.GetId()), Name: ref.GetName()})
+	}
+	return res
+}
+
+func toFilm(film sqlite.Film) *filmotekapb.Film {
+	res := &filmotekapb.Film{
+		Id:           int64(film.FilmId),
+		Title:        film.Title,
+		Description:  film.Description,
+		CriticRating: int32(film.CriticRating),
+		ReleaseDate:  film.ReleaseDate,
+		Actors:       toRefs(film.Actors),
+		Genres:       film.Genres,
+		UserScore: &filmotekapb.FilmScore{
+			Average: film.UserScore.Average,
+			Votes:   int32(film.UserScore.Votes),
+		},
+	}
+
+	for _, n := range film.UserScore.Histogram {
+		res.UserScore.Histogram = append(res.UserScore.Histogram, int32(n))
+	}
+
+	for _, credit := range film.Credits {
+		res.Credits = append(res.Credits, &filmotekapb.Credit{
+			PersonId:  int64(credit.PersonId),
+			Name:      credit.Name,
+			FilmId:    int64(film.FilmId),
+			Title:     film.Title,
+			Role:      credit.Role,
+			Character: credit.Character,
+			Job:       credit.Job,
+			Position:  int32(credit.Position),
+		})
+	}
+
+	return res
+}
+
+// fromFilm берёт только то, что можно записать: оценки пользователей и поля ролей
+// фильма (film_id, title, position) игнорируются
+func fromFilm(film *filmotekapb.Film) sqlite.Film {
+	res := sqlite.Film{
+		FilmId:       int(film.GetId()),
+		Title:        film.GetTitle(),
+		Description:  film.GetDescription(),
+		CriticRating: int(film.GetCriticRating()),
+		ReleaseDate:  film.GetReleaseDate(),
+		Actors:       fromRefs(film.GetActors()),
+		Genres:       film.GetGenres(),
+	}
+
+	for _, credit := range film.GetCredits() {
+		res.Credits = append(res.Credits, sqlite.Credit{
+			PersonId:  int(credit.GetPersonId()),
+			Name:      credit.GetName(),
+			Role:      credit.GetRole(),
+			Character: credit.GetCharacter(),
+			Job:       credit.GetJob(),
+		})
+	}
+
+	return res
+}
+
+func toActor(actor sqlite.Actor) *filmotekapb.Actor {
+	return &filmotekapb.Actor{
+		Id:        int64(actor.ActorId),
+		Name:      actor.Name,
+		Gender:    actor.Gender,
+		BirthDate: actor.BirthDate,
+		Films:     toRefs(actor.Films),
+	}
+}
+
+func fromActor(actor *filmotekapb.Actor) sqlite.Actor {
+	return sqlite.Actor{
+		ActorId:   int(actor.GetId()),
+		Name:      actor.GetName(),
+		Gender:    actor.GetGender(),
+		BirthDate: actor.GetBirthDate(),
+		Films:     fromRefs(actor.GetFilms()),
+	}
+}
@@ -0,0 +1,254 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"vk-testovoe/filmoteka/app"
+	"vk-testovoe/filmoteka/filmotekapb"
+	"vk-testovoe/filmoteka/storage"
+	"vk-testovoe/filmoteka/verify"
+)
+
+// Server реализует filmotekapb.FilmotekaService поверх того же хранилища, что и HTTP API
+type Server struct {
+	filmotekapb.UnimplementedFilmotekaServiceServer
+
+	log     *slog.Logger
+	storage *sqlite.Storage
+	limiter *verify.Limiter
+}
+
+// New создаёт gRPC сервер с проверкой авторизации на каждом вызове.
+// limiter ограничивает вызовы так же, как запросы к HTTP API, nil - без ограничений
+func New(log *slog.Logger, s *sqlite.Storage, limiter *verify.Limiter) *grpc.Server {
+	srv := &Server{log: log, storage: s, limiter: limiter}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(srv.unaryAuth),
+		grpc.StreamInterceptor(srv.streamAuth),
+	)
+	filmotekapb.RegisterFilmotekaServiceServer(server, srv)
+
+	return server
+}
+
+// Serve запускает gRPC сервер рядом с HTTP. Пустой address выключает его.
+func Serve(log *slog.Logger, s *sqlite.Storage, address string, limiter *verify.Limiter) {
+	if address == "" {
+		log.Info("grpc server is disabled")
+		return
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Error("failed to listen grpc address", slog.String("address", address), slog.Any("error", err))
+		return
+	}
+
+	log.Info("starting grpc server", slog.String("address", address))
+
+	err = New(log, s, limiter).Serve(listener)
+	if err != nil {
+		log.Error("grpc server stopped", slog.Any("error", err))
+	}
+}
+
+// statusError переводит ошибки хранилища в коды gRPC
+func (srv *Server) statusError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, sqlite.ErrUnknownRef), errors.Is(err, sqlite.ErrAmbiguousRef), errors.Is(err, sqlite.ErrInvalidDate):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// ошибки отправки в поток уже содержат код
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	srv.log.Error("grpc call failed", slog.Any("error", err))
+	return status.Error(codes.Internal, err.Error())
+}
+
+// //Фильмы
+
+func (srv *Server) GetFilm(ctx context.Context, req *filmotekapb.GetFilmRequest) (*filmotekapb.Film, error) {
+	film, err := sqlite.GetOneFilmFromStorage(srv.storage, int(req.GetId()))
+	if err != nil {
+		return nil, srv.statusError(err)
+	}
+	return toFilm(film), nil
+}
+
+func (srv *Server) ListFilms(req *filmotekapb.ListFilmsRequest, stream filmotekapb.FilmotekaService_ListFilmsServer) error {
+	filter := sqlite.FilmFilter{
+		Genre: req.GetGenre(),
+		Sort:  req.GetSort(),
+		Desc:  req.GetDesc(),
+	}
+
+	if filter.Sort != "" && !sqlite.ValidFilmSort(filter.Sort) {
+		return status.Error(codes.InvalidArgument, "wrong sort")
+	}
+
+	var err error
+	if req.GetReleasedFrom() != "" {
+		filter.ReleasedFrom, err = sqlite.NormalizeDate(req.GetReleasedFrom())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "wrong released_from")
+		}
+	}
+	if req.GetReleasedTo() != "" {
+		filter.ReleasedTo, err = sqlite.NormalizeDate(req.GetReleasedTo())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "wrong released_to")
+		}
+	}
+
+	return srv.streamFilms(filter, stream)
+}
+
+func (srv *Server) SearchFilms(req *filmotekapb.SearchFilmsRequest, stream filmotekapb.FilmotekaService_SearchFilmsServer) error {
+	if req.GetQuery() == "" {
+		return status.Error(codes.InvalidArgument, "empty query")
+	}
+
+	filter := sqlite.FilmFilter{
+		Search: req.GetQuery(),
+		Sort:   req.GetSort(),
+		Desc:   req.GetDesc(),
+	}
+
+	if filter.Sort != "" && !sqlite.ValidFilmSort(filter.Sort) {
+		return status.Error(codes.InvalidArgument, "wrong sort")
+	}
+
+	return srv.streamFilms(filter, stream)
+}
+
+func (srv *Server) streamFilms(filter sqlite.FilmFilter, stream grpc.ServerStreamingServer[filmotekapb.Film]) error {
+	err := sqlite.StreamFilms(srv.storage, filter, func(film sqlite.Film) error {
+		return stream.Send(toFilm(film))
+	})
+	if err != nil {
+		return srv.statusError(err)
+	}
+	return nil
+}
+
+func (srv *Server) CreateFilm(ctx context.Context, req *filmotekapb.CreateFilmRequest) (*filmotekapb.Film, error) {
+	film := fromFilm(req.GetFilm())
+	film.FilmId = 0
+
+	err := app.ValidateFilm(film)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	filmID, err := sqlite.CreateFilm(srv.storage.As(userFrom(ctx)), film, req.GetCreateMissing())
+	if err != nil {
+		return nil, srv.statusError(err)
+	}
+
+	return srv.GetFilm(ctx, &filmotekapb.GetFilmRequest{Id: int64(filmID)})
+}
+
+func (srv *Server) UpdateFilm(ctx context.Context, req *filmotekapb.UpdateFilmRequest) (*filmotekapb.Film, error) {
+	film := fromFilm(req.GetFilm())
+	if film.FilmId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "film id is required")
+	}
+
+	err := app.ValidateFilm(film)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = sqlite.UpdateFilm(srv.storage.As(userFrom(ctx)), film, req.GetCreateMissing())
+	if err != nil {
+		return nil, srv.statusError(err)
+	}
+
+	return srv.GetFilm(ctx, &filmotekapb.GetFilmRequest{Id: int64(film.FilmId)})
+}
+
+func (srv *Server) DeleteFilm(ctx context.Context, req *filmotekapb.DeleteFilmRequest) (*filmotekapb.DeleteResponse, error) {
+	err := sqlite.DeleteFilm(srv.storage.As(userFrom(ctx)), int(req.GetId()))
+	if err != nil {
+		return nil, srv.statusError(err)
+	}
+	return &filmotekapb.DeleteResponse{}, nil
+}
+
+// //Актёры
+
+func (srv *Server) GetActor(ctx context.Context, req *filmotekapb.GetActorRequest) (*filmotekapb.Actor, error) {
+	actor, err := sqlite.GetOneActorFromStorage(srv.storage, int(req.GetId()), srv.log)
+	if err != nil {
+		return nil, srv.statusError(err)
+	}
+	return toActor(actor), nil
+}
+
+func (srv *Server) ListActors(req *filmotekapb.ListActorsRequest, stream filmotekapb.FilmotekaService_ListActorsServer) error {
+	err := sqlite.StreamActors(srv.storage, req.GetName(), func(actor sqlite.Actor) error {
+		return stream.Send(toActor(actor))
+	})
+	if err != nil {
+		return srv.statusError(err)
+	}
+	return nil
+}
+
+func (srv *Server) CreateActor(ctx context.Context, req *filmotekapb.CreateActorRequest) (*filmotekapb.Actor, error) {
+	actor := fromActor(req.GetActor())
+	actor.ActorId = 0
+
+	err := app.ValidateActor(actor)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	actorID, err := sqlite.CreateActor(srv.storage.As(userFrom(ctx)), actor, req.GetCreateMissing())
+	if err != nil {
+		return nil, srv.statusError(err)
+	}
+
+	return srv.GetActor(ctx, &filmotekapb.GetActorRequest{Id: int64(actorID)})
+}
+
+func (srv *Server) UpdateActor(ctx context.Context, req *filmotekapb.UpdateActorRequest) (*filmotekapb.Actor, error) {
+	actor := fromActor(req.GetActor())
+	if actor.ActorId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "actor id is required")
+	}
+
+	err := app.ValidateActor(actor)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = sqlite.UpdateActor(srv.storage.As(userFrom(ctx)), actor, req.GetCreateMissing())
+	if err != nil {
+		return nil, srv.statusError(err)
+	}
+
+	return srv.GetActor(ctx, &filmotekapb.GetActorRequest{Id: int64(actor.ActorId)})
+}
+
+func (srv *Server) DeleteActor(ctx context.Context, req *filmotekapb.DeleteActorRequest) (*filmotekapb.DeleteResponse, error) {
+	err := sqlite.DeleteActor(srv.storage.As(userFrom(ctx)), int(req.GetId()))
+	if err != nil {
+		return nil, srv.statusError(err)
+	}
+	return &filmotekapb.DeleteResponse{}, nil
+}
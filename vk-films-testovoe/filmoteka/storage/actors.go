@@ -10,14 +10,26 @@ type Actor struct {
 	Name      string	`json:"name"`
 	Gender    string	`json:"gender"`
 	BirthDate string	`json:"birthdate"`
-	Films     []string	`json:"films"`
+	Films     []Ref		`json:"films"`
+	DeletedAt string	`json:"deletedAt,omitempty"`
 }
 
+// в /actors попадают люди с актёрскими ролями и те, у кого ролей пока нет
+const actorsOnly = `(EXISTS (SELECT 1 FROM Credits WHERE Credits.PersonId = Actors.ActorId AND Credits.Role = 'actor')
+		OR NOT EXISTS (SELECT 1 FROM Credits WHERE Credits.PersonId = Actors.ActorId))`
+
 // //Актёры
 //
 //	app.GetAllActors(log, storage, w, r)
-func GetAllActorsFromStorage(s *Storage, log *slog.Logger) ([]Actor, error) {
-	rows, err := s.db.Query("SELECT ActorId,Name,Gender,BirthDate FROM Actors")
+//
+// deleted выбирает актёров из корзины вместо обычных
+func GetAllActorsFromStorage(s *Storage, log *slog.Logger, deleted bool) ([]Actor, error) {
+	rows, err := s.db.Query(`
+		SELECT ActorId,Name,Gender,COALESCE(BirthDate, ''),COALESCE(DeletedAt, '')
+		FROM Actors
+		WHERE `+actorsOnly+`
+			AND (DeletedAt IS NOT NULL) = :deleted
+	`, sql.Named("deleted", deleted))
 
 	log.Info("starting to get actors from storage")
 
@@ -30,7 +42,7 @@ func GetAllActorsFromStorage(s *Storage, log *slog.Logger) ([]Actor, error) {
 	for rows.Next() {
 		actor := Actor{}
 
-		err := rows.Scan(&actor.ActorId, &actor.Name, &actor.Gender, &actor.BirthDate)
+		err := rows.Scan(&actor.ActorId, &actor.Name, &actor.Gender, &actor.BirthDate, &actor.DeletedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -53,14 +65,15 @@ func GetAllActorsFromStorage(s *Storage, log *slog.Logger) ([]Actor, error) {
 }
 
 // для получения списка фильмов актёра
-func filmsForActor(s *Storage, actorID int) ([]string, error) {
-	var films []string
+func filmsForActor(s *Storage, actorID int) ([]Ref, error) {
+	films := []Ref{}
 
 	rows, err := s.db.Query(`
-		SELECT Films.Title
+		SELECT Films.FilmId, Films.Title
 		FROM Films
-		JOIN ActorFilm ON Films.FilmId = ActorFilm.FilmId
-		WHERE ActorFilm.ActorId = :id
+		JOIN Credits ON Films.FilmId = Credits.FilmId
+		WHERE Credits.PersonId = :id AND Credits.Role = 'actor' AND Films.DeletedAt IS NULL
+		ORDER BY Credits.CreditId
 	`, 
 	sql.Named("id", actorID))
 	if err != nil {
@@ -69,21 +82,29 @@ func filmsForActor(s *Storage, actorID int) ([]string, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var filmTitle string
-		if err := rows.Scan(&filmTitle); err != nil {
+		var film Ref
+		if err := rows.Scan(&film.Id, &film.Name); err != nil {
 			return nil, err
 		}
-		films = append(films, filmTitle)
+		films = append(films, film)
 	}
 
 	return films, nil
 }
 
 // app.PostActor(log, storage, w, r)
-func PostActorToStorage(s *Storage, actor Actor) error {
+//
+// createMissing разрешает создавать фильмы, которых не нашли по названию
+func PostActorToStorage(s *Storage, actor Actor, createMissing bool) error {
+	_, err := CreateActor(s, actor, createMissing)
+	return err
+}
+
+// CreateActor добавляет актёра и возвращает его ID
+func CreateActor(s *Storage, actor Actor, createMissing bool) (actorID int, err error) {
 	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer func() {
 		if err != nil {
@@ -93,53 +114,49 @@ func PostActorToStorage(s *Storage, actor Actor) error {
 		err = tx.Commit()
 	}()
 
-	result, err := s.db.Exec("INSERT INTO Actors (Name, Gender, BirthDate) VALUES (:Name, :Gender, :BirthDate)",
+	id, err := insertActor(tx, actor, createMissing)
+	if err != nil {
+		return 0, err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditCreate, EntityPerson, id, sql.NullString{})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// добавление актёра с фильмографией внутри уже открытой транзакции
+func insertActor(tx *sql.Tx, actor Actor, createMissing bool) (int64, error) {
+	birthDate, err := dateValue(actor.BirthDate)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO Actors (Name, Gender, BirthDate) VALUES (:Name, :Gender, :BirthDate)",
 	sql.Named("Name", actor.Name),
 	sql.Named("Gender", actor.Gender),
-	sql.Named("BirthDate", actor.BirthDate))
+	sql.Named("BirthDate", birthDate))
 	if err != nil {
-		return err
+		return 0, err
 	}
 	actorID, err := result.LastInsertId()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	for _, movies := range actor.Films {
-		var filmID int64
-		err = tx.QueryRow("SELECT FilmId FROM Films WHERE Title = :Title", sql.Named("Title", movies)).Scan(&filmID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				// Фильм не найден, добавляем новый фильм
-				result, err := tx.Exec("INSERT INTO Films (Title, Description,Rating,ReleaseDate) VALUES (:Title,:Description,:Rating,:ReleaseDate)",
-				 sql.Named("Title", movies),
-				 sql.Named("Description", ""),
-				 sql.Named("Rating", 0),
-				 sql.Named("ReleaseDate", ""),
-				)
-				if err != nil {
-					return err
-				}
-				filmID, err = result.LastInsertId()
-				if err != nil {
-					return err
-				}
-			} else {
-				return err
-			}
-		}
-		_, err = tx.Exec("INSERT INTO ActorFilm (ActorId, FilmId) VALUES (:ActorId, :FilmId)", sql.Named("ActorId", actorID), sql.Named("FilmId", filmID))
-		if err != nil {
-			return err
-		}
+	err = setActorFilms(tx, actorID, actor.Films, createMissing)
+	if err != nil {
+		return 0, err
 	}
 
-    return nil
+	return actorID, nil
 }
 
 // app.GetOneActor(log, storage, w, r)
 func GetOneActorFromStorage(s *Storage, id int, log *slog.Logger) (Actor, error) {
-	row := s.db.QueryRow("SELECT ActorId,Name,Gender,BirthDate FROM Actors WHERE ActorId = :id", sql.Named("id", id))
+	row := s.db.QueryRow("SELECT ActorId,Name,Gender,COALESCE(BirthDate, '') FROM Actors WHERE ActorId = :id AND DeletedAt IS NULL", sql.Named("id", id))
 
 	log.Info("starting get actor from storage")
 
@@ -161,7 +178,7 @@ func GetOneActorFromStorage(s *Storage, id int, log *slog.Logger) (Actor, error)
 }
 
 // 		app.PutOneActor(log, storage, w, r)
-func UpdateActor(s *Storage, actor Actor) error {
+func UpdateActor(s *Storage, actor Actor, createMissing bool) (err error) {
     tx, err := s.db.Begin()
     if err != nil {
         return err
@@ -174,55 +191,56 @@ func UpdateActor(s *Storage, actor Actor) error {
         err = tx.Commit()
     }()
 
-    _, err = tx.Exec("UPDATE Actors SET Name=:Name, Gender=:Gender, BirthDate=:BirthDate WHERE ActorId = :id",
+    before, err := snapshot(tx, s.principal, EntityPerson, int64(actor.ActorId))
+    if err != nil {
+        return err
+    }
+
+    err = updateActor(tx, actor, createMissing)
+    if err != nil {
+        return err
+    }
+
+    err = audit(tx, s.auditPrincipal(), AuditUpdate, EntityPerson, int64(actor.ActorId), before)
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
+// изменение актёра с фильмографией внутри уже открытой транзакции
+func updateActor(tx *sql.Tx, actor Actor, createMissing bool) error {
+    birthDate, err := dateValue(actor.BirthDate)
+    if err != nil {
+        return err
+    }
+
+    result, err := tx.Exec("UPDATE Actors SET Name=:Name, Gender=:Gender, BirthDate=:BirthDate WHERE ActorId = :id AND DeletedAt IS NULL",
         sql.Named("Name", actor.Name),
         sql.Named("Gender", actor.Gender),
-        sql.Named("BirthDate", actor.BirthDate),
+        sql.Named("BirthDate", birthDate),
         sql.Named("id", actor.ActorId))
     if err != nil {
         return err
     }
 
-    _, err = tx.Exec("DELETE FROM ActorFilm WHERE ActorId = :id", sql.Named("id", actor.ActorId))
+    // актёра из корзины сначала нужно восстановить
+    err = requireAffected(result)
     if err != nil {
         return err
     }
 
-    for _, movie := range actor.Films {
-        var filmID int64
-        err = tx.QueryRow("SELECT FilmId FROM Films WHERE Title = :Title", sql.Named("Title", movie)).Scan(&filmID)
-        if err != nil {
-            if err == sql.ErrNoRows {
-				result, err := tx.Exec("INSERT INTO Films (Title, Description,Rating,ReleaseDate) VALUES (:Title,:Description,:Rating,:ReleaseDate)",
-				sql.Named("Title", movie),
-				sql.Named("Description", ""),
-				sql.Named("Rating", 0),
-				sql.Named("ReleaseDate", ""),
-			   	)
-                if err != nil {
-                    return err
-                }
-                filmID, err = result.LastInsertId()
-                if err != nil {
-                    return err
-                }
-            } else {
-                return err
-            }
-        }
-        _, err = tx.Exec("INSERT INTO ActorFilm (ActorId, FilmId) VALUES (:ActorId, :FilmId)",
-            sql.Named("ActorId", actor.ActorId),
-            sql.Named("FilmId", filmID))
-        if err != nil {
-            return err
-        }
+    err = setActorFilms(tx, int64(actor.ActorId), actor.Films, createMissing)
+    if err != nil {
+        return err
     }
 
     return nil
 }
 
 // 		app.DeleteOneActor(log, storage, w, r)
-func DeleteActor(s *Storage, actorID int) error {
+func DeleteActor(s *Storage, actorID int) (err error) {
 	tx, err := s.db.Begin()
     if err != nil {
         return err
@@ -235,12 +253,60 @@ func DeleteActor(s *Storage, actorID int) error {
         err = tx.Commit()
     }()
 
-    _, err = tx.Exec("DELETE FROM ActorFilm WHERE ActorId=:id", sql.Named("id", actorID))
+    before, err := snapshot(tx, s.principal, EntityPerson, int64(actorID))
+    if err != nil {
+        return err
+    }
+
+    // роли в фильмах остаются, чтобы восстановленный актёр вернулся в составы
+    result, err := tx.Exec("UPDATE Actors SET DeletedAt = datetime('now') WHERE ActorId = :id AND DeletedAt IS NULL", sql.Named("id", actorID))
+    if err != nil {
+        return err
+    }
+
+    err = requireAffected(result)
+    if err != nil {
+        return err
+    }
+
+    err = audit(tx, s.auditPrincipal(), AuditDelete, EntityPerson, int64(actorID), before)
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
+// app.PostActorRestore(log, storage, w, r)
+func RestoreActor(s *Storage, actorID int) (err error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer func() {
+        if err != nil {
+            tx.Rollback()
+            return
+        }
+        err = tx.Commit()
+    }()
+
+    before, err := snapshot(tx, s.principal, EntityPerson, int64(actorID))
+    if err != nil {
+        return err
+    }
+
+    result, err := tx.Exec("UPDATE Actors SET DeletedAt = NULL WHERE ActorId = :id AND DeletedAt IS NOT NULL", sql.Named("id", actorID))
+    if err != nil {
+        return err
+    }
+
+    err = requireAffected(result)
     if err != nil {
         return err
     }
 
-    _, err = tx.Exec("DELETE FROM Actors WHERE ActorId=:id", sql.Named("id", actorID))
+    err = audit(tx, s.auditPrincipal(), AuditRestore, EntityPerson, int64(actorID), before)
     if err != nil {
         return err
     }
@@ -248,4 +314,29 @@ func DeleteActor(s *Storage, actorID int) error {
     return nil
 }
 
+// purgeActor окончательно удаляет человека вместе с его ролями
+func purgeActor(tx *sql.Tx, actorID int64) error {
+	_, err := tx.Exec("DELETE FROM Credits WHERE PersonId=:id", sql.Named("id", actorID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Aliases WHERE EntityType = 'person' AND TargetId = :id", sql.Named("id", actorID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Revisions WHERE EntityType = 'person' AND EntityId = :id", sql.Named("id", actorID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Actors WHERE ActorId=:id", sql.Named("id", actorID))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 
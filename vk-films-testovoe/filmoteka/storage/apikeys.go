@@ -0,0 +1,182 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// APIKey - ключ API для сервиса. Сам ключ не хранится, Key заполняется только при создании,
+// Prefix - его начало, чтобы узнать ключ в списке. Времена - UTC, yyyy-mm-dd hh:mm:ss
+type APIKey struct {
+	KeyId       int      `json:"id"`
+	Name        string   `json:"name"`
+	Prefix      string   `json:"prefix"`
+	Permissions []string `json:"permissions"`
+	CreatedBy   string   `json:"createdBy"`
+	CreatedAt   string   `json:"createdAt"`
+	ExpiresAt   string   `json:"expiresAt,omitempty"`
+	LastUsedAt  string   `json:"lastUsedAt,omitempty"`
+	RevokedAt   string   `json:"revokedAt,omitempty"`
+	Key         string   `json:"key,omitempty"`
+}
+
+var ErrAPIKeyExists = errors.New("api key with this name already exists")
+
+const apiKeyColumns = `
+	KeyId, Name, Prefix, Permissions, CreatedBy, CreatedAt,
+	COALESCE(ExpiresAt, ''), COALESCE(LastUsedAt, ''), COALESCE(RevokedAt, '')`
+
+// активный ключ: не отозван и не истёк
+const apiKeyActive = "RevokedAt IS NULL AND (ExpiresAt IS NULL OR ExpiresAt > datetime('now'))"
+
+func scanAPIKey(row scanner) (APIKey, error) {
+	var key APIKey
+	var permissions string
+	err := row.Scan(&key.KeyId, &key.Name, &key.Prefix, &permissions, &key.CreatedBy, &key.CreatedAt,
+		&key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	err = json.Unmarshal([]byte(permissions), &key.Permissions)
+	return key, err
+}
+
+// app.GetAPIKeys(log, storage, w, r)
+func ListAPIKeys(s *Storage) ([]APIKey, error) {
+	rows, err := s.db.Query("SELECT" + apiKeyColumns + " FROM ApiKeys ORDER BY KeyId")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// app.GetOneAPIKey(log, storage, w, r)
+func GetAPIKey(s *Storage, id int) (APIKey, error) {
+	return scanAPIKey(s.db.QueryRow("SELECT"+apiKeyColumns+" FROM ApiKeys WHERE KeyId = :id", sql.Named("id", id)))
+}
+
+// ActiveAPIKey возвращает активный ключ по хешу, sql.ErrNoRows - если такого нет, он отозван или истёк
+func ActiveAPIKey(s *Storage, hash string) (APIKey, error) {
+	return scanAPIKey(s.db.QueryRow("SELECT"+apiKeyColumns+" FROM ApiKeys WHERE Hash = :hash AND "+apiKeyActive,
+		sql.Named("hash", hash)))
+}
+
+// ActiveAPIKeyByName возвращает активный ключ по имени, sql.ErrNoRows - если такого нет
+func ActiveAPIKeyByName(s *Storage, name string) (APIKey, error) {
+	return scanAPIKey(s.db.QueryRow("SELECT"+apiKeyColumns+" FROM ApiKeys WHERE Name = :name AND "+apiKeyActive,
+		sql.Named("name", name)))
+}
+
+// app.PostAPIKey(log, storage, w, r)
+//
+// hash - хеш ключа, см. verify.HashKey. Имя занято, пока ключ с ним не отозван.
+func CreateAPIKey(s *Storage, key APIKey, hash string) (keyID int, err error) {
+	permissions, err := json.Marshal(key.Permissions)
+	if err != nil {
+		return 0, err
+	}
+
+	var expiresAt any
+	if key.ExpiresAt != "" {
+		expiresAt = key.ExpiresAt
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	result, err := tx.Exec(`
+		INSERT INTO ApiKeys (Name, Prefix, Hash, Permissions, CreatedBy, CreatedAt, ExpiresAt)
+		SELECT :name, :prefix, :hash, :permissions, :createdBy, datetime('now'), :expiresAt
+		WHERE NOT EXISTS (SELECT 1 FROM ApiKeys WHERE Name = :name AND RevokedAt IS NULL)
+	`,
+		sql.Named("name", key.Name),
+		sql.Named("prefix", key.Prefix),
+		sql.Named("hash", hash),
+		sql.Named("permissions", string(permissions)),
+		sql.Named("createdBy", s.auditPrincipal()),
+		sql.Named("expiresAt", expiresAt))
+	if err != nil {
+		return 0, err
+	}
+
+	if err = requireAffected(result); err != nil {
+		return 0, ErrAPIKeyExists
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditCreate, EntityAPIKey, id, sql.NullString{})
+	return int(id), err
+}
+
+// app.DeleteOneAPIKey(log, storage, w, r)
+//
+// Отозванный ключ остаётся в списке, sql.ErrNoRows - если ключа нет или он уже отозван.
+func RevokeAPIKey(s *Storage, id int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, s.principal, EntityAPIKey, int64(id))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE ApiKeys SET RevokedAt = datetime('now')
+		WHERE KeyId = :id AND RevokedAt IS NULL
+	`, sql.Named("id", id))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, s.auditPrincipal(), AuditDelete, EntityAPIKey, int64(id), before)
+}
+
+// TouchAPIKey отмечает использование ключа. Время обновляется не чаще раза в минуту,
+// чтобы каждый запрос по ключу не был записью в базу
+func TouchAPIKey(s *Storage, id int) error {
+	_, err := s.db.Exec(`
+		UPDATE ApiKeys SET LastUsedAt = datetime('now')
+		WHERE KeyId = :id AND (LastUsedAt IS NULL OR LastUsedAt < datetime('now', '-1 minute'))
+	`, sql.Named("id", id))
+	return err
+}
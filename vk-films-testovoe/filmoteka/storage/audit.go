@@ -0,0 +1,234 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	// восстановление из корзины и окончательное удаление из неё
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+	// запись старой версии поверх текущей
+	AuditRevert = "revert"
+	// дубль слит с другой записью и удалён
+	AuditMerge = "merge"
+
+	EntityFilm      = "film"
+	EntityPerson    = "person"
+	EntityGenre     = "genre"
+	EntityReview    = "review"
+	EntityRating    = "rating"
+	EntityWatchlist = "watchlist"
+	EntityWatched   = "watched"
+	EntityWebhook   = "webhook"
+	EntityAPIKey    = "apiKey"
+
+	// от имени system пишут команды без пользователя: импорт из консоли, восстановление
+	SystemPrincipal = "system"
+)
+
+// снимки сущностей для AuditLog собираются в SQL внутри транзакции изменения.
+// Личные записи (оценка, списки) принадлежат :login, их id - id фильма.
+var auditSnapshots = map[string]string{
+	EntityFilm: `
+		SELECT json_object(
+			'id', FilmId, 'title', Title, 'description', Description,
+			'criticRating', Rating, 'releaseDate', ReleaseDate, 'deletedAt', DeletedAt,
+			'genres', json((SELECT json_group_array(Genres.Name ORDER BY Genres.Name)
+				FROM FilmGenre JOIN Genres ON Genres.GenreId = FilmGenre.GenreId
+				WHERE FilmGenre.FilmId = Films.FilmId)),
+			'credits', json((SELECT json_group_array(json_object(
+					'personId', PersonId, 'role', Role, 'character', Character, 'job', Job, 'position', Position)
+					ORDER BY Role, Position)
+				FROM Credits WHERE Credits.FilmId = Films.FilmId)))
+		FROM Films WHERE FilmId = :id`,
+	EntityPerson: `
+		SELECT json_object(
+			'id', ActorId, 'name', Name, 'gender', Gender, 'birthdate', BirthDate, 'deletedAt', DeletedAt,
+			'credits', json((SELECT json_group_array(json_object(
+					'filmId', FilmId, 'role', Role, 'character', Character, 'job', Job, 'position', Position)
+					ORDER BY FilmId, Role)
+				FROM Credits WHERE Credits.PersonId = Actors.ActorId)))
+		FROM Actors WHERE ActorId = :id`,
+	EntityGenre: `
+		SELECT json_object('id', GenreId, 'name', Name)
+		FROM Genres WHERE GenreId = :id`,
+	EntityReview: `
+		SELECT json_object('id', ReviewId, 'filmId', FilmId, 'login', Login, 'text', Text, 'status', Status)
+		FROM Reviews WHERE ReviewId = :id`,
+	EntityRating: `
+		SELECT json_object('filmId', FilmId, 'login', Login, 'rating', Rating)
+		FROM UserRatings WHERE FilmId = :id AND Login = :login`,
+	EntityWatchlist: `
+		SELECT json_object('filmId', FilmId, 'login', Login, 'note', Note)
+		FROM Watchlist WHERE FilmId = :id AND Login = :login`,
+	EntityWatched: `
+		SELECT json_object('filmId', FilmId, 'login', Login, 'note', Note, 'watchedAt', WatchedAt)
+		FROM Watched WHERE FilmId = :id AND Login = :login`,
+	// секрет подписки в журнал не попадает
+	EntityWebhook: `
+		SELECT json_object('id', WebhookId, 'url', URL, 'events', json(Events), 'active', json(CASE WHEN Active THEN 'true' ELSE 'false' END))
+		FROM Webhooks WHERE WebhookId = :id`,
+	// хеш ключа в журнал не попадает
+	EntityAPIKey: `
+		SELECT json_object('id', KeyId, 'name', Name, 'prefix', Prefix, 'permissions', json(Permissions),
+			'createdBy', CreatedBy, 'expiresAt', ExpiresAt, 'revokedAt', RevokedAt)
+		FROM ApiKeys WHERE KeyId = :id`,
+}
+
+type AuditEntry struct {
+	AuditId    int             `json:"id"`
+	Principal  string          `json:"principal"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entityType"`
+	EntityId   int             `json:"entityId"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  string          `json:"createdAt"`
+}
+
+// AuditFilter ограничивает выборку в GetAuditLogFromStorage, пустые поля не фильтруют.
+// From и To - границы в формате "2006-01-02 15:04:05" UTC, как в CreatedAt.
+type AuditFilter struct {
+	Principal  string
+	EntityType string
+	EntityId   int
+	From       string
+	To         string
+}
+
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Page    int          `json:"page"`
+	Limit   int          `json:"limit"`
+	Total   int          `json:"total"`
+}
+
+func ValidEntityType(entity string) bool {
+	_, ok := auditSnapshots[entity]
+	return ok
+}
+
+// As возвращает хранилище, которое записывает изменения в AuditLog от имени login
+func (s *Storage) As(login string) *Storage {
+	c := *s
+	c.principal = login
+	return &c
+}
+
+func (s *Storage) auditPrincipal() string {
+	if s.principal == "" {
+		return SystemPrincipal
+	}
+	return s.principal
+}
+
+// snapshot возвращает сущность в виде JSON или NULL, если её нет
+func snapshot(tx *sql.Tx, login, entity string, id int64) (sql.NullString, error) {
+	query, ok := auditSnapshots[entity]
+	if !ok {
+		return sql.NullString{}, fmt.Errorf("unknown entity type %q", entity)
+	}
+
+	var res sql.NullString
+	err := tx.QueryRow(query, sql.Named("id", id), sql.Named("login", login)).Scan(&res)
+	if err == sql.ErrNoRows {
+		return sql.NullString{}, nil
+	}
+	return res, err
+}
+
+// audit записывает изменение в той же транзакции, что и само изменение.
+// before снимается до изменения, снимок после делается здесь.
+func audit(tx *sql.Tx, principal, action, entity string, id int64, before sql.NullString) error {
+	after, err := snapshot(tx, principal, entity, id)
+	if err != nil {
+		return err
+	}
+	// изменение не затронуло ни одной записи
+	if !before.Valid && !after.Valid {
+		return nil
+	}
+
+	if action == AuditUpdate || action == AuditRevert {
+		err = saveRevision(tx, principal, entity, id, before, after)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = outbox(tx, action, entity, id, before, after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO AuditLog (Principal, Action, EntityType, EntityId, Before, After, CreatedAt)
+		VALUES (:principal, :action, :entity, :id, :before, :after, datetime('now'))
+	`,
+		sql.Named("principal", principal),
+		sql.Named("action", action),
+		sql.Named("entity", entity),
+		sql.Named("id", id),
+		sql.Named("before", before),
+		sql.Named("after", after))
+	return err
+}
+
+// app.GetAuditLog(log, storage, w, r)
+func GetAuditLogFromStorage(s *Storage, filter AuditFilter, page, limit int) (AuditPage, error) {
+	res := AuditPage{Entries: []AuditEntry{}, Page: page, Limit: limit}
+
+	where := `
+		WHERE (:principal = '' OR Principal = :principal)
+			AND (:entity = '' OR EntityType = :entity)
+			AND (:id = 0 OR EntityId = :id)
+			AND (:from = '' OR CreatedAt >= :from)
+			AND (:to = '' OR CreatedAt < :to)`
+	args := []any{
+		sql.Named("principal", filter.Principal),
+		sql.Named("entity", filter.EntityType),
+		sql.Named("id", filter.EntityId),
+		sql.Named("from", filter.From),
+		sql.Named("to", filter.To),
+	}
+
+	err := s.db.QueryRow("SELECT COUNT(*) FROM AuditLog"+where, args...).Scan(&res.Total)
+	if err != nil {
+		return AuditPage{}, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT AuditId, Principal, Action, EntityType, EntityId, COALESCE(Before, 'null'), COALESCE(After, 'null'), CreatedAt
+		FROM AuditLog`+where+`
+		ORDER BY AuditId DESC
+		LIMIT :limit OFFSET :offset
+	`, append(args, sql.Named("limit", limit), sql.Named("offset", (page-1)*limit))...)
+	if err != nil {
+		return AuditPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after string
+		err := rows.Scan(&entry.AuditId, &entry.Principal, &entry.Action, &entry.EntityType, &entry.EntityId, &before, &after, &entry.CreatedAt)
+		if err != nil {
+			return AuditPage{}, err
+		}
+		entry.Before = json.RawMessage(before)
+		entry.After = json.RawMessage(after)
+		res.Entries = append(res.Entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return AuditPage{}, err
+	}
+
+	return res, nil
+}
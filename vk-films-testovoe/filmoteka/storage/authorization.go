@@ -1,5 +1,11 @@
 package sqlite
 
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
 func GetUsers(s *Storage) (map[string]string, error) {
 	rows, err := s.db.Query("SELECT Login, Password FROM Users")
 	a := make(map[string]string)
@@ -26,3 +32,89 @@ func GetUsers(s *Storage) (map[string]string, error) {
 
 	return a, nil
 }
+
+type User struct {
+	Login string `json:"login"`
+	Role  string `json:"role"`
+	// хеш пароля не выдаётся наружу
+	Password string `json:"-"`
+}
+
+// запросы по ключу API выполняются под логином KeyLoginPrefix + имя ключа, поэтому у пользователей таких логинов нет
+const KeyLoginPrefix = "key/"
+
+var (
+	ErrUserExists    = errors.New("user already exists")
+	ErrReservedLogin = errors.New(`logins starting with "` + KeyLoginPrefix + `" are reserved for api keys`)
+)
+
+// GetUser возвращает пользователя с хешем пароля, sql.ErrNoRows - если его нет
+func GetUser(s *Storage, login string) (User, error) {
+	user := User{Login: login}
+	err := s.db.QueryRow("SELECT Password, Role FROM Users WHERE Login = :login", sql.Named("login", login)).
+		Scan(&user.Password, &user.Role)
+	return user, err
+}
+
+func ListUsers(s *Storage) ([]User, error) {
+	rows, err := s.db.Query("SELECT Login, Role FROM Users ORDER BY Login")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.Login, &user.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// CreateUser добавляет пользователя, user.Password - уже посчитанный хеш, см. verify.HashPassword.
+// Логины с KeyLoginPrefix заняты ключами API
+func CreateUser(s *Storage, user User) error {
+	if strings.HasPrefix(user.Login, KeyLoginPrefix) {
+		return ErrReservedLogin
+	}
+
+	_, err := GetUser(s, user.Login)
+	if err == nil {
+		return ErrUserExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = s.db.Exec("INSERT INTO Users (Login, Password, Role) VALUES (:login, :password, :role)",
+		sql.Named("login", user.Login),
+		sql.Named("password", user.Password),
+		sql.Named("role", user.Role))
+	return err
+}
+
+// SetUserPassword меняет хеш пароля, sql.ErrNoRows - если пользователя нет
+func SetUserPassword(s *Storage, login, password string) error {
+	result, err := s.db.Exec("UPDATE Users SET Password = :password WHERE Login = :login",
+		sql.Named("password", password),
+		sql.Named("login", login))
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// SetUserRole меняет роль, sql.ErrNoRows - если пользователя нет
+func SetUserRole(s *Storage, login, role string) error {
+	result, err := s.db.Exec("UPDATE Users SET Role = :role WHERE Login = :login",
+		sql.Named("role", role),
+		sql.Named("login", login))
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
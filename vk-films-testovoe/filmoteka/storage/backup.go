@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	backupPrefix = "filmoteka-"
+	backupSuffix = ".db"
+)
+
+// Backup делает согласованную копию базы через VACUUM INTO, не останавливая запись.
+// Копия сначала пишется во временный файл, так что по path никогда не лежит недописанный файл.
+func Backup(s *Storage, path string) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	_, err := s.db.Exec("VACUUM INTO :path", sql.Named("path", tmp))
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// BackupToDir сохраняет копию в dir под именем с текущим временем и возвращает путь к ней.
+// Время в имени с наносекундами, чтобы копии, сделанные в одну секунду, не затирали друг друга.
+func BackupToDir(s *Storage, dir string) (string, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	name := backupPrefix + time.Now().UTC().Format("20060102-150405.000000000") + backupSuffix
+	path := filepath.Join(dir, name)
+
+	return path, Backup(s, path)
+}
+
+// PruneBackups оставляет в dir только keep самых новых копий. keep <= 0 хранит все
+func PruneBackups(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	// время в имени файла сортируется так же, как строки
+	sort.Strings(paths)
+
+	removed := []string{}
+	for len(paths) > keep {
+		err = os.Remove(paths[0])
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, paths[0])
+		paths = paths[1:]
+	}
+
+	return removed, nil
+}
+
+// CheckBackup проверяет, что файл - целая база фильмотеки, которую этот код сможет открыть.
+// Возвращает версию схемы копии; более старые версии догоняются миграциями при запуске.
+func CheckBackup(path string) (int, error) {
+	// sql.Open создал бы пустую базу на месте отсутствующего файла
+	_, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var check string
+	err = db.QueryRow("PRAGMA quick_check").Scan(&check)
+	if err != nil {
+		return 0, err
+	}
+	if check != "ok" {
+		return 0, fmt.Errorf("backup is damaged: %s", check)
+	}
+
+	var version int
+	err = db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	if version > SchemaVersion() {
+		return version, fmt.Errorf("backup schema version %d is newer than supported %d", version, SchemaVersion())
+	}
+
+	var tables int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('Films', 'Actors', 'Users')").Scan(&tables)
+	if err != nil {
+		return version, err
+	}
+	if tables != 3 {
+		return version, fmt.Errorf("%s is not a filmoteka storage", path)
+	}
+
+	return version, nil
+}
+
+// Restore заменяет базу storagePath копией из backupPath.
+// Сервер должен быть остановлен. Прежняя база остаётся рядом с суффиксом .before-restore.
+func Restore(backupPath, storagePath string) error {
+	_, err := CheckBackup(backupPath)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", backupPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// копия собирается рядом с базой, чтобы переименование было атомарным
+	tmp := storagePath + ".restore"
+	os.Remove(tmp)
+
+	_, err = db.Exec("VACUUM INTO :path", sql.Named("path", tmp))
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	_, err = os.Stat(storagePath)
+	if err == nil {
+		err = os.Rename(storagePath, storagePath+".before-restore")
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	// журнал прежней базы уходит вместе с ней, чтобы не примениться к восстановленной
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		os.Rename(storagePath+suffix, storagePath+".before-restore"+suffix)
+	}
+
+	return os.Rename(tmp, storagePath)
+}
@@ -0,0 +1,177 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+// CastMember - параметры одной записи в актёрском составе фильма
+type CastMember struct {
+	Character string `json:"character"`
+	Position  int    `json:"position"`
+}
+
+// перенумеровывает актёрский состав фильма подряд начиная с единицы
+func compactCast(tx *sql.Tx, filmID int) error {
+	_, err := tx.Exec(`
+		UPDATE Credits SET Position = ordered.rn
+		FROM (
+			SELECT CreditId, ROW_NUMBER() OVER (ORDER BY Position, CreditId) AS rn
+			FROM Credits
+			WHERE FilmId = :id AND Role = 'actor'
+		) AS ordered
+		WHERE ordered.CreditId = Credits.CreditId
+	`, sql.Named("id", filmID))
+	return err
+}
+
+// перенумеровывает участников фильма подряд начиная с единицы, отдельно в каждой роли
+func compactCredits(tx *sql.Tx, filmID int) error {
+	_, err := tx.Exec(`
+		UPDATE Credits SET Position = ordered.rn
+		FROM (
+			SELECT CreditId, ROW_NUMBER() OVER (PARTITION BY Role ORDER BY Position, CreditId) AS rn
+			FROM Credits
+			WHERE FilmId = :id
+		) AS ordered
+		WHERE ordered.CreditId = Credits.CreditId
+	`, sql.Named("id", filmID))
+	return err
+}
+
+// app.PostCastMember(log, storage, w, r)
+//
+// SetCastMember добавляет актёра в состав фильма или переносит его на новую позицию.
+// Позиция 0 или больше размера состава ставит актёра в конец списка.
+func SetCastMember(s *Storage, filmID, actorID int, member CastMember) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	var exists int
+	err = tx.QueryRow("SELECT (SELECT COUNT(*) FROM Films WHERE FilmId = :film AND DeletedAt IS NULL) * (SELECT COUNT(*) FROM Actors WHERE ActorId = :actor AND DeletedAt IS NULL)",
+		sql.Named("film", filmID),
+		sql.Named("actor", actorID)).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	before, err := snapshot(tx, s.principal, EntityFilm, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	var character string
+	err = tx.QueryRow("SELECT Character FROM Credits WHERE FilmId = :film AND PersonId = :actor AND Role = 'actor'",
+		sql.Named("film", filmID),
+		sql.Named("actor", actorID)).Scan(&character)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if member.Character == "" {
+		member.Character = character
+	}
+
+	_, err = tx.Exec("DELETE FROM Credits WHERE FilmId = :film AND PersonId = :actor AND Role = 'actor'",
+		sql.Named("film", filmID),
+		sql.Named("actor", actorID))
+	if err != nil {
+		return err
+	}
+
+	err = compactCast(tx, filmID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM Credits WHERE FilmId = :film AND Role = 'actor'", sql.Named("film", filmID)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if member.Position <= 0 || member.Position > count+1 {
+		member.Position = count + 1
+	}
+
+	_, err = tx.Exec("UPDATE Credits SET Position = Position + 1 WHERE FilmId = :film AND Role = 'actor' AND Position >= :pos",
+		sql.Named("film", filmID),
+		sql.Named("pos", member.Position))
+	if err != nil {
+		return err
+	}
+
+	err = insertCredit(tx, int64(filmID), int64(actorID), Credit{
+		Role:      RoleActor,
+		Character: member.Character,
+		Position:  member.Position,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditUpdate, EntityFilm, int64(filmID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.DeleteCastMember(log, storage, w, r)
+func DeleteCastMember(s *Storage, filmID, actorID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, s.principal, EntityFilm, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM Credits WHERE FilmId = :film AND PersonId = :actor AND Role = 'actor'",
+		sql.Named("film", filmID),
+		sql.Named("actor", actorID))
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	err = compactCast(tx, filmID)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditUpdate, EntityFilm, int64(filmID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
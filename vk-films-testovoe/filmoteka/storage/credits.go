@@ -0,0 +1,321 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	RoleActor    = "actor"
+	RoleDirector = "director"
+	RoleWriter   = "writer"
+	RoleComposer = "composer"
+	RoleProducer = "producer"
+)
+
+var roles = []string{RoleActor, RoleDirector, RoleWriter, RoleComposer, RoleProducer}
+
+// Credit связывает человека с фильмом в определённой роли.
+// Для актёров заполняется Character, для съёмочной группы Job.
+type Credit struct {
+	PersonId  int    `json:"personId,omitempty"`
+	Name      string `json:"name,omitempty"`
+	FilmId    int    `json:"filmId,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Role      string `json:"role"`
+	Character string `json:"character,omitempty"`
+	Job       string `json:"job,omitempty"`
+	Position  int    `json:"position"`
+}
+
+func ValidRole(role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// все участники фильма, актёры идут первыми
+func creditsForFilm(s *Storage, filmID int) ([]Credit, error) {
+	credits := []Credit{}
+
+	rows, err := s.db.Query(`
+		SELECT Credits.PersonId, Actors.Name, Credits.Role, Credits.Character, Credits.Job, Credits.Position
+		FROM Credits
+		JOIN Actors ON Actors.ActorId = Credits.PersonId
+		WHERE Credits.FilmId = :id AND Actors.DeletedAt IS NULL
+		ORDER BY Credits.Role <> 'actor', Credits.Role, Credits.Position
+	`,
+		sql.Named("id", filmID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var credit Credit
+		if err := rows.Scan(&credit.PersonId, &credit.Name, &credit.Role, &credit.Character, &credit.Job, &credit.Position); err != nil {
+			return nil, err
+		}
+		credits = append(credits, credit)
+	}
+
+	return credits, rows.Err()
+}
+
+// фильмография человека во всех ролях
+func creditsForPerson(s *Storage, personID int) ([]Credit, error) {
+	credits := []Credit{}
+
+	rows, err := s.db.Query(`
+		SELECT Credits.FilmId, Films.Title, Credits.Role, Credits.Character, Credits.Job, Credits.Position
+		FROM Credits
+		JOIN Films ON Films.FilmId = Credits.FilmId
+		WHERE Credits.PersonId = :id AND Films.DeletedAt IS NULL
+		ORDER BY Films.ReleaseDate, Films.Title
+	`,
+		sql.Named("id", personID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var credit Credit
+		if err := rows.Scan(&credit.FilmId, &credit.Title, &credit.Role, &credit.Character, &credit.Job, &credit.Position); err != nil {
+			return nil, err
+		}
+		credits = append(credits, credit)
+	}
+
+	return credits, rows.Err()
+}
+
+// Ref - ссылка на связанную запись: актёра в фильме или фильм у актёра.
+// При записи связь ищется по Id, поиск по Name допускается только если имя однозначно.
+type Ref struct {
+	Id   int    `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+var (
+	ErrUnknownRef   = errors.New("referenced record not found")
+	ErrAmbiguousRef = errors.New("name matches several records, use id")
+)
+
+// resolveRef находит запись по ссылке. Если записи с таким именем нет и
+// createMissing выключен - возвращается ErrUnknownRef, иначе create создаёт её.
+func resolveRef(tx *sql.Tx, ref Ref, byID, byName string, createMissing bool, create func() (sql.Result, error)) (int64, error) {
+	if ref.Id != 0 {
+		var id int64
+		err := tx.QueryRow(byID, sql.Named("id", ref.Id)).Scan(&id)
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("id %d: %w", ref.Id, ErrUnknownRef)
+		}
+		return id, err
+	}
+
+	rows, err := tx.Query(byName, sql.Named("name", ref.Name))
+	if err != nil {
+		return 0, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case len(ids) == 1:
+		return ids[0], nil
+	case len(ids) > 1:
+		return 0, fmt.Errorf("%q: %w", ref.Name, ErrAmbiguousRef)
+	case !createMissing:
+		return 0, fmt.Errorf("%q: %w", ref.Name, ErrUnknownRef)
+	}
+
+	result, err := create()
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// aliasedID - выражение для :id с учётом слияний: сама запись, если она есть,
+// иначе запись, с которой слит дубль с этим ID
+func aliasedID(table, column, entity string) string {
+	return "COALESCE((SELECT " + column + " FROM " + table + " WHERE " + column + " = :id), " +
+		"(SELECT TargetId FROM Aliases WHERE EntityType = '" + entity + "' AND AliasId = :id))"
+}
+
+// поиск человека по ссылке, при createMissing создаётся пустая запись
+func resolvePerson(tx *sql.Tx, ref Ref, createMissing bool) (int64, error) {
+	return resolveRef(tx, ref,
+		"SELECT ActorId FROM Actors WHERE ActorId = "+aliasedID("Actors", "ActorId", EntityPerson)+" AND DeletedAt IS NULL",
+		"SELECT ActorId FROM Actors WHERE Name = :name AND DeletedAt IS NULL",
+		createMissing,
+		func() (sql.Result, error) {
+			return tx.Exec("INSERT INTO Actors (Name,Gender,BirthDate) VALUES (:Name,:Gender,:BirthDate)",
+				sql.Named("Name", ref.Name),
+				sql.Named("Gender", ""),
+				sql.Named("BirthDate", nil),
+			)
+		})
+}
+
+// поиск фильма по ссылке, при createMissing создаётся пустая запись
+func resolveFilm(tx *sql.Tx, ref Ref, createMissing bool) (int64, error) {
+	return resolveRef(tx, ref,
+		"SELECT FilmId FROM Films WHERE FilmId = "+aliasedID("Films", "FilmId", EntityFilm)+" AND DeletedAt IS NULL",
+		"SELECT FilmId FROM Films WHERE Title = :name AND DeletedAt IS NULL",
+		createMissing,
+		func() (sql.Result, error) {
+			return tx.Exec("INSERT INTO Films (Title, Description,Rating,ReleaseDate) VALUES (:Title,:Description,:Rating,:ReleaseDate)",
+				sql.Named("Title", ref.Name),
+				sql.Named("Description", ""),
+				sql.Named("Rating", 0),
+				sql.Named("ReleaseDate", nil),
+			)
+		})
+}
+
+// insertCredit добавляет или обновляет участие человека в фильме.
+// Нулевая позиция означает "в конец списка этой роли" для нового участия
+// и "на прежнем месте" для уже существующего.
+func insertCredit(tx *sql.Tx, filmID, personID int64, credit Credit) error {
+	_, err := tx.Exec(`
+		INSERT INTO Credits (FilmId, PersonId, Role, Character, Job, Position)
+		VALUES (:FilmId, :PersonId, :Role, :Character, :Job,
+			CASE WHEN :Position > 0 THEN :Position
+			ELSE (SELECT COALESCE(MAX(Position), 0) + 1 FROM Credits WHERE FilmId = :FilmId AND Role = :Role) END)
+		ON CONFLICT (FilmId, PersonId, Role) DO UPDATE SET
+			Character = excluded.Character,
+			Job = excluded.Job,
+			Position = CASE WHEN :Position > 0 THEN excluded.Position ELSE Position END
+	`,
+		sql.Named("FilmId", filmID),
+		sql.Named("PersonId", personID),
+		sql.Named("Role", credit.Role),
+		sql.Named("Character", credit.Character),
+		sql.Named("Job", credit.Job),
+		sql.Named("Position", credit.Position))
+	return err
+}
+
+// setFilmCredits заменяет состав фильма: сначала актёры из списка ссылок,
+// затем структурированные credits, которые могут уточнить персонажа и позицию
+func setFilmCredits(tx *sql.Tx, filmID int64, actors []Ref, credits []Credit, createMissing bool) error {
+	_, err := tx.Exec("DELETE FROM Credits WHERE FilmId = :id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	for i, actor := range actors {
+		personID, err := resolvePerson(tx, actor, createMissing)
+		if err != nil {
+			return err
+		}
+		err = insertCredit(tx, filmID, personID, Credit{Role: RoleActor, Position: i + 1})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, credit := range credits {
+		if credit.Role == "" {
+			credit.Role = RoleActor
+		}
+
+		personID, err := resolvePerson(tx, Ref{Id: credit.PersonId, Name: credit.Name}, createMissing)
+		if err != nil {
+			return err
+		}
+
+		err = insertCredit(tx, filmID, personID, credit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setActorFilms оставляет актёру только перечисленные фильмы,
+// не трогая персонажей в уже существующих связях и другие роли
+func setActorFilms(tx *sql.Tx, actorID int64, films []Ref, createMissing bool) error {
+	ids := []int64{}
+	for _, film := range films {
+		filmID, err := resolveFilm(tx, film, createMissing)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO Credits (FilmId, PersonId, Role, Position)
+			VALUES (:FilmId, :PersonId, 'actor',
+				(SELECT COALESCE(MAX(Position), 0) + 1 FROM Credits WHERE FilmId = :FilmId AND Role = 'actor'))
+		`,
+			sql.Named("FilmId", filmID),
+			sql.Named("PersonId", actorID))
+		if err != nil {
+			return err
+		}
+		ids = append(ids, filmID)
+	}
+
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT FilmId FROM Credits WHERE PersonId = :id AND Role = 'actor'
+		AND FilmId NOT IN (SELECT value FROM json_each(:ids))`,
+		sql.Named("id", actorID),
+		sql.Named("ids", string(idsJSON)))
+	if err != nil {
+		return err
+	}
+	removed := []int{}
+	for rows.Next() {
+		var filmID int
+		if err := rows.Scan(&filmID); err != nil {
+			rows.Close()
+			return err
+		}
+		removed = append(removed, filmID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM Credits WHERE PersonId = :id AND Role = 'actor'
+		AND FilmId NOT IN (SELECT value FROM json_each(:ids))`,
+		sql.Named("id", actorID),
+		sql.Named("ids", string(idsJSON)))
+	if err != nil {
+		return err
+	}
+
+	// в составе фильмов, из которых ушёл актёр, не остаётся пропусков в позициях
+	for _, filmID := range removed {
+		err = compactCast(tx, filmID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
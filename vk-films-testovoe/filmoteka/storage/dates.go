@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidDate = errors.New("invalid date")
+
+// dateLayouts - принимаемые форматы дат и ISO 8601, в котором дата хранится.
+// Неполные даты нужны для старых фильмов, у которых известен только год или месяц.
+var dateLayouts = []struct {
+	input string
+	iso   string
+}{
+	{"2006-01-02", "2006-01-02"},
+	{"2006-01", "2006-01"},
+	{"2006", "2006"},
+	// прежний формат API
+	{"02.01.2006", "2006-01-02"},
+	{"01.2006", "2006-01"},
+}
+
+// NormalizeDate приводит дату к ISO 8601: YYYY-MM-DD, YYYY-MM или YYYY.
+// Даты в прежнем формате DD.MM.YYYY тоже принимаются.
+func NormalizeDate(date string) (string, error) {
+	date = strings.TrimSpace(date)
+	for _, layout := range dateLayouts {
+		if len(date) != len(layout.input) {
+			continue
+		}
+		t, err := time.Parse(layout.input, date)
+		if err == nil {
+			return t.Format(layout.iso), nil
+		}
+	}
+	return "", fmt.Errorf("%q: %w", date, ErrInvalidDate)
+}
+
+// dateValue - значение даты для записи: пустая дата хранится как NULL
+func dateValue(date string) (any, error) {
+	if strings.TrimSpace(date) == "" {
+		return nil, nil
+	}
+	return NormalizeDate(date)
+}
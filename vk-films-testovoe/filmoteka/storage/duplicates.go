@@ -0,0 +1,175 @@
+package sqlite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// виды записей, среди которых ищутся дубли
+const (
+	DuplicatePeople = "people"
+	DuplicateFilms  = "films"
+)
+
+var duplicateSources = map[string]string{
+	DuplicatePeople: "SELECT ActorId, COALESCE(Name, ''), COALESCE(BirthDate, '') FROM Actors WHERE DeletedAt IS NULL",
+	DuplicateFilms:  "SELECT FilmId, COALESCE(Title, ''), COALESCE(ReleaseDate, '') FROM Films WHERE DeletedAt IS NULL",
+}
+
+// кириллица записывается латиницей так, как имена обычно пишут в английских источниках
+var transliteration = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+type DuplicateRecord struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// DuplicatePair - две записи, которые, вероятно, описывают одно и то же.
+// Score от 0 до 1: 1 - нормализованные имена совпадают.
+type DuplicatePair struct {
+	Kind     string          `json:"kind"`
+	First    DuplicateRecord `json:"first"`
+	Second   DuplicateRecord `json:"second"`
+	Score    float64         `json:"score"`
+	Distance int             `json:"distance"`
+}
+
+func ValidDuplicateKind(kind string) bool {
+	_, ok := duplicateSources[kind]
+	return ok
+}
+
+// NormalizeName приводит имя к виду для сравнения: нижний регистр, ё как е,
+// кириллица латиницей, без знаков препинания и лишних пробелов
+func NormalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		var b strings.Builder
+		for _, r := range word {
+			if latin, ok := transliteration[r]; ok {
+				b.WriteString(latin)
+				continue
+			}
+			b.WriteRune(r)
+		}
+		words[i] = b.String()
+	}
+
+	return strings.Join(words, " ")
+}
+
+// editDistance - расстояние Левенштейна между строками в символах
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+type duplicateCandidate struct {
+	DuplicateRecord
+	normalized []rune
+	// дата рождения или выхода: у разных людей и ремейков совпадают имена, но не даты
+	date string
+}
+
+// FindDuplicates ищет пары записей kind с похожими именами и Score не ниже threshold.
+// Записи с разными известными датами не считаются дублями.
+// progress вызывается после каждой просмотренной записи.
+func FindDuplicates(s *Storage, kind string, threshold float64, progress func(done, total int)) ([]DuplicatePair, error) {
+	query, ok := duplicateSources[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown duplicate kind %q", kind)
+	}
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []duplicateCandidate{}
+	for rows.Next() {
+		var c duplicateCandidate
+		err = rows.Scan(&c.Id, &c.Name, &c.date)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.normalized = []rune(NormalizeName(c.Name))
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// при сортировке по длине для каждой записи достаточно просмотреть окно
+	// записей, длина которых ещё позволяет набрать threshold
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].normalized) < len(candidates[j].normalized)
+	})
+
+	pairs := []DuplicatePair{}
+	for i, a := range candidates {
+		for _, b := range candidates[i+1:] {
+			if float64(len(a.normalized)) < threshold*float64(len(b.normalized)) {
+				break
+			}
+			if a.date != "" && b.date != "" && a.date != b.date {
+				continue
+			}
+
+			distance := editDistance(a.normalized, b.normalized)
+			longest := max(len(a.normalized), len(b.normalized), 1)
+			score := 1 - float64(distance)/float64(longest)
+			if score < threshold {
+				continue
+			}
+
+			first, second := a.DuplicateRecord, b.DuplicateRecord
+			if first.Id > second.Id {
+				first, second = second, first
+			}
+			pairs = append(pairs, DuplicatePair{Kind: kind, First: first, Second: second, Score: score, Distance: distance})
+		}
+
+		if progress != nil {
+			progress(i+1, len(candidates))
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		if pairs[i].Score != pairs[j].Score {
+			return pairs[i].Score > pairs[j].Score
+		}
+		return pairs[i].First.Id < pairs[j].First.Id
+	})
+
+	return pairs, nil
+}
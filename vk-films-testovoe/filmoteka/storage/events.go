@@ -0,0 +1,236 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// События об изменениях фильмов и людей для ленты /events. Они пишутся в Events (outbox)
+// в той же транзакции, что и само изменение, поэтому в ленту попадают только зафиксированные
+// изменения. SQLite выполняет пишущие транзакции по одной, так что события фиксируются
+// в порядке EventId и читатель, дошедший до ID n, уже не увидит новых событий с ID меньше n.
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+type Event struct {
+	EventId   int    `json:"id"`
+	Type      string `json:"type"`
+	Entity    string `json:"entity"`
+	EntityId  int    `json:"entityId"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// событие по действию из AuditLog. Окончательное удаление из корзины события не даёт:
+// для клиентов запись пропала ещё при удалении в корзину
+var eventTypes = map[string]string{
+	AuditCreate:  EventCreated,
+	AuditRestore: EventCreated,
+	AuditUpdate:  EventUpdated,
+	AuditRevert:  EventUpdated,
+	AuditDelete:  EventDeleted,
+	AuditMerge:   EventDeleted,
+}
+
+// eventSnapshot - поля снимка из auditSnapshots, которые видны в связанных записях
+type eventSnapshot struct {
+	Title     string            `json:"title"`
+	Name      string            `json:"name"`
+	DeletedAt *string           `json:"deletedAt"`
+	Credits   []json.RawMessage `json:"credits"`
+}
+
+// outbox записывает события об изменении, которое audit заносит в AuditLog.
+// Фильм отдаётся с именами актёров, а человек - с названиями фильмов, поэтому записи
+// на другой стороне изменившихся участий тоже получают updated.
+func outbox(tx *sql.Tx, action, entity string, id int64, before, after sql.NullString) error {
+	// повторное сохранение без изменений
+	if before == after {
+		return nil
+	}
+
+	var other string
+	switch entity {
+	case EntityFilm:
+		other = EntityPerson
+	case EntityPerson:
+		other = EntityFilm
+	case EntityRating:
+		// оценка пользователя меняет userScore фильма
+		return addEvent(tx, EventUpdated, EntityFilm, id)
+	default:
+		return nil
+	}
+
+	eventType, ok := eventTypes[action]
+	if !ok {
+		return nil
+	}
+
+	err := addEvent(tx, eventType, entity, id)
+	if err != nil {
+		return err
+	}
+
+	related, err := relatedChanges(entity, before, after)
+	if err != nil {
+		return err
+	}
+
+	for _, relatedID := range related {
+		err = addEvent(tx, EventUpdated, other, relatedID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// relatedChanges возвращает ID записей на другой стороне, которые выглядят иначе после изменения:
+// все связанные, если поменялись название, имя или корзина, иначе только с изменившимся участием
+func relatedChanges(entity string, before, after sql.NullString) ([]int64, error) {
+	b, beforeLinks, err := snapshotLinks(entity, before)
+	if err != nil {
+		return nil, err
+	}
+	a, afterLinks, err := snapshotLinks(entity, after)
+	if err != nil {
+		return nil, err
+	}
+
+	all := !before.Valid || !after.Valid || b.Title != a.Title || b.Name != a.Name ||
+		(b.DeletedAt == nil) != (a.DeletedAt == nil)
+
+	ids := []int64{}
+	for id, credits := range beforeLinks {
+		if all || afterLinks[id] != credits {
+			ids = append(ids, id)
+		}
+	}
+	for id := range afterLinks {
+		if _, ok := beforeLinks[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// snapshotLinks разбирает снимок и собирает его участия по ID записи на другой стороне
+func snapshotLinks(entity string, data sql.NullString) (eventSnapshot, map[int64]string, error) {
+	var snap eventSnapshot
+	links := map[int64]string{}
+	if !data.Valid {
+		return snap, links, nil
+	}
+
+	err := json.Unmarshal([]byte(data.String), &snap)
+	if err != nil {
+		return snap, nil, err
+	}
+
+	for _, raw := range snap.Credits {
+		var credit struct {
+			FilmId   int64 `json:"filmId"`
+			PersonId int64 `json:"personId"`
+		}
+		err = json.Unmarshal(raw, &credit)
+		if err != nil {
+			return snap, nil, err
+		}
+
+		id := credit.PersonId
+		if entity == EntityPerson {
+			id = credit.FilmId
+		}
+		links[id] += string(raw)
+	}
+
+	return snap, links, nil
+}
+
+// addEvent записывает событие и ставит его в очередь доставки подписчикам /webhooks
+func addEvent(tx *sql.Tx, eventType, entity string, id int64) error {
+	result, err := tx.Exec(`
+		INSERT INTO Events (Type, EntityType, EntityId, CreatedAt)
+		VALUES (:type, :entity, :id, datetime('now'))
+	`,
+		sql.Named("type", eventType),
+		sql.Named("entity", entity),
+		sql.Named("id", id))
+	if err != nil {
+		return err
+	}
+
+	eventID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	return addDeliveries(tx, eventID)
+}
+
+// EventsAfter возвращает до limit событий с ID больше after по возрастанию ID
+func EventsAfter(s *Storage, after, limit int) ([]Event, error) {
+	rows, err := s.db.Query(`
+		SELECT EventId, Type, EntityType, EntityId, CreatedAt
+		FROM Events
+		WHERE EventId > :after
+		ORDER BY EventId
+		LIMIT :limit
+	`, sql.Named("after", after), sql.Named("limit", limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		err = rows.Scan(&event.EventId, &event.Type, &event.Entity, &event.EntityId, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// EventRange возвращает ID самого старого хранимого события и ID последнего выданного.
+// Если события удалены очисткой или их ещё не было, first = last + 1.
+func EventRange(s *Storage) (first, last int, err error) {
+	err = s.db.QueryRow(`
+		SELECT
+			COALESCE((SELECT MIN(EventId) FROM Events), 0),
+			COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'Events'), 0)
+	`).Scan(&first, &last)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if first == 0 {
+		first = last + 1
+	}
+	return first, last, nil
+}
+
+// PruneEvents удаляет события старше retention и возвращает их число.
+// ID удалённых событий повторно не выдаются, см. migrateEvents.
+func PruneEvents(s *Storage, retention time.Duration) (int, error) {
+	cutoff := time.Now().UTC().Add(-retention).Format("2006-01-02 15:04:05")
+
+	res, err := s.db.Exec("DELETE FROM Events WHERE CreatedAt < :cutoff", sql.Named("cutoff", cutoff))
+	if err != nil {
+		return 0, err
+	}
+
+	pruned, err := res.RowsAffected()
+	return int(pruned), err
+}
@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type ExportColumn struct {
+	Name   string
+	Source string
+	// тип колонки в переносимом SQL: INTEGER или TEXT
+	Type string
+}
+
+// ExportTable описывает, как таблица хранилища выгружается наружу.
+// Имена таблиц и колонок совпадают с полями JSON в API.
+type ExportTable struct {
+	Name    string
+	Source  string
+	Order   string
+	Columns []ExportColumn
+}
+
+// ExportTables - каталог в порядке, в котором его можно загрузить обратно:
+// сначала сущности, затем связи между ними
+var ExportTables = []ExportTable{
+	{
+		Name:   "films",
+		Source: "Films",
+		Order:  "FilmId",
+		Columns: []ExportColumn{
+			{"id", "FilmId", "INTEGER"},
+			{"title", "Title", "TEXT"},
+			{"description", "Description", "TEXT"},
+			{"criticRating", "Rating", "INTEGER"},
+			{"releaseDate", "ReleaseDate", "TEXT"},
+			{"deletedAt", "DeletedAt", "TEXT"},
+		},
+	},
+	{
+		Name:   "people",
+		Source: "Actors",
+		Order:  "ActorId",
+		Columns: []ExportColumn{
+			{"id", "ActorId", "INTEGER"},
+			{"name", "Name", "TEXT"},
+			{"gender", "Gender", "TEXT"},
+			{"birthdate", "BirthDate", "TEXT"},
+			{"deletedAt", "DeletedAt", "TEXT"},
+		},
+	},
+	{
+		Name:   "genres",
+		Source: "Genres",
+		Order:  "GenreId",
+		Columns: []ExportColumn{
+			{"id", "GenreId", "INTEGER"},
+			{"name", "Name", "TEXT"},
+		},
+	},
+	{
+		Name:   "film_genres",
+		Source: "FilmGenre",
+		Order:  "FilmId, GenreId",
+		Columns: []ExportColumn{
+			{"filmId", "FilmId", "INTEGER"},
+			{"genreId", "GenreId", "INTEGER"},
+		},
+	},
+	{
+		Name:   "credits",
+		Source: "Credits",
+		Order:  "FilmId, Role, Position",
+		Columns: []ExportColumn{
+			{"filmId", "FilmId", "INTEGER"},
+			{"personId", "PersonId", "INTEGER"},
+			{"role", "Role", "TEXT"},
+			{"character", "Character", "TEXT"},
+			{"job", "Job", "TEXT"},
+			{"position", "Position", "INTEGER"},
+		},
+	},
+}
+
+// Export - снимок каталога внутри одной читающей транзакции,
+// так что все таблицы выгружаются согласованно
+type Export struct {
+	tx *sql.Tx
+}
+
+// RunExport открывает читающую транзакцию на время выполнения fn
+func RunExport(s *Storage, fn func(x *Export) error) error {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return fn(&Export{tx: tx})
+}
+
+// Rows построчно передаёт в fn значения колонок таблицы, не загружая её в память.
+// Значения имеют тип int64, float64, string или nil.
+func (x *Export) Rows(table ExportTable, fn func(values []any) error) error {
+	sources := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		sources[i] = column.Source
+	}
+
+	rows, err := x.tx.Query("SELECT " + strings.Join(sources, ", ") + " FROM " + table.Source + " ORDER BY " + table.Order)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]any, len(table.Columns))
+	dest := make([]any, len(table.Columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+
+		err = fn(values)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -2,22 +2,162 @@ package sqlite
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"log/slog"
 )
 
+// ErrTitleTaken - название восстанавливаемого фильма уже занято фильмом вне корзины
+var ErrTitleTaken = errors.New("film with this title already exists, rename it before restoring")
+
 type Film struct {
 	FilmId      int			`json:"id,omitempty"`
 	Title       string		`json:"title"`
 	Description string		`json:"description"`
-	Rating      int			`json:"rating"`
+	CriticRating int		`json:"criticRating"`
 	ReleaseDate	string		`json:"releaseDate"`
-	Actors      []string	`json:"actors"`
+	Actors      []Ref		`json:"actors"`
+	Genres      []string	`json:"genres"`
+	Credits     []Credit	`json:"credits"`
+	UserScore   FilmScore	`json:"userScore"`
+	InWatchlist bool		`json:"inWatchlist"`
+	Watched     bool		`json:"watched"`
+	DeletedAt   string		`json:"deletedAt,omitempty"`
+}
+
+// UnmarshalJSON принимает прежнее поле rating как устаревшее название criticRating,
+// чтобы старые клиенты не записывали фильму нулевую оценку
+func (f *Film) UnmarshalJSON(data []byte) error {
+	type film Film
+	// поля, которых нет в data, остаются прежними, как при обычном json.Unmarshal
+	v := struct {
+		film
+		Rating *int `json:"rating"`
+	}{film: film(*f)}
+
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	*f = Film(v.film)
+	if v.Rating != nil && f.CriticRating == 0 {
+		f.CriticRating = *v.Rating
+	}
+
+	return nil
+}
+
+// FilmFilter ограничивает и упорядочивает выборку в GetAllFilmsFromStorage
+type FilmFilter struct {
+	Genre string
+	Sort  string
+	Desc  bool
+	// Deleted выбирает фильмы из корзины вместо обычных
+	Deleted bool
+	// границы даты выхода включительно в ISO 8601, пустая граница не ограничивает.
+	// Неполная дата фильма сравнивается как её начало: 1988 раньше 1988-06.
+	ReleasedFrom string
+	ReleasedTo   string
+	// часть названия фильма или имени одного из актёров
+	Search string
+}
+
+// допустимые значения FilmFilter.Sort
+var filmSorts = map[string]string{
+	"title":        "Films.Title",
+	"rating":       "Films.Rating",
+	"release_date": "Films.ReleaseDate",
+	"score":        "COALESCE(FilmScores.Average, 0)",
+}
+
+func ValidFilmSort(sort string) bool {
+	_, ok := filmSorts[sort]
+	return ok
+}
+
+// фильм выбирается вместе с агрегатом пользовательских оценок
+const filmSelect = `SELECT Films.FilmId, Films.Title, Films.Description, Films.Rating, COALESCE(Films.ReleaseDate, ''),
+		COALESCE(FilmScores.Votes, 0), COALESCE(FilmScores.Average, 0), COALESCE(FilmScores.Histogram, ''),
+		COALESCE(Films.DeletedAt, '')
+	FROM Films
+	LEFT JOIN FilmScores ON FilmScores.FilmId = Films.FilmId`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFilm(row scanner) (Film, error) {
+	var film Film
+	var votes int
+	var average float64
+	var histogram string
+
+	err := row.Scan(&film.FilmId, &film.Title, &film.Description, &film.CriticRating, &film.ReleaseDate, &votes, &average, &histogram, &film.DeletedAt)
+	if err != nil {
+		return Film{}, err
+	}
+
+	err = scanFilmScore(votes, average, histogram, &film.UserScore)
+	if err != nil {
+		return Film{}, err
+	}
+
+	return film, nil
+}
+
+// filmWhere собирает условия выборки и порядок сортировки по фильтру
+func filmWhere(filter FilmFilter) (string, string, []any) {
+	query := " WHERE Films.DeletedAt IS NULL"
+	if filter.Deleted {
+		query = " WHERE Films.DeletedAt IS NOT NULL"
+	}
+	args := []any{}
+	if filter.Genre != "" {
+		query += ` AND Films.FilmId IN (
+			SELECT FilmGenre.FilmId
+			FROM FilmGenre
+			JOIN Genres ON Genres.GenreId = FilmGenre.GenreId
+			WHERE Genres.Name = :genre
+		)`
+		args = append(args, sql.Named("genre", filter.Genre))
+	}
+	if filter.ReleasedFrom != "" {
+		query += " AND Films.ReleaseDate >= :from"
+		args = append(args, sql.Named("from", filter.ReleasedFrom))
+	}
+	// граница 1990 включает и 1990-12-31
+	if filter.ReleasedTo != "" {
+		query += " AND substr(Films.ReleaseDate, 1, length(:to)) <= :to"
+		args = append(args, sql.Named("to", filter.ReleasedTo))
+	}
+	if filter.Search != "" {
+		query += ` AND (Films.Title LIKE '%' || :search || '%' OR Films.FilmId IN (
+			SELECT Credits.FilmId
+			FROM Credits
+			JOIN Actors ON Actors.ActorId = Credits.PersonId
+			WHERE Credits.Role = 'actor' AND Actors.DeletedAt IS NULL AND Actors.Name LIKE '%' || :search || '%'
+		))`
+		args = append(args, sql.Named("search", filter.Search))
+	}
+
+	order, ok := filmSorts[filter.Sort]
+	if !ok {
+		order = "Films.FilmId"
+	}
+	if filter.Desc {
+		order += " DESC"
+	}
+
+	return query, " ORDER BY " + order + ", Films.FilmId", args
 }
 
 // //Фильмы
 // 		app.GetAllFilms(log, storage, w, r)
-func GetAllFilmsFromStorage(s *Storage, log *slog.Logger) ([]Film, error) {
-	rows, err := s.db.Query("SELECT FilmId,Title,Description,Rating,ReleaseDate FROM Films")
+func GetAllFilmsFromStorage(s *Storage, log *slog.Logger, filter FilmFilter) ([]Film, error) {
+	where, order, args := filmWhere(filter)
+
+	rows, err := s.db.Query(filmSelect+where+order, args...)
 
 	log.Info("starting to get all films from storage")
 
@@ -28,9 +168,7 @@ func GetAllFilmsFromStorage(s *Storage, log *slog.Logger) ([]Film, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		film := Film{}
-
-		err := rows.Scan(&film.FilmId, &film.Title, &film.Description, &film.Rating, &film.ReleaseDate)
+		film, err := scanFilm(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -40,6 +178,16 @@ func GetAllFilmsFromStorage(s *Storage, log *slog.Logger) ([]Film, error) {
 			return nil, err
 		}
 
+		film.Genres, err = genresForFilm(s, film.FilmId)
+		if err != nil {
+			return nil, err
+		}
+
+		film.Credits, err = creditsForFilm(s, film.FilmId)
+		if err != nil {
+			return nil, err
+		}
+
 		res = append(res, film)
 	}
 
@@ -53,14 +201,15 @@ func GetAllFilmsFromStorage(s *Storage, log *slog.Logger) ([]Film, error) {
 }
 
 // поиск актёров одного фильма
-func actorsForFilm(s *Storage, filmID int) ([]string, error) {
-	var actors []string
+func actorsForFilm(s *Storage, filmID int) ([]Ref, error) {
+	actors := []Ref{}
 
 	rows, err := s.db.Query(`
-		SELECT Actors.Name
+		SELECT Actors.ActorId, Actors.Name
 		FROM Actors
-		JOIN ActorFilm ON Actors.ActorId = ActorFilm.ActorId
-		WHERE ActorFilm.FilmId = :id
+		JOIN Credits ON Actors.ActorId = Credits.PersonId
+		WHERE Credits.FilmId = :id AND Credits.Role = 'actor' AND Actors.DeletedAt IS NULL
+		ORDER BY Credits.Position
 	`,
 	sql.Named("id",filmID))
 	if err != nil {
@@ -69,21 +218,29 @@ func actorsForFilm(s *Storage, filmID int) ([]string, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var actorName string
-		if err := rows.Scan(&actorName); err != nil {
+		var actor Ref
+		if err := rows.Scan(&actor.Id, &actor.Name); err != nil {
 			return nil, err
 		}
-		actors = append(actors, actorName)
+		actors = append(actors, actor)
 	}
 
 	return actors, nil
 }
 
 // 		app.PostFilm(log, storage, w, r)
-func PostFilmToStorage(s *Storage, film Film) error {
+//
+// createMissing разрешает создавать актёров, которых не нашли по имени
+func PostFilmToStorage(s *Storage, film Film, createMissing bool) error {
+	_, err := CreateFilm(s, film, createMissing)
+	return err
+}
+
+// CreateFilm добавляет фильм и возвращает его ID
+func CreateFilm(s *Storage, film Film, createMissing bool) (filmID int, err error) {
 	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer func() {
 		if err != nil {
@@ -93,61 +250,72 @@ func PostFilmToStorage(s *Storage, film Film) error {
 		err = tx.Commit()
 	}()
 
-	result, err := s.db.Exec("INSERT INTO Films (Title, Description, Rating, ReleaseDate) VALUES (:Title, :Description, :Rating, :ReleaseDate)",
+	id, err := insertFilm(tx, film, createMissing)
+	if err != nil {
+		return 0, err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditCreate, EntityFilm, id, sql.NullString{})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// добавление фильма со связями внутри уже открытой транзакции
+func insertFilm(tx *sql.Tx, film Film, createMissing bool) (int64, error) {
+	releaseDate, err := dateValue(film.ReleaseDate)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO Films (Title, Description, Rating, ReleaseDate) VALUES (:Title, :Description, :Rating, :ReleaseDate)",
 	sql.Named("Title", film.Title),
 	sql.Named("Description", film.Description),
-	sql.Named("Rating", film.Rating),
-	sql.Named("ReleaseDate", film.ReleaseDate))
+	sql.Named("Rating", film.CriticRating),
+	sql.Named("ReleaseDate", releaseDate))
 	if err != nil {
-		return err
+		return 0, err
 	}
 	filmID, err := result.LastInsertId()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	for _, act := range film.Actors {
-		var actorID int64
-		err = tx.QueryRow("SELECT ActorId FROM Actors WHERE Name = :Name", sql.Named("Name", act)).Scan(&actorID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				result, err := tx.Exec("INSERT INTO Actors (Name,Gender,BirthDate) VALUES (:Name,:Gender,:BirthDate)",
-				 sql.Named("Name", act),
-				 sql.Named("Gender", ""),
-				 sql.Named("BirthDate", ""),
-				)
-				if err != nil {
-					return err
-				}
-				actorID, err = result.LastInsertId()
-				if err != nil {
-					return err
-				}
-			} else {
-				return err
-			}
-		}
-		_, err = tx.Exec("INSERT INTO ActorFilm (ActorId, FilmId) VALUES (:ActorId, FilmId)", sql.Named("ActorID", actorID), sql.Named("FilmID", filmID))
-		if err != nil {
-			return err
-		}
+	err = setFilmCredits(tx, filmID, film.Actors, film.Credits, createMissing)
+	if err != nil {
+		return 0, err
 	}
 
-    return nil
+	err = linkGenresToFilm(tx, filmID, film.Genres)
+	if err != nil {
+		return 0, err
+	}
+
+	return filmID, nil
 }
 
 // 		app.GetOneFilm(log, storage, w, r)
 func GetOneFilmFromStorage(s *Storage, id int) (Film, error) {
-	row := s.db.QueryRow("SELECT FilmId,Title,Description,Rating,ReleaseDate FROM Films WHERE FilmId = :id", sql.Named("id", id))
+	row := s.db.QueryRow(filmSelect+" WHERE Films.FilmId = :id AND Films.DeletedAt IS NULL", sql.Named("id", id))
 
-	var film Film
+	film, err := scanFilm(row)
+	if err != nil {
+		return Film{}, err
+	}
 
-	err := row.Scan(&film.FilmId, &film.Title,&film.Description,&film.Rating, &film.ReleaseDate)
+	film.Actors, err = actorsForFilm(s, film.FilmId)
 	if err != nil {
 		return Film{}, err
 	}
 
-	film.Actors, err = filmsForActor(s, film.FilmId)
+	film.Genres, err = genresForFilm(s, film.FilmId)
+	if err != nil {
+		return Film{}, err
+	}
+
+	film.Credits, err = creditsForFilm(s, film.FilmId)
 	if err != nil {
 		return Film{}, err
 	}
@@ -155,7 +323,7 @@ func GetOneFilmFromStorage(s *Storage, id int) (Film, error) {
 	return film, nil
 }
 // 		app.PutOneFilm(log, storage, w, r)
-func UpdateFilm(s *Storage, film Film) error {
+func UpdateFilm(s *Storage, film Film, createMissing bool) (err error) {
     tx, err := s.db.Begin()
     if err != nil {
         return err
@@ -168,60 +336,105 @@ func UpdateFilm(s *Storage, film Film) error {
         err = tx.Commit()
     }()
 
+    before, err := snapshot(tx, s.principal, EntityFilm, int64(film.FilmId))
+    if err != nil {
+        return err
+    }
+
+    err = updateFilm(tx, film, createMissing)
+    if err != nil {
+        return err
+    }
+
+    err = audit(tx, s.auditPrincipal(), AuditUpdate, EntityFilm, int64(film.FilmId), before)
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
 
-    _, err = tx.Exec("UPDATE Films SET Title=:Title, Description=:Description, Rating=:Rating, ReleaseDate=:ReleaseDate WHERE FilmId = :id",
+// изменение фильма со связями внутри уже открытой транзакции
+func updateFilm(tx *sql.Tx, film Film, createMissing bool) error {
+    releaseDate, err := dateValue(film.ReleaseDate)
+    if err != nil {
+        return err
+    }
+
+    result, err := tx.Exec("UPDATE Films SET Title=:Title, Description=:Description, Rating=:Rating, ReleaseDate=:ReleaseDate WHERE FilmId = :id AND DeletedAt IS NULL",
         sql.Named("Title", film.Title),
         sql.Named("Description", film.Description),
-        sql.Named("Rating", film.Rating),
-        sql.Named("ReleaseDate", film.ReleaseDate),
+        sql.Named("Rating", film.CriticRating),
+        sql.Named("ReleaseDate", releaseDate),
         sql.Named("id", film.FilmId))
     if err != nil {
         return err
     }
 
+    // фильм из корзины сначала нужно восстановить
+    err = requireAffected(result)
+    if err != nil {
+        return err
+    }
 
-    _, err = tx.Exec("DELETE FROM ActorFilm WHERE FilmId = :id", sql.Named("id", film.FilmId))
+
+    err = setFilmCredits(tx, int64(film.FilmId), film.Actors, film.Credits, createMissing)
     if err != nil {
         return err
     }
 
+    _, err = tx.Exec("DELETE FROM FilmGenre WHERE FilmId = :id", sql.Named("id", film.FilmId))
+    if err != nil {
+        return err
+    }
 
-    for _, actor := range film.Actors {
-        var actorID int64
+    err = linkGenresToFilm(tx, int64(film.FilmId), film.Genres)
+    if err != nil {
+        return err
+    }
 
-        err = tx.QueryRow("SELECT ActorId FROM Actors WHERE Name = :Name", sql.Named("Name", actor)).Scan(&actorID)
+    return nil
+}
+// 		app.DeleteOneFilm(log, storage, w, r)
+func DeleteFilm(s *Storage, filmID int) (err error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer func() {
         if err != nil {
-            if err == sql.ErrNoRows {
-
-				result, err := tx.Exec("INSERT INTO Actors (Name,Gender,BirthDate) VALUES (:Name,:Gender,:BirthDate)",
-				 sql.Named("Name", actor),
-				 sql.Named("Gender", ""),
-				 sql.Named("BirthDate", ""),
-				)
-                if err != nil {
-                    return err
-                }
-                actorID, err = result.LastInsertId()
-                if err != nil {
-                    return err
-                }
-            } else {
-                return err
-            }
+            tx.Rollback()
+            return
         }
+        err = tx.Commit()
+    }()
 
-        _, err = tx.Exec("INSERT INTO ActorFilm (ActorId, FilmId) VALUES (:ActorId, :FilmId)",
-            sql.Named("ActorId", actorID),
-            sql.Named("FilmId", film.FilmId))
-        if err != nil {
-            return err
-        }
+    before, err := snapshot(tx, s.principal, EntityFilm, int64(filmID))
+    if err != nil {
+        return err
+    }
+
+    // связи с актёрами и жанрами остаются, чтобы восстановленный фильм вернулся целиком
+    result, err := tx.Exec("UPDATE Films SET DeletedAt = datetime('now') WHERE FilmId = :id AND DeletedAt IS NULL", sql.Named("id", filmID))
+    if err != nil {
+        return err
+    }
+
+    err = requireAffected(result)
+    if err != nil {
+        return err
+    }
+
+    err = audit(tx, s.auditPrincipal(), AuditDelete, EntityFilm, int64(filmID), before)
+    if err != nil {
+        return err
     }
 
     return nil
 }
-// 		app.DeleteOneFilm(log, storage, w, r)
-func DeleteFilm(s *Storage, filmID int) error {
+
+// app.PostFilmRestore(log, storage, w, r)
+func RestoreFilm(s *Storage, filmID int) (err error) {
     tx, err := s.db.Begin()
     if err != nil {
         return err
@@ -234,17 +447,93 @@ func DeleteFilm(s *Storage, filmID int) error {
         err = tx.Commit()
     }()
 
+    before, err := snapshot(tx, s.principal, EntityFilm, int64(filmID))
+    if err != nil {
+        return err
+    }
+
+    // пока фильм лежал в корзине, его название мог занять новый фильм
+    var taken int
+    err = tx.QueryRow(`SELECT COUNT(*) FROM Films
+        WHERE Title = (SELECT Title FROM Films WHERE FilmId = :id AND DeletedAt IS NOT NULL) AND DeletedAt IS NULL`,
+        sql.Named("id", filmID)).Scan(&taken)
+    if err != nil {
+        return err
+    }
+    if taken > 0 {
+        err = ErrTitleTaken
+        return err
+    }
 
-    _, err = tx.Exec("DELETE FROM ActorFilm WHERE FilmId=:id", sql.Named("id", filmID))
+    result, err := tx.Exec("UPDATE Films SET DeletedAt = NULL WHERE FilmId = :id AND DeletedAt IS NOT NULL", sql.Named("id", filmID))
     if err != nil {
         return err
     }
 
+    err = requireAffected(result)
+    if err != nil {
+        return err
+    }
 
-    _, err = tx.Exec("DELETE FROM Films WHERE FilmId=:id", sql.Named("id", filmID))
+    err = audit(tx, s.auditPrincipal(), AuditRestore, EntityFilm, int64(filmID), before)
     if err != nil {
         return err
     }
 
     return nil
 }
+
+// purgeFilm окончательно удаляет фильм со всеми связями и личными записями пользователей
+func purgeFilm(tx *sql.Tx, filmID int64) error {
+	_, err := tx.Exec("DELETE FROM Credits WHERE FilmId=:id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM FilmGenre WHERE FilmId=:id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Reviews WHERE FilmId=:id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Watchlist WHERE FilmId=:id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Watched WHERE FilmId=:id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM UserRatings WHERE FilmId=:id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM FilmScores WHERE FilmId=:id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Aliases WHERE EntityType = 'film' AND TargetId = :id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Revisions WHERE EntityType = 'film' AND EntityId = :id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Films WHERE FilmId=:id", sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+)
+
+var (
+	ErrEmptyGenre  = errors.New("empty genre name")
+	ErrGenreExists = errors.New("genre with this name already exists")
+)
+
+type Genre struct {
+	GenreId    int    `json:"id,omitempty"`
+	Name       string `json:"name"`
+	FilmsCount int    `json:"filmsCount"`
+}
+
+// //Жанры
+//
+//	app.GetAllGenres(log, storage, w, r)
+func GetAllGenresFromStorage(s *Storage, log *slog.Logger) ([]Genre, error) {
+	rows, err := s.db.Query(`
+		SELECT Genres.GenreId, Genres.Name, COUNT(Films.FilmId)
+		FROM Genres
+		LEFT JOIN FilmGenre ON Genres.GenreId = FilmGenre.GenreId
+		LEFT JOIN Films ON Films.FilmId = FilmGenre.FilmId AND Films.DeletedAt IS NULL
+		GROUP BY Genres.GenreId
+		ORDER BY Genres.Name
+	`)
+
+	log.Info("starting to get genres from storage")
+
+	res := []Genre{}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		genre := Genre{}
+
+		err := rows.Scan(&genre.GenreId, &genre.Name, &genre.FilmsCount)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	log.Info("get all genres from storage successfully")
+
+	return res, nil
+}
+
+// поиск жанров одного фильма
+func genresForFilm(s *Storage, filmID int) ([]string, error) {
+	genres := []string{}
+
+	rows, err := s.db.Query(`
+		SELECT Genres.Name
+		FROM Genres
+		JOIN FilmGenre ON Genres.GenreId = FilmGenre.GenreId
+		WHERE FilmGenre.FilmId = :id
+		ORDER BY Genres.Name
+	`,
+		sql.Named("id", filmID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var genreName string
+		if err := rows.Scan(&genreName); err != nil {
+			return nil, err
+		}
+		genres = append(genres, genreName)
+	}
+
+	return genres, nil
+}
+
+// привязка жанров к фильму по названию, недостающие жанры создаются.
+// Пробелы по краям названия отбрасываются, пустое название - ошибка.
+func linkGenresToFilm(tx *sql.Tx, filmID int64, genres []string) error {
+	for _, name := range genres {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return ErrEmptyGenre
+		}
+
+		var genreID int64
+		err := tx.QueryRow("SELECT GenreId FROM Genres WHERE Name = :Name", sql.Named("Name", name)).Scan(&genreID)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				return err
+			}
+			result, err := tx.Exec("INSERT INTO Genres (Name) VALUES (:Name)", sql.Named("Name", name))
+			if err != nil {
+				return err
+			}
+			genreID, err = result.LastInsertId()
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec("INSERT OR IGNORE INTO FilmGenre (FilmId, GenreId) VALUES (:FilmId, :GenreId)",
+			sql.Named("FilmId", filmID),
+			sql.Named("GenreId", genreID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// app.PostGenre(log, storage, w, r)
+func PostGenreToStorage(s *Storage, genre Genre) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	result, err := tx.Exec("INSERT INTO Genres (Name) VALUES (:Name)", sql.Named("Name", genre.Name))
+	if err != nil {
+		return err
+	}
+	genreID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditCreate, EntityGenre, genreID, sql.NullString{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.GetOneGenre(log, storage, w, r)
+func GetOneGenreFromStorage(s *Storage, id int) (Genre, error) {
+	row := s.db.QueryRow(`
+		SELECT Genres.GenreId, Genres.Name, COUNT(Films.FilmId)
+		FROM Genres
+		LEFT JOIN FilmGenre ON Genres.GenreId = FilmGenre.GenreId
+		LEFT JOIN Films ON Films.FilmId = FilmGenre.FilmId AND Films.DeletedAt IS NULL
+		WHERE Genres.GenreId = :id
+		GROUP BY Genres.GenreId
+	`, sql.Named("id", id))
+
+	var genre Genre
+
+	err := row.Scan(&genre.GenreId, &genre.Name, &genre.FilmsCount)
+	if err != nil {
+		return Genre{}, err
+	}
+
+	return genre, nil
+}
+
+// app.PutOneGenre(log, storage, w, r)
+//
+// ErrGenreExists - если название занято другим жанром.
+func UpdateGenre(s *Storage, genre Genre) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, s.principal, EntityGenre, int64(genre.GenreId))
+	if err != nil {
+		return err
+	}
+
+	var taken bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM Genres WHERE Name = :Name AND GenreId <> :id)",
+		sql.Named("Name", genre.Name),
+		sql.Named("id", genre.GenreId)).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrGenreExists
+	}
+
+	result, err := tx.Exec("UPDATE Genres SET Name=:Name WHERE GenreId = :id",
+		sql.Named("Name", genre.Name),
+		sql.Named("id", genre.GenreId))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditUpdate, EntityGenre, int64(genre.GenreId), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.DeleteOneGenre(log, storage, w, r)
+func DeleteGenre(s *Storage, genreID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, s.principal, EntityGenre, int64(genreID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM FilmGenre WHERE GenreId=:id", sql.Named("id", genreID))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM Genres WHERE GenreId=:id", sql.Named("id", genreID))
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditDelete, EntityGenre, int64(genreID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
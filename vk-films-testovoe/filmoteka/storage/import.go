@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Batch - одна транзакция массового импорта.
+// Каждая строка выполняется внутри своей точки сохранения,
+// так что ошибка в строке не откатывает остальные.
+type Batch struct {
+	tx        *sql.Tx
+	rows      int
+	principal string
+}
+
+// RunBatch выполняет fn в одной транзакции. При dryRun изменения откатываются,
+// но все проверки и поиски выполняются так же, как при настоящем импорте.
+func RunBatch(s *Storage, dryRun bool, fn func(b *Batch) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn(&Batch{tx: tx, principal: s.auditPrincipal()})
+	if err != nil || dryRun {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Row выполняет изменения одной строки импорта.
+// При ошибке откатываются только изменения этой строки.
+func (b *Batch) Row(fn func() error) error {
+	b.rows++
+	name := fmt.Sprintf("import_row_%d", b.rows)
+
+	_, err := b.tx.Exec("SAVEPOINT " + name)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		_, rbErr := b.tx.Exec("ROLLBACK TO " + name)
+		if rbErr != nil {
+			return rbErr
+		}
+	}
+
+	_, relErr := b.tx.Exec("RELEASE " + name)
+	if relErr != nil && err == nil {
+		err = relErr
+	}
+
+	return err
+}
+
+// FindFilm ищет фильм по id или по названию.
+// Если фильма нет, возвращается ErrUnknownRef.
+func (b *Batch) FindFilm(ref Ref) (int, error) {
+	id, err := resolveFilm(b.tx, ref, false)
+	return int(id), err
+}
+
+// FindActor ищет актёра по id или по имени.
+// Если имя не уникально, возвращается ErrAmbiguousRef.
+func (b *Batch) FindActor(ref Ref) (int, error) {
+	id, err := resolvePerson(b.tx, ref, false)
+	return int(id), err
+}
+
+func (b *Batch) PostFilm(film Film, createMissing bool) (int, error) {
+	id, err := insertFilm(b.tx, film, createMissing)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), audit(b.tx, b.principal, AuditCreate, EntityFilm, id, sql.NullString{})
+}
+
+func (b *Batch) UpdateFilm(film Film, createMissing bool) error {
+	before, err := snapshot(b.tx, b.principal, EntityFilm, int64(film.FilmId))
+	if err != nil {
+		return err
+	}
+
+	err = updateFilm(b.tx, film, createMissing)
+	if err != nil {
+		return err
+	}
+
+	return audit(b.tx, b.principal, AuditUpdate, EntityFilm, int64(film.FilmId), before)
+}
+
+func (b *Batch) PostActor(actor Actor, createMissing bool) (int, error) {
+	id, err := insertActor(b.tx, actor, createMissing)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), audit(b.tx, b.principal, AuditCreate, EntityPerson, id, sql.NullString{})
+}
+
+func (b *Batch) UpdateActor(actor Actor, createMissing bool) error {
+	before, err := snapshot(b.tx, b.principal, EntityPerson, int64(actor.ActorId))
+	if err != nil {
+		return err
+	}
+
+	err = updateActor(b.tx, actor, createMissing)
+	if err != nil {
+		return err
+	}
+
+	return audit(b.tx, b.principal, AuditUpdate, EntityPerson, int64(actor.ActorId), before)
+}
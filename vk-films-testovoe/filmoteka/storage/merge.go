@@ -0,0 +1,336 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// политика выбора значений полей при слиянии дубля с оставшейся записью
+const (
+	// остаются поля оставшейся записи
+	MergeKeep = "keep"
+	// пустые поля оставшейся записи заполняются из дубля
+	MergeFill = "fill"
+	// непустые поля дубля заменяют поля оставшейся записи
+	MergeTake = "take"
+)
+
+var ErrSelfMerge = errors.New("record cannot be merged into itself")
+
+func ValidMergePolicy(policy string) bool {
+	return policy == MergeKeep || policy == MergeFill || policy == MergeTake
+}
+
+// mergeField выбирает значение поля по политике, пустое значение - "" или 0
+func mergeField[T comparable](policy string, target, source T) T {
+	var empty T
+	switch {
+	case policy == MergeTake && source != empty:
+		return source
+	case policy == MergeFill && target == empty:
+		return source
+	default:
+		return target
+	}
+}
+
+// ResolveAlias возвращает ID записи, с которой был слит дубль id, или sql.ErrNoRows
+func ResolveAlias(s *Storage, entity string, id int) (int, error) {
+	var target int
+	err := s.db.QueryRow("SELECT TargetId FROM Aliases WHERE EntityType = :entity AND AliasId = :id",
+		sql.Named("entity", entity),
+		sql.Named("id", id)).Scan(&target)
+	return target, err
+}
+
+// addAlias перенаправляет на targetID сам дубль и всё, что раньше было слито с ним.
+// До AUTOINCREMENT SQLite мог выдать ID удалённого дубля новой записи, такой псевдоним больше не нужен.
+func addAlias(tx *sql.Tx, entity string, aliasID, targetID int64) error {
+	_, err := tx.Exec("DELETE FROM Aliases WHERE EntityType = :entity AND AliasId = :target",
+		sql.Named("entity", entity),
+		sql.Named("target", targetID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Aliases SET TargetId = :target WHERE EntityType = :entity AND TargetId = :alias",
+		sql.Named("entity", entity),
+		sql.Named("alias", aliasID),
+		sql.Named("target", targetID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO Aliases (EntityType, AliasId, TargetId, MergedAt)
+		VALUES (:entity, :alias, :target, datetime('now'))
+		ON CONFLICT (EntityType, AliasId) DO UPDATE SET TargetId = excluded.TargetId, MergedAt = excluded.MergedAt
+	`,
+		sql.Named("entity", entity),
+		sql.Named("alias", aliasID),
+		sql.Named("target", targetID))
+	return err
+}
+
+// moveLinks переносит строки таблицы с дубля на оставшуюся запись.
+// Если такая связь у оставшейся записи уже есть, остаётся её строка.
+func moveLinks(tx *sql.Tx, table, column string, from, to int64) error {
+	_, err := tx.Exec("UPDATE OR IGNORE "+table+" SET "+column+" = :to WHERE "+column+" = :from",
+		sql.Named("from", from),
+		sql.Named("to", to))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM "+table+" WHERE "+column+" = :from", sql.Named("from", from))
+	return err
+}
+
+// поля фильма, которые выбираются при слиянии
+func mergedFilm(tx *sql.Tx, id int) (Film, error) {
+	var film Film
+	err := tx.QueryRow("SELECT FilmId, Title, Description, Rating, COALESCE(ReleaseDate, '') FROM Films WHERE FilmId = :id AND DeletedAt IS NULL", sql.Named("id", id)).
+		Scan(&film.FilmId, &film.Title, &film.Description, &film.CriticRating, &film.ReleaseDate)
+	return film, err
+}
+
+// поля человека, которые выбираются при слиянии
+func mergedActor(tx *sql.Tx, id int) (Actor, error) {
+	var actor Actor
+	err := tx.QueryRow("SELECT ActorId, Name, Gender, COALESCE(BirthDate, '') FROM Actors WHERE ActorId = :id AND DeletedAt IS NULL", sql.Named("id", id)).
+		Scan(&actor.ActorId, &actor.Name, &actor.Gender, &actor.BirthDate)
+	return actor, err
+}
+
+// фильмы, в которых участвует человек
+func creditFilms(tx *sql.Tx, personID int) ([]int, error) {
+	rows, err := tx.Query("SELECT DISTINCT FilmId FROM Credits WHERE PersonId = :id", sql.Named("id", personID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	films := []int{}
+	for rows.Next() {
+		var filmID int
+		if err := rows.Scan(&filmID); err != nil {
+			return nil, err
+		}
+		films = append(films, filmID)
+	}
+
+	return films, rows.Err()
+}
+
+// app.PostFilmMerge(log, storage, w, r)
+// MergeFilms сливает фильм sourceID с targetID: связи, оценки, рецензии и списки
+// переходят к targetID, поля выбираются по policy, старый ID остаётся псевдонимом.
+func MergeFilms(s *Storage, targetID, sourceID int, policy string) (err error) {
+	if targetID == sourceID {
+		return ErrSelfMerge
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	target, err := mergedFilm(tx, targetID)
+	if err != nil {
+		return err
+	}
+	source, err := mergedFilm(tx, sourceID)
+	if err != nil {
+		return err
+	}
+
+	targetBefore, err := snapshot(tx, s.principal, EntityFilm, int64(targetID))
+	if err != nil {
+		return err
+	}
+	sourceBefore, err := snapshot(tx, s.principal, EntityFilm, int64(sourceID))
+	if err != nil {
+		return err
+	}
+
+	// участники дубля встают в каждой роли после участников оставшегося фильма
+	_, err = tx.Exec(`UPDATE Credits SET Position = Position + (
+			SELECT COALESCE(MAX(target.Position), 0) FROM Credits AS target
+			WHERE target.FilmId = :target AND target.Role = Credits.Role)
+		WHERE FilmId = :source`,
+		sql.Named("target", targetID),
+		sql.Named("source", sourceID))
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"Credits", "FilmGenre", "Reviews", "UserRatings", "Watchlist", "Watched"} {
+		err = moveLinks(tx, table, "FilmId", int64(sourceID), int64(targetID))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = compactCredits(tx, targetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM FilmScores WHERE FilmId = :id", sql.Named("id", sourceID))
+	if err != nil {
+		return err
+	}
+
+	err = refreshFilmScore(tx, targetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Revisions WHERE EntityType = 'film' AND EntityId = :id", sql.Named("id", sourceID))
+	if err != nil {
+		return err
+	}
+
+	// дубль удаляется до изменения полей, иначе его название помешало бы UNIQUE (Title)
+	_, err = tx.Exec("DELETE FROM Films WHERE FilmId = :id", sql.Named("id", sourceID))
+	if err != nil {
+		return err
+	}
+
+	releaseDate, err := dateValue(mergeField(policy, target.ReleaseDate, source.ReleaseDate))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Films SET Title = :Title, Description = :Description, Rating = :Rating, ReleaseDate = :ReleaseDate WHERE FilmId = :id",
+		sql.Named("Title", mergeField(policy, target.Title, source.Title)),
+		sql.Named("Description", mergeField(policy, target.Description, source.Description)),
+		sql.Named("Rating", mergeField(policy, target.CriticRating, source.CriticRating)),
+		sql.Named("ReleaseDate", releaseDate),
+		sql.Named("id", targetID))
+	if err != nil {
+		return err
+	}
+
+	err = addAlias(tx, EntityFilm, int64(sourceID), int64(targetID))
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditMerge, EntityFilm, int64(sourceID), sourceBefore)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditUpdate, EntityFilm, int64(targetID), targetBefore)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.PostActorMerge(log, storage, w, r)
+// MergeActors сливает человека sourceID с targetID: все роли переходят к targetID,
+// поля выбираются по policy, старый ID остаётся псевдонимом.
+func MergeActors(s *Storage, targetID, sourceID int, policy string) (err error) {
+	if targetID == sourceID {
+		return ErrSelfMerge
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	target, err := mergedActor(tx, targetID)
+	if err != nil {
+		return err
+	}
+	source, err := mergedActor(tx, sourceID)
+	if err != nil {
+		return err
+	}
+
+	targetBefore, err := snapshot(tx, s.principal, EntityPerson, int64(targetID))
+	if err != nil {
+		return err
+	}
+	sourceBefore, err := snapshot(tx, s.principal, EntityPerson, int64(sourceID))
+	if err != nil {
+		return err
+	}
+
+	films, err := creditFilms(tx, sourceID)
+	if err != nil {
+		return err
+	}
+
+	err = moveLinks(tx, "Credits", "PersonId", int64(sourceID), int64(targetID))
+	if err != nil {
+		return err
+	}
+
+	// роль дубля, которая уже была у оставшейся записи, пропадает и оставляет пропуск в позициях
+	for _, filmID := range films {
+		err = compactCredits(tx, filmID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM Revisions WHERE EntityType = 'person' AND EntityId = :id", sql.Named("id", sourceID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Actors WHERE ActorId = :id", sql.Named("id", sourceID))
+	if err != nil {
+		return err
+	}
+
+	birthDate, err := dateValue(mergeField(policy, target.BirthDate, source.BirthDate))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Actors SET Name = :Name, Gender = :Gender, BirthDate = :BirthDate WHERE ActorId = :id",
+		sql.Named("Name", mergeField(policy, target.Name, source.Name)),
+		sql.Named("Gender", mergeField(policy, target.Gender, source.Gender)),
+		sql.Named("BirthDate", birthDate),
+		sql.Named("id", targetID))
+	if err != nil {
+		return err
+	}
+
+	err = addAlias(tx, EntityPerson, int64(sourceID), int64(targetID))
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditMerge, EntityPerson, int64(sourceID), sourceBefore)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditUpdate, EntityPerson, int64(targetID), targetBefore)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
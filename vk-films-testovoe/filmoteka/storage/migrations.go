@@ -0,0 +1,593 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// migrations применяются по порядку, номер версии схемы хранится в PRAGMA user_version.
+// Миграция с индексом i переводит базу с версии i на версию i+1.
+var migrations = []func(tx *sql.Tx) error{
+	migrateCredits,
+	migrateActorNamesNotUnique,
+	migrateUserRatings,
+	migrateReviews,
+	migrateWatchlists,
+	migrateAuditLog,
+	migrateSoftDelete,
+	migrateRevisions,
+	migrateAliases,
+	migrateISODates,
+	migrateUserRoles,
+	migrateEvents,
+	migrateWebhooks,
+	migrateAPIKeys,
+	migrateActiveFilmTitles,
+	migrateAutoincrementIDs,
+	migrateWatchedISODates,
+}
+
+// SchemaVersion возвращает версию схемы, которую ожидает этот код
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// StorageVersion возвращает версию схемы базы storagePath, не применяя миграции
+func StorageVersion(storagePath string) (int, error) {
+	db, err := sql.Open("sqlite", storagePath)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var version int
+	err = db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+func migrate(db *sql.DB, log *slog.Logger) error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("storage schema version %d is newer than supported %d", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		log.Info("applying storage migration", slog.Int("version", i+1))
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if err = migrations[i](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		// PRAGMA не поддерживает параметры запроса
+		if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func tableExists(tx *sql.Tx, name string) (bool, error) {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = :name", sql.Named("name", name)).Scan(&count)
+	return count > 0, err
+}
+
+// связи актёр-фильм переносятся в общую таблицу Credits с ролью actor
+func migrateCredits(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Credits (
+        CreditId INTEGER PRIMARY KEY,
+        FilmId INTEGER NOT NULL,
+        PersonId INTEGER NOT NULL,
+        Role TEXT NOT NULL,
+        Character TEXT NOT NULL DEFAULT '',
+        Job TEXT NOT NULL DEFAULT '',
+        Position INTEGER NOT NULL DEFAULT 0,
+        UNIQUE (FilmId, PersonId, Role),
+        FOREIGN KEY (FilmId) REFERENCES Films (FilmId),
+        FOREIGN KEY (PersonId) REFERENCES Actors (ActorId)
+    )`)
+	if err != nil {
+		return err
+	}
+
+	ok, err := tableExists(tx, "ActorFilm")
+	if err != nil || !ok {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO Credits (FilmId, PersonId, Role, Position)
+		SELECT FilmId, ActorId, 'actor', ROW_NUMBER() OVER (PARTITION BY FilmId ORDER BY ActorId)
+		FROM ActorFilm`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DROP TABLE ActorFilm")
+	return err
+}
+
+// актёры связываются по ActorId, поэтому одинаковые имена допустимы.
+// SQLite не умеет удалять ограничения, таблица пересоздаётся.
+func migrateActorNamesNotUnique(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE Actors_new (
+        ActorId INTEGER PRIMARY KEY,
+        Name TEXT,
+        Gender TEXT,
+        BirthDate TEXT
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO Actors_new (ActorId, Name, Gender, BirthDate) SELECT ActorId, Name, Gender, BirthDate FROM Actors")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DROP TABLE Actors")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("ALTER TABLE Actors_new RENAME TO Actors")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS ActorsName ON Actors (Name)")
+	return err
+}
+
+// пользовательские оценки и их агрегат по фильму
+func migrateUserRatings(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS UserRatings (
+        Login TEXT NOT NULL,
+        FilmId INTEGER NOT NULL,
+        Rating INTEGER NOT NULL CHECK (Rating BETWEEN 1 AND 10),
+        UpdatedAt TEXT NOT NULL,
+        PRIMARY KEY (Login, FilmId),
+        FOREIGN KEY (Login) REFERENCES Users (Login),
+        FOREIGN KEY (FilmId) REFERENCES Films (FilmId)
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS FilmScores (
+        FilmId INTEGER PRIMARY KEY,
+        Votes INTEGER NOT NULL DEFAULT 0,
+        Average REAL NOT NULL DEFAULT 0,
+        Histogram TEXT NOT NULL DEFAULT '[0,0,0,0,0,0,0,0,0,0]',
+        FOREIGN KEY (FilmId) REFERENCES Films (FilmId)
+    )`)
+	return err
+}
+
+// рецензии пользователей с модерацией
+func migrateReviews(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Reviews (
+        ReviewId INTEGER PRIMARY KEY,
+        FilmId INTEGER NOT NULL,
+        Login TEXT NOT NULL,
+        Text TEXT NOT NULL,
+        Status TEXT NOT NULL DEFAULT 'pending',
+        CreatedAt TEXT NOT NULL,
+        UpdatedAt TEXT NOT NULL,
+        UNIQUE (FilmId, Login),
+        FOREIGN KEY (Login) REFERENCES Users (Login),
+        FOREIGN KEY (FilmId) REFERENCES Films (FilmId)
+    )`)
+	return err
+}
+
+// личные списки пользователей: "буду смотреть" и история просмотров
+func migrateWatchlists(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Watchlist (
+        Login TEXT NOT NULL,
+        FilmId INTEGER NOT NULL,
+        Note TEXT NOT NULL DEFAULT '',
+        AddedAt TEXT NOT NULL,
+        PRIMARY KEY (Login, FilmId),
+        FOREIGN KEY (Login) REFERENCES Users (Login),
+        FOREIGN KEY (FilmId) REFERENCES Films (FilmId)
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS Watched (
+        Login TEXT NOT NULL,
+        FilmId INTEGER NOT NULL,
+        WatchedAt TEXT NOT NULL,
+        Note TEXT NOT NULL DEFAULT '',
+        PRIMARY KEY (Login, FilmId),
+        FOREIGN KEY (Login) REFERENCES Users (Login),
+        FOREIGN KEY (FilmId) REFERENCES Films (FilmId)
+    )`)
+	return err
+}
+
+func migrateAuditLog(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS AuditLog (
+        AuditId INTEGER PRIMARY KEY,
+        Principal TEXT NOT NULL,
+        Action TEXT NOT NULL,
+        EntityType TEXT NOT NULL,
+        EntityId INTEGER NOT NULL,
+        Before TEXT,
+        After TEXT,
+        CreatedAt TEXT NOT NULL
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS AuditLogEntity ON AuditLog (EntityType, EntityId)")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS AuditLogCreatedAt ON AuditLog (CreatedAt)")
+	return err
+}
+
+// удалённые фильмы и люди остаются в базе до очистки корзины
+func migrateSoftDelete(tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE Films ADD COLUMN DeletedAt TEXT")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("ALTER TABLE Actors ADD COLUMN DeletedAt TEXT")
+	return err
+}
+
+// прежние версии фильмов и людей. История заполняется из уже записанных в AuditLog изменений
+func migrateRevisions(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Revisions (
+        RevisionId INTEGER PRIMARY KEY,
+        EntityType TEXT NOT NULL,
+        EntityId INTEGER NOT NULL,
+        Number INTEGER NOT NULL,
+        Snapshot TEXT NOT NULL,
+        ReplacedBy TEXT NOT NULL,
+        ReplacedAt TEXT NOT NULL,
+        UNIQUE (EntityType, EntityId, Number)
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO Revisions (EntityType, EntityId, Number, Snapshot, ReplacedBy, ReplacedAt)
+		SELECT EntityType, EntityId,
+			ROW_NUMBER() OVER (PARTITION BY EntityType, EntityId ORDER BY AuditId),
+			Before, Principal, CreatedAt
+		FROM AuditLog
+		WHERE Action = 'update' AND EntityType IN ('film', 'person')
+			AND Before IS NOT NULL AND After IS NOT NULL AND Before <> After
+	`)
+	return err
+}
+
+// прежние ID слитых дублей, по которым теперь находится оставшаяся запись
+func migrateAliases(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Aliases (
+        EntityType TEXT NOT NULL,
+        AliasId INTEGER NOT NULL,
+        TargetId INTEGER NOT NULL,
+        MergedAt TEXT NOT NULL,
+        PRIMARY KEY (EntityType, AliasId)
+    )`)
+	return err
+}
+
+// даты выхода и рождения переводятся из DD.MM.YYYY в ISO 8601, пустые становятся NULL.
+// Значения, которые не удалось разобрать, остаются как есть.
+func migrateISODates(tx *sql.Tx) error {
+	columns := []struct{ table, id, date string }{
+		{"Films", "FilmId", "ReleaseDate"},
+		{"Actors", "ActorId", "BirthDate"},
+	}
+
+	for _, c := range columns {
+		err := isoDates(tx, c.table, c.id, c.date)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isoDates переводит даты столбца date таблицы table в ISO 8601, строки находятся по столбцу id
+func isoDates(tx *sql.Tx, table, id, date string) error {
+	rows, err := tx.Query("SELECT " + id + ", " + date + " FROM " + table + " WHERE " + date + " IS NOT NULL")
+	if err != nil {
+		return err
+	}
+
+	dates := map[int64]any{}
+	for rows.Next() {
+		var rowID int64
+		var value string
+		if err = rows.Scan(&rowID, &value); err != nil {
+			rows.Close()
+			return err
+		}
+
+		iso, err := dateValue(value)
+		if err != nil {
+			continue
+		}
+		if iso != value {
+			dates[rowID] = iso
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for rowID, value := range dates {
+		_, err = tx.Exec("UPDATE "+table+" SET "+date+" = :date WHERE "+id+" = :id",
+			sql.Named("date", value),
+			sql.Named("id", rowID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// роли пользователей хранятся в базе, чтобы их можно было выдавать без пересборки.
+// Admin получает роль admin, как и раньше, остальные - user.
+func migrateUserRoles(tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE Users ADD COLUMN Role TEXT NOT NULL DEFAULT 'user'")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Users SET Role = 'admin' WHERE Login = 'Admin'")
+	return err
+}
+
+// лента изменений /events. AUTOINCREMENT не даёт выдать ID заново после очистки старых событий,
+// иначе клиент с сохранённым Last-Event-ID пропустил бы новые
+func migrateEvents(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Events (
+        EventId INTEGER PRIMARY KEY AUTOINCREMENT,
+        Type TEXT NOT NULL,
+        EntityType TEXT NOT NULL,
+        EntityId INTEGER NOT NULL,
+        CreatedAt TEXT NOT NULL
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS EventsCreatedAt ON Events (CreatedAt)")
+	return err
+}
+
+// подписки на события ленты, очередь их доставки и журнал попыток.
+// Доставка хранит содержимое события сама, поэтому переживает очистку Events
+func migrateWebhooks(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Webhooks (
+        WebhookId INTEGER PRIMARY KEY,
+        URL TEXT NOT NULL,
+        Events TEXT NOT NULL,
+        Secret TEXT NOT NULL,
+        Active INTEGER NOT NULL DEFAULT 1,
+        CreatedAt TEXT NOT NULL
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS WebhookDeliveries (
+        DeliveryId INTEGER PRIMARY KEY,
+        WebhookId INTEGER NOT NULL,
+        EventId INTEGER NOT NULL,
+        Event TEXT NOT NULL,
+        Payload TEXT NOT NULL,
+        Status TEXT NOT NULL,
+        Attempts INTEGER NOT NULL DEFAULT 0,
+        NextAttemptAt TEXT,
+        LastError TEXT,
+        CreatedAt TEXT NOT NULL,
+        DeliveredAt TEXT,
+        FOREIGN KEY (WebhookId) REFERENCES Webhooks (WebhookId)
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS WebhookDeliveriesDue ON WebhookDeliveries (Status, NextAttemptAt)")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS WebhookDeliveriesWebhook ON WebhookDeliveries (WebhookId, DeliveryId)")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS WebhookAttempts (
+        AttemptId INTEGER PRIMARY KEY,
+        DeliveryId INTEGER NOT NULL,
+        StatusCode INTEGER NOT NULL,
+        Error TEXT NOT NULL,
+        DurationMs INTEGER NOT NULL,
+        AttemptedAt TEXT NOT NULL,
+        FOREIGN KEY (DeliveryId) REFERENCES WebhookDeliveries (DeliveryId)
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS WebhookAttemptsDelivery ON WebhookAttempts (DeliveryId)")
+	return err
+}
+
+// ключи API для сервисов. Хранится только хеш ключа, имя уникально среди неотозванных ключей
+func migrateAPIKeys(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS ApiKeys (
+        KeyId INTEGER PRIMARY KEY,
+        Name TEXT NOT NULL,
+        Prefix TEXT NOT NULL,
+        Hash TEXT NOT NULL UNIQUE,
+        Permissions TEXT NOT NULL,
+        CreatedBy TEXT NOT NULL,
+        CreatedAt TEXT NOT NULL,
+        ExpiresAt TEXT,
+        LastUsedAt TEXT,
+        RevokedAt TEXT
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS ApiKeysActiveName ON ApiKeys (Name) WHERE RevokedAt IS NULL")
+	return err
+}
+
+// название фильма уникально только среди фильмов вне корзины, иначе удалённый фильм
+// не давал бы завести новый с тем же названием. SQLite не умеет удалять ограничения, таблица пересоздаётся.
+func migrateActiveFilmTitles(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE Films_new (
+        FilmId INTEGER PRIMARY KEY,
+        Title TEXT,
+        Description TEXT,
+        ReleaseDate TEXT,
+        Rating INTEGER,
+        DeletedAt TEXT
+    )`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO Films_new (FilmId, Title, Description, ReleaseDate, Rating, DeletedAt) SELECT FilmId, Title, Description, ReleaseDate, Rating, DeletedAt FROM Films")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DROP TABLE Films")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("ALTER TABLE Films_new RENAME TO Films")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS FilmsActiveTitle ON Films (Title) WHERE DeletedAt IS NULL")
+	return err
+}
+
+// ID фильмов и людей больше не выдаются повторно: иначе новая запись получила бы ID слитого
+// или удалённого дубля, и ссылки по старому ID вели бы на неё вместо оставшейся записи
+func migrateAutoincrementIDs(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE Films_new (
+        FilmId INTEGER PRIMARY KEY AUTOINCREMENT,
+        Title TEXT,
+        Description TEXT,
+        ReleaseDate TEXT,
+        Rating INTEGER,
+        DeletedAt TEXT
+    )`)
+	if err != nil {
+		return err
+	}
+
+	err = replaceTable(tx, "Films", "FilmId, Title, Description, ReleaseDate, Rating, DeletedAt")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS FilmsActiveTitle ON Films (Title) WHERE DeletedAt IS NULL")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE Actors_new (
+        ActorId INTEGER PRIMARY KEY AUTOINCREMENT,
+        Name TEXT,
+        Gender TEXT,
+        BirthDate TEXT,
+        DeletedAt TEXT
+    )`)
+	if err != nil {
+		return err
+	}
+
+	err = replaceTable(tx, "Actors", "ActorId, Name, Gender, BirthDate, DeletedAt")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS ActorsName ON Actors (Name)")
+	if err != nil {
+		return err
+	}
+
+	// счётчик начинается после всех ID, которые уже встречались в псевдонимах и журнале изменений
+	_, err = tx.Exec("DELETE FROM sqlite_sequence WHERE name IN ('Films', 'Actors', 'Films_new', 'Actors_new')")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO sqlite_sequence (name, seq)
+		SELECT 'Films', MAX(
+			(SELECT COALESCE(MAX(FilmId), 0) FROM Films),
+			(SELECT COALESCE(MAX(AliasId), 0) FROM Aliases WHERE EntityType = 'film'),
+			(SELECT COALESCE(MAX(EntityId), 0) FROM AuditLog WHERE EntityType = 'film'))
+		UNION ALL
+		SELECT 'Actors', MAX(
+			(SELECT COALESCE(MAX(ActorId), 0) FROM Actors),
+			(SELECT COALESCE(MAX(AliasId), 0) FROM Aliases WHERE EntityType = 'person'),
+			(SELECT COALESCE(MAX(EntityId), 0) FROM AuditLog WHERE EntityType = 'person'))`)
+	return err
+}
+
+// replaceTable переносит строки table в уже созданную table_new и ставит её на место table
+func replaceTable(tx *sql.Tx, table, columns string) error {
+	_, err := tx.Exec("INSERT INTO " + table + "_new (" + columns + ") SELECT " + columns + " FROM " + table)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DROP TABLE " + table)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("ALTER TABLE " + table + "_new RENAME TO " + table)
+	return err
+}
+
+// даты просмотров переводятся из DD.MM.YYYY в ISO 8601 так же, как даты фильмов и людей,
+// и сортируются обычным сравнением строк
+func migrateWatchedISODates(tx *sql.Tx) error {
+	return isoDates(tx, "Watched", "rowid", "WatchedAt")
+}
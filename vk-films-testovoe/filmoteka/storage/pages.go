@@ -0,0 +1,247 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// Постраничные выборки для GraphQL и gRPC: связи загружаются одним запросом
+// сразу для списка ID, а не запросом на каждую запись, как в actorsForFilm
+
+// idsParam передаёт список ID в запрос, внутри он читается через json_each(:ids)
+func idsParam(ids []int) (sql.NamedArg, error) {
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return sql.NamedArg{}, err
+	}
+	return sql.Named("ids", string(idsJSON)), nil
+}
+
+// FindFilms возвращает страницу фильмов по фильтру без связей
+// и общее число подходящих фильмов
+func FindFilms(s *Storage, filter FilmFilter, limit, offset int) ([]Film, int, error) {
+	where, _, args := filmWhere(filter)
+
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Films"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	films, err := filmPage(s, filter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return films, total, nil
+}
+
+func filmPage(s *Storage, filter FilmFilter, limit, offset int) ([]Film, error) {
+	where, order, args := filmWhere(filter)
+
+	args = append(args, sql.Named("limit", limit), sql.Named("offset", offset))
+	rows, err := s.db.Query(filmSelect+where+order+" LIMIT :limit OFFSET :offset", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	films := []Film{}
+	for rows.Next() {
+		film, err := scanFilm(rows)
+		if err != nil {
+			return nil, err
+		}
+		films = append(films, film)
+	}
+
+	return films, rows.Err()
+}
+
+// FindActors возвращает страницу актёров, которые попадают в /actors, без фильмографии.
+// Непустой name ищет по части имени.
+func FindActors(s *Storage, name string, limit, offset int) ([]Actor, int, error) {
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Actors"+actorPageWhere, sql.Named("name", name)).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	actors, err := actorPage(s, name, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return actors, total, nil
+}
+
+const actorPageWhere = " WHERE DeletedAt IS NULL AND " + actorsOnly + " AND (:name = '' OR Name LIKE '%' || :name || '%')"
+
+func actorPage(s *Storage, name string, limit, offset int) ([]Actor, error) {
+	rows, err := s.db.Query("SELECT ActorId,Name,Gender,COALESCE(BirthDate, '') FROM Actors"+actorPageWhere+" ORDER BY ActorId LIMIT :limit OFFSET :offset",
+		sql.Named("name", name),
+		sql.Named("limit", limit),
+		sql.Named("offset", offset))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actors := []Actor{}
+	for rows.Next() {
+		var actor Actor
+		if err := rows.Scan(&actor.ActorId, &actor.Name, &actor.Gender, &actor.BirthDate); err != nil {
+			return nil, err
+		}
+		actors = append(actors, actor)
+	}
+
+	return actors, rows.Err()
+}
+
+// FilmsByID возвращает фильмы без связей, удалённых и несуществующих ID в ответе нет
+func FilmsByID(s *Storage, ids []int) (map[int]Film, error) {
+	param, err := idsParam(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(filmSelect+" WHERE Films.FilmId IN (SELECT value FROM json_each(:ids)) AND Films.DeletedAt IS NULL", param)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	films := map[int]Film{}
+	for rows.Next() {
+		film, err := scanFilm(rows)
+		if err != nil {
+			return nil, err
+		}
+		films[film.FilmId] = film
+	}
+
+	return films, rows.Err()
+}
+
+// ActorsByID возвращает людей без фильмографии, удалённых и несуществующих ID в ответе нет
+func ActorsByID(s *Storage, ids []int) (map[int]Actor, error) {
+	param, err := idsParam(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT ActorId,Name,Gender,COALESCE(BirthDate, '') FROM Actors WHERE ActorId IN (SELECT value FROM json_each(:ids)) AND DeletedAt IS NULL", param)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actors := map[int]Actor{}
+	for rows.Next() {
+		var actor Actor
+		if err := rows.Scan(&actor.ActorId, &actor.Name, &actor.Gender, &actor.BirthDate); err != nil {
+			return nil, err
+		}
+		actors[actor.ActorId] = actor
+	}
+
+	return actors, rows.Err()
+}
+
+// CreditsForFilms - участники фильмов в том же порядке, что и в creditsForFilm
+func CreditsForFilms(s *Storage, filmIDs []int) (map[int][]Credit, error) {
+	param, err := idsParam(filmIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT Credits.FilmId, Films.Title, Credits.PersonId, Actors.Name, Credits.Role, Credits.Character, Credits.Job, Credits.Position
+		FROM Credits
+		JOIN Actors ON Actors.ActorId = Credits.PersonId
+		JOIN Films ON Films.FilmId = Credits.FilmId
+		WHERE Credits.FilmId IN (SELECT value FROM json_each(:ids)) AND Actors.DeletedAt IS NULL
+		ORDER BY Credits.Role <> 'actor', Credits.Role, Credits.Position
+	`, param)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanCredits(rows, byFilm)
+}
+
+// CreditsForPeople - фильмографии людей в том же порядке, что и в creditsForPerson.
+// Ключ ответа - ID человека.
+func CreditsForPeople(s *Storage, personIDs []int) (map[int][]Credit, error) {
+	param, err := idsParam(personIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT Credits.FilmId, Films.Title, Credits.PersonId, Actors.Name, Credits.Role, Credits.Character, Credits.Job, Credits.Position
+		FROM Credits
+		JOIN Actors ON Actors.ActorId = Credits.PersonId
+		JOIN Films ON Films.FilmId = Credits.FilmId
+		WHERE Credits.PersonId IN (SELECT value FROM json_each(:ids)) AND Films.DeletedAt IS NULL
+		ORDER BY Films.ReleaseDate, Films.Title
+	`, param)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanCredits(rows, byPerson)
+}
+
+func byFilm(credit Credit) int   { return credit.FilmId }
+func byPerson(credit Credit) int { return credit.PersonId }
+
+// scanCredits раскладывает роли по ID фильма или человека, сохраняя порядок выборки
+func scanCredits(rows *sql.Rows, key func(Credit) int) (map[int][]Credit, error) {
+	defer rows.Close()
+
+	credits := map[int][]Credit{}
+	for rows.Next() {
+		var credit Credit
+		err := rows.Scan(&credit.FilmId, &credit.Title, &credit.PersonId, &credit.Name, &credit.Role, &credit.Character, &credit.Job, &credit.Position)
+		if err != nil {
+			return nil, err
+		}
+		credits[key(credit)] = append(credits[key(credit)], credit)
+	}
+
+	return credits, rows.Err()
+}
+
+// GenresForFilms - названия жанров фильмов по алфавиту
+func GenresForFilms(s *Storage, filmIDs []int) (map[int][]string, error) {
+	param, err := idsParam(filmIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT FilmGenre.FilmId, Genres.Name
+		FROM Genres
+		JOIN FilmGenre ON Genres.GenreId = FilmGenre.GenreId
+		WHERE FilmGenre.FilmId IN (SELECT value FROM json_each(:ids))
+		ORDER BY Genres.Name
+	`, param)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := map[int][]string{}
+	for rows.Next() {
+		var filmID int
+		var name string
+		if err := rows.Scan(&filmID, &name); err != nil {
+			return nil, err
+		}
+		genres[filmID] = append(genres[filmID], name)
+	}
+
+	return genres, rows.Err()
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log/slog"
+)
+
+// Person - любой участник фильма: актёр, режиссёр, сценарист и т.д.
+// Хранится в той же таблице Actors, /actors показывает только актёров.
+type Person struct {
+	PersonId  int      `json:"id,omitempty"`
+	Name      string   `json:"name"`
+	Gender    string   `json:"gender"`
+	BirthDate string   `json:"birthdate"`
+	Credits   []Credit `json:"credits"`
+}
+
+// //Люди
+//
+//	app.GetAllPeople(log, storage, w, r)
+func GetAllPeopleFromStorage(s *Storage, log *slog.Logger, role string) ([]Person, error) {
+	query := "SELECT ActorId,Name,Gender,COALESCE(BirthDate, '') FROM Actors WHERE DeletedAt IS NULL"
+	args := []any{}
+	if role != "" {
+		query += " AND EXISTS (SELECT 1 FROM Credits WHERE Credits.PersonId = Actors.ActorId AND Credits.Role = :role)"
+		args = append(args, sql.Named("role", role))
+	}
+
+	rows, err := s.db.Query(query, args...)
+
+	log.Info("starting to get people from storage")
+
+	res := []Person{}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		person := Person{}
+
+		err := rows.Scan(&person.PersonId, &person.Name, &person.Gender, &person.BirthDate)
+		if err != nil {
+			return nil, err
+		}
+
+		person.Credits, err = creditsForPerson(s, person.PersonId)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, person)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	log.Info("get all people from storage successfully")
+
+	return res, nil
+}
+
+// app.GetOnePerson(log, storage, w, r)
+func GetOnePersonFromStorage(s *Storage, id int) (Person, error) {
+	row := s.db.QueryRow("SELECT ActorId,Name,Gender,COALESCE(BirthDate, '') FROM Actors WHERE ActorId = :id AND DeletedAt IS NULL", sql.Named("id", id))
+
+	var person Person
+
+	err := row.Scan(&person.PersonId, &person.Name, &person.Gender, &person.BirthDate)
+	if err != nil {
+		return Person{}, err
+	}
+
+	person.Credits, err = creditsForPerson(s, person.PersonId)
+	if err != nil {
+		return Person{}, err
+	}
+
+	return person, nil
+}
+
+// app.PostPerson(log, storage, w, r)
+func PostPersonToStorage(s *Storage, person Person, createMissing bool) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	birthDate, err := dateValue(person.BirthDate)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("INSERT INTO Actors (Name, Gender, BirthDate) VALUES (:Name, :Gender, :BirthDate)",
+		sql.Named("Name", person.Name),
+		sql.Named("Gender", person.Gender),
+		sql.Named("BirthDate", birthDate))
+	if err != nil {
+		return err
+	}
+	personID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, credit := range person.Credits {
+		var filmID int64
+		filmID, err = resolveFilm(tx, Ref{Id: credit.FilmId, Name: credit.Title}, createMissing)
+		if err != nil {
+			return err
+		}
+
+		err = insertCredit(tx, filmID, personID, credit)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditCreate, EntityPerson, personID, sql.NullString{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
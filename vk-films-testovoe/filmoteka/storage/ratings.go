@@ -0,0 +1,162 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FilmScore - агрегат пользовательских оценок фильма.
+// Histogram[i] - количество оценок i+1.
+type FilmScore struct {
+	Average   float64 `json:"average"`
+	Votes     int     `json:"votes"`
+	Histogram [10]int `json:"histogram"`
+}
+
+// пересчёт агрегата выполняется в той же транзакции, что и изменение оценки
+func refreshFilmScore(tx *sql.Tx, filmID int) error {
+	buckets := make([]string, 10)
+	for i := range buckets {
+		buckets[i] = fmt.Sprintf("COALESCE(SUM(Rating = %d), 0)", i+1)
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO FilmScores (FilmId, Votes, Average, Histogram)
+		SELECT :id, COUNT(*), COALESCE(AVG(Rating), 0), json_array(`+strings.Join(buckets, ", ")+`)
+		FROM UserRatings
+		WHERE FilmId = :id
+		ON CONFLICT (FilmId) DO UPDATE SET
+			Votes = excluded.Votes,
+			Average = excluded.Average,
+			Histogram = excluded.Histogram
+	`, sql.Named("id", filmID))
+	return err
+}
+
+func scanFilmScore(votes int, average float64, histogram string, score *FilmScore) error {
+	score.Votes = votes
+	score.Average = average
+	if histogram == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(histogram), &score.Histogram)
+}
+
+// app.PutMyRating(log, storage, w, r)
+func RateFilm(s *Storage, login string, filmID, rating int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	var exists int
+	err = tx.QueryRow("SELECT COUNT(*) FROM Films WHERE FilmId = :id AND DeletedAt IS NULL", sql.Named("id", filmID)).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	before, err := snapshot(tx, login, EntityRating, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO UserRatings (Login, FilmId, Rating, UpdatedAt)
+		VALUES (:login, :id, :rating, datetime('now'))
+		ON CONFLICT (Login, FilmId) DO UPDATE SET
+			Rating = excluded.Rating,
+			UpdatedAt = excluded.UpdatedAt
+	`,
+		sql.Named("login", login),
+		sql.Named("id", filmID),
+		sql.Named("rating", rating))
+	if err != nil {
+		return err
+	}
+
+	err = refreshFilmScore(tx, filmID)
+	if err != nil {
+		return err
+	}
+
+	action := AuditCreate
+	if before.Valid {
+		action = AuditUpdate
+	}
+	err = audit(tx, login, action, EntityRating, int64(filmID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.GetMyRating(log, storage, w, r)
+func GetUserRating(s *Storage, login string, filmID int) (int, error) {
+	var rating int
+	err := s.db.QueryRow("SELECT Rating FROM UserRatings WHERE Login = :login AND FilmId = :id",
+		sql.Named("login", login),
+		sql.Named("id", filmID)).Scan(&rating)
+	return rating, err
+}
+
+// app.DeleteMyRating(log, storage, w, r)
+func DeleteUserRating(s *Storage, login string, filmID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, login, EntityRating, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM UserRatings WHERE Login = :login AND FilmId = :id",
+		sql.Named("login", login),
+		sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	err = refreshFilmScore(tx, filmID)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, login, AuditDelete, EntityRating, int64(filmID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,275 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+type Review struct {
+	ReviewId  int    `json:"id,omitempty"`
+	FilmId    int    `json:"filmId"`
+	Login     string `json:"login"`
+	Text      string `json:"text"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// ReviewPage - одна страница рецензий фильма
+type ReviewPage struct {
+	Reviews []Review `json:"reviews"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+	Total   int      `json:"total"`
+}
+
+func ValidReviewStatus(status string) bool {
+	return status == ReviewPending || status == ReviewApproved || status == ReviewRejected
+}
+
+// app.GetFilmReviews(log, storage, w, r)
+//
+// Пустой status возвращает рецензии в любом статусе.
+func GetFilmReviewsFromStorage(s *Storage, filmID int, status string, page, limit int) (ReviewPage, error) {
+	res := ReviewPage{Reviews: []Review{}, Page: page, Limit: limit}
+
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Reviews WHERE FilmId = :film AND (:status = '' OR Status = :status)",
+		sql.Named("film", filmID),
+		sql.Named("status", status)).Scan(&res.Total)
+	if err != nil {
+		return ReviewPage{}, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT ReviewId, FilmId, Login, Text, Status, CreatedAt, UpdatedAt
+		FROM Reviews
+		WHERE FilmId = :film AND (:status = '' OR Status = :status)
+		ORDER BY CreatedAt DESC, ReviewId DESC
+		LIMIT :limit OFFSET :offset
+	`,
+		sql.Named("film", filmID),
+		sql.Named("status", status),
+		sql.Named("limit", limit),
+		sql.Named("offset", (page-1)*limit))
+	if err != nil {
+		return ReviewPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(&review.ReviewId, &review.FilmId, &review.Login, &review.Text, &review.Status, &review.CreatedAt, &review.UpdatedAt)
+		if err != nil {
+			return ReviewPage{}, err
+		}
+		res.Reviews = append(res.Reviews, review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return ReviewPage{}, err
+	}
+
+	return res, nil
+}
+
+// app.PostReview(log, storage, w, r)
+//
+// Новая рецензия всегда ждёт модерации. У пользователя одна рецензия на фильм.
+func PostReviewToStorage(s *Storage, review Review) (id int, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	result, err := tx.Exec(`
+		INSERT INTO Reviews (FilmId, Login, Text, Status, CreatedAt, UpdatedAt)
+		SELECT FilmId, :login, :text, 'pending', datetime('now'), datetime('now')
+		FROM Films
+		WHERE FilmId = :film AND DeletedAt IS NULL
+	`,
+		sql.Named("film", review.FilmId),
+		sql.Named("login", review.Login),
+		sql.Named("text", review.Text))
+	if err != nil {
+		return 0, err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return 0, err
+	}
+
+	reviewID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditCreate, EntityReview, reviewID, sql.NullString{})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(reviewID), nil
+}
+
+// app.GetOneReview(log, storage, w, r)
+func GetOneReviewFromStorage(s *Storage, id int) (Review, error) {
+	var review Review
+
+	err := s.db.QueryRow("SELECT ReviewId, FilmId, Login, Text, Status, CreatedAt, UpdatedAt FROM Reviews WHERE ReviewId = :id",
+		sql.Named("id", id)).Scan(&review.ReviewId, &review.FilmId, &review.Login, &review.Text, &review.Status, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		return Review{}, err
+	}
+
+	return review, nil
+}
+
+// app.PutOneReview(log, storage, w, r)
+//
+// Автор может менять только свою рецензию, после правки она снова уходит на модерацию.
+func UpdateReview(s *Storage, review Review) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, s.principal, EntityReview, int64(review.ReviewId))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE Reviews SET Text = :text, Status = 'pending', UpdatedAt = datetime('now')
+		WHERE ReviewId = :id AND Login = :login
+	`,
+		sql.Named("text", review.Text),
+		sql.Named("id", review.ReviewId),
+		sql.Named("login", review.Login))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditUpdate, EntityReview, int64(review.ReviewId), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.PutReviewStatus(log, storage, w, r)
+func SetReviewStatus(s *Storage, id int, status string) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, s.principal, EntityReview, int64(id))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE Reviews SET Status = :status WHERE ReviewId = :id",
+		sql.Named("status", status),
+		sql.Named("id", id))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditUpdate, EntityReview, int64(id), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.DeleteOneReview(log, storage, w, r)
+//
+// Пустой login снимает проверку автора, так удаляет модератор.
+func DeleteReview(s *Storage, id int, login string) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, s.principal, EntityReview, int64(id))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM Reviews WHERE ReviewId = :id AND (:login = '' OR Login = :login)",
+		sql.Named("id", id),
+		sql.Named("login", login))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditDelete, EntityReview, int64(id), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sql.ErrNoRows, если запрос не изменил ни одной строки
+func requireAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+)
+
+// версии хранятся только для записей, которые правят редакторы
+var revisioned = map[string]bool{
+	EntityFilm:   true,
+	EntityPerson: true,
+}
+
+// Revision - прежняя версия записи. ReplacedBy и ReplacedAt - кто и когда заменил её следующей.
+// Changes - отличия этой версии от следующей, а для последней - от текущей записи.
+type Revision struct {
+	Number     int             `json:"number"`
+	ReplacedBy string          `json:"replacedBy"`
+	ReplacedAt string          `json:"replacedAt"`
+	Snapshot   json.RawMessage `json:"snapshot"`
+	Changes    []FieldChange   `json:"changes"`
+}
+
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// saveRevision сохраняет версию before, которую только что заменило изменение.
+// Вызывается из audit, поэтому историю получают все пути записи, включая импорт и состав.
+func saveRevision(tx *sql.Tx, principal, entity string, id int64, before, after sql.NullString) error {
+	if !revisioned[entity] || !before.Valid || !after.Valid || before.String == after.String {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO Revisions (EntityType, EntityId, Number, Snapshot, ReplacedBy, ReplacedAt)
+		VALUES (:entity, :id,
+			(SELECT COALESCE(MAX(Number), 0) + 1 FROM Revisions WHERE EntityType = :entity AND EntityId = :id),
+			:snapshot, :principal, datetime('now'))
+	`,
+		sql.Named("entity", entity),
+		sql.Named("id", id),
+		sql.Named("snapshot", before.String),
+		sql.Named("principal", principal))
+	return err
+}
+
+// app.GetFilmRevisions(log, storage, w, r), app.GetActorRevisions(log, storage, w, r)
+// Версии идут от новой к старой. Для записи, которой нет, возвращается sql.ErrNoRows.
+func GetRevisionsFromStorage(s *Storage, entity string, id int) ([]Revision, error) {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := snapshot(tx, "", entity, int64(id))
+	if err != nil {
+		return nil, err
+	}
+	if !current.Valid {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := tx.Query(`
+		SELECT Number, ReplacedBy, ReplacedAt, Snapshot
+		FROM Revisions
+		WHERE EntityType = :entity AND EntityId = :id
+		ORDER BY Number DESC
+	`,
+		sql.Named("entity", entity),
+		sql.Named("id", id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	next := current.String
+	for rows.Next() {
+		var revision Revision
+		var data string
+		err = rows.Scan(&revision.Number, &revision.ReplacedBy, &revision.ReplacedAt, &data)
+		if err != nil {
+			return nil, err
+		}
+
+		revision.Snapshot = json.RawMessage(data)
+		revision.Changes, err = diffSnapshots(data, next)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+		next = data
+	}
+
+	return revisions, rows.Err()
+}
+
+// DiffRevisions сравнивает версии from и to, to = 0 означает текущую запись
+func DiffRevisions(s *Storage, entity string, id, from, to int) ([]FieldChange, error) {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := revisionSnapshot(tx, entity, int64(id), from)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := revisionSnapshot(tx, entity, int64(id), to)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffSnapshots(before, after)
+}
+
+// revisionSnapshot возвращает версию number, 0 - текущую запись
+func revisionSnapshot(tx *sql.Tx, entity string, id int64, number int) (string, error) {
+	if number == 0 {
+		current, err := snapshot(tx, "", entity, id)
+		if err != nil {
+			return "", err
+		}
+		if !current.Valid {
+			return "", sql.ErrNoRows
+		}
+		return current.String, nil
+	}
+
+	var data string
+	err := tx.QueryRow("SELECT Snapshot FROM Revisions WHERE EntityType = :entity AND EntityId = :id AND Number = :number",
+		sql.Named("entity", entity),
+		sql.Named("id", id),
+		sql.Named("number", number)).Scan(&data)
+	return data, err
+}
+
+// diffSnapshots сравнивает снимки по полям верхнего уровня. Поля id и deletedAt
+// правкой не меняются и в отличия не попадают.
+func diffSnapshots(before, after string) ([]FieldChange, error) {
+	var b, a map[string]json.RawMessage
+	err := json.Unmarshal([]byte(before), &b)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(after), &a)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{}
+	for field := range b {
+		fields = append(fields, field)
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []FieldChange{}
+	for _, field := range fields {
+		if field == "id" || field == "deletedAt" {
+			continue
+		}
+
+		old, ok := b[field]
+		if !ok {
+			old = json.RawMessage("null")
+		}
+		cur, ok := a[field]
+		if !ok {
+			cur = json.RawMessage("null")
+		}
+
+		if !bytes.Equal(old, cur) {
+			changes = append(changes, FieldChange{Field: field, Before: old, After: cur})
+		}
+	}
+
+	return changes, nil
+}
+
+// RevertFilm записывает версию number фильма как новое изменение, текущая версия уходит в историю
+func RevertFilm(s *Storage, filmID, number int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	data, err := revisionSnapshot(tx, EntityFilm, int64(filmID), number)
+	if err != nil {
+		return err
+	}
+
+	// снимок фильма совпадает с его JSON в API, состав восстанавливается из credits
+	var film Film
+	err = json.Unmarshal([]byte(data), &film)
+	if err != nil {
+		return err
+	}
+	film.FilmId = filmID
+
+	before, err := snapshot(tx, s.principal, EntityFilm, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	err = updateFilm(tx, film, false)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditRevert, EntityFilm, int64(filmID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevertActor записывает версию number человека как новое изменение.
+// Из фильмографии восстанавливаются роли актёра, как при обычном изменении.
+func RevertActor(s *Storage, actorID, number int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	data, err := revisionSnapshot(tx, EntityPerson, int64(actorID), number)
+	if err != nil {
+		return err
+	}
+
+	var person struct {
+		Actor
+		Credits []Credit `json:"credits"`
+	}
+	err = json.Unmarshal([]byte(data), &person)
+	if err != nil {
+		return err
+	}
+
+	actor := person.Actor
+	actor.ActorId = actorID
+	actor.Films = []Ref{}
+	for _, credit := range person.Credits {
+		if credit.Role == RoleActor {
+			actor.Films = append(actor.Films, Ref{Id: credit.FilmId})
+		}
+	}
+
+	before, err := snapshot(tx, s.principal, EntityPerson, int64(actorID))
+	if err != nil {
+		return err
+	}
+
+	err = updateActor(tx, actor, false)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditRevert, EntityPerson, int64(actorID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
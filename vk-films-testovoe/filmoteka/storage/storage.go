@@ -9,23 +9,29 @@ import (
 
 type Storage struct {
 	db *sql.DB
+	// от чьего имени изменения пишутся в AuditLog, см. As
+	principal string
 }
 
+// параметры соединений с базой: в режиме WAL долгое чтение (выгрузка, поток фильмов)
+// не блокирует запись, а занятая база ждёт busy_timeout мс вместо немедленного SQLITE_BUSY
+const connectionParams = "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+
 func New(storagePath string, log *slog.Logger) (*Storage, error) {
-	db, err := sql.Open("sqlite", storagePath)
+	db, err := sql.Open("sqlite", storagePath+connectionParams)
 	if err != nil {
-		log.Error("failed to open storage:", err)
+		log.Error("failed to open storage", slog.Any("error", err))
 		return nil, err
 	}
 
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS Actors (
         ActorId INTEGER PRIMARY KEY,
-        Name TEXT UNIQUE,
+        Name TEXT,
         Gender TEXT,
         BirthDate TEXT
     )`)
 	if err != nil {
-		log.Error("failed to create table Actors: %w", err)
+		log.Error("failed to create table Actors", slog.Any("error", err))
 		return nil, err
 	}
 
@@ -37,19 +43,28 @@ func New(storagePath string, log *slog.Logger) (*Storage, error) {
         Rating INTEGER
     )`)
 	if err != nil {
-		log.Error("failed to create table Films: %w", err)
+		log.Error("failed to create table Films", slog.Any("error", err))
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS Genres (
+        GenreId INTEGER PRIMARY KEY,
+        Name TEXT UNIQUE
+    )`)
+	if err != nil {
+		log.Error("failed to create table Genres", slog.Any("error", err))
 		return nil, err
 	}
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ActorFilm (
-        ActorId INTEGER,
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS FilmGenre (
         FilmId INTEGER,
-        PRIMARY KEY (ActorId, FilmId),
-        FOREIGN KEY (ActorId) REFERENCES Actors (ActorId),
-        FOREIGN KEY (FilmId) REFERENCES Films (FilmId)
+        GenreId INTEGER,
+        PRIMARY KEY (FilmId, GenreId),
+        FOREIGN KEY (FilmId) REFERENCES Films (FilmId),
+        FOREIGN KEY (GenreId) REFERENCES Genres (GenreId)
     )`)
 	if err != nil {
-		log.Error("failed to create table ActorFilm: %w", err)
+		log.Error("failed to create table FilmGenre", slog.Any("error", err))
 		return nil, err
 	}
 
@@ -58,14 +73,14 @@ func New(storagePath string, log *slog.Logger) (*Storage, error) {
         Password TEXT
     )`)
 	if err != nil {
-		log.Error("failed to create table Users: %w", err)
+		log.Error("failed to create table Users", slog.Any("error", err))
 		return nil, err
 	}
 
 
 	rows, err := db.Query("SELECT COUNT(*) FROM Users WHERE Login IN ('Admin', 'User')")
 	if err != nil {
-		log.Error("failed to query Users table:", err)
+		log.Error("failed to query Users table", slog.Any("error", err))
 		return nil, err
 	}
 	
@@ -73,7 +88,7 @@ func New(storagePath string, log *slog.Logger) (*Storage, error) {
 	var count int
 	if rows.Next() {
 		if err := rows.Scan(&count); err != nil {
-			log.Error("failed to scan row:", err)
+			log.Error("failed to scan row", slog.Any("error", err))
 			return nil, err
 		}
 	}
@@ -82,18 +97,22 @@ func New(storagePath string, log *slog.Logger) (*Storage, error) {
 	if count==0 {
 		_, err = db.Exec(`INSERT INTO Users (Login, Password) VALUES ('Admin', 'c1c224b03cd9bc7b6a86d77f5dace40191766c485cd55dc48caf9ac873335d6f')`)
 		if err != nil {
-			log.Error("failed to insert role Admin in table Users: ", err)
+			log.Error("failed to insert role Admin in table Users", slog.Any("error", err))
 			return nil, err
 		}
 
 		_, err = db.Exec(`INSERT INTO Users (Login, Password) VALUES ('User', 'b512d97e7cbf97c273e4db073bbb547aa65a84589227f8f3d9e4a72b9372a24d')`)
 		if err != nil {
-			log.Error("failed to insert role User in table Users: ", err)
+			log.Error("failed to insert role User in table Users", slog.Any("error", err))
 			return nil, err
 		}
 	}
 
-	
- 
+	err = migrate(db, log)
+	if err != nil {
+		log.Error("failed to migrate storage", slog.Any("error", err))
+		return nil, err
+	}
+
 	return &Storage{db: db}, nil
 }
@@ -2,9 +2,14 @@ package sqlite
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,36 +21,34 @@ func TestActors(t *testing.T) {
 		slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 	)
 
-	db, err:= sql.Open("sqlite", "vk-films-testovoe\\filmoteka\\cmd\\main\\storage.db")
+	s, err:= New(filepath.Join(t.TempDir(), "storage.db"), log)
 	if err != nil {
 		require.NoError(t, err)
 	}
 
-	s:=&Storage{db: db}
-
 	actor1:=Actor{
 		Name: "Vova",
 		Gender: "male",
 		BirthDate: "16.05.2000",
-		Films: []string{"Harry Potter"},
+		Films: []Ref{{Name: "Harry Potter"}},
 	}
 	actor2:=Actor{
 		Name: "Lisa",
 		Gender: "female",
 		BirthDate: "13.03.2001",
-		Films: []string{"Harry Potter", "Fast and furious"},
+		Films: []Ref{{Name: "Harry Potter"}, {Name: "Fast and furious"}},
 	}
 
-	err=PostActorToStorage(s,actor1)
+	err=PostActorToStorage(s,actor1,true)
 	if err != nil {
 		require.NoError(t, err)
 	}
-	err=PostActorToStorage(s,actor2)
+	err=PostActorToStorage(s,actor2,true)
 	if err != nil {
 		require.NoError(t, err)
 	}
 
-	actorsList, err:=GetAllActorsFromStorage(s,log)
+	actorsList, err:=GetAllActorsFromStorage(s,log, false)
 	if err != nil {
 		require.NoError(t, err)
 	}
@@ -66,6 +69,10 @@ func TestActors(t *testing.T) {
 		require.Equal(t, count,2)
 	}
 
+	actor1.Films=[]Ref{{Id: 1, Name: "Harry Potter"}}
+	// дата в прежнем формате хранится в ISO 8601
+	actor1.BirthDate="2000-05-16"
+
 	actorFromStorage, err:=GetOneActorFromStorage(s,actor1.ActorId,log)
 	if err != nil {
 		require.NoError(t, err)
@@ -74,13 +81,14 @@ func TestActors(t *testing.T) {
 	assert.Equal(t,actor1,actorFromStorage)
 
 	actor3:=Actor{
+		ActorId: actor2.ActorId,
 		Name: "Lisa",
 		Gender: "female",
-		BirthDate: "14.03.2001",
-		Films: []string{"Harry Potter", "Fast and furious"},
+		BirthDate: "2001-03-14",
+		Films: []Ref{{Id: 1, Name: "Harry Potter"}, {Id: 2, Name: "Fast and furious"}},
 	}
 
-	err=UpdateActor(s,actor3)
+	err=UpdateActor(s,actor3,false)
 	if err != nil {
 		require.NoError(t, err)
 	}
@@ -111,4 +119,1366 @@ func TestActors(t *testing.T) {
 	if err != nil {
 		require.Error(t, err)
 	}
-}
\ No newline at end of file
+}
+func TestGenres(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	err = PostFilmToStorage(s, Film{
+		Title:       "Harry Potter",
+		ReleaseDate: "16.11.2001",
+		CriticRating: 8,
+		Actors:      []Ref{{Name: "Daniel Radcliffe"}},
+		Genres:      []string{"Fantasy", "Adventure"},
+	}, true)
+	require.NoError(t, err)
+
+	err = PostFilmToStorage(s, Film{
+		Title:       "Fast and furious",
+		ReleaseDate: "22.06.2001",
+		CriticRating: 7,
+		Genres:      []string{" Action "},
+	}, true)
+	require.NoError(t, err)
+
+	err = PostFilmToStorage(s, Film{Title: "Untitled", Genres: []string{"  "}}, true)
+	assert.ErrorIs(t, err, ErrEmptyGenre)
+
+	films, err := GetAllFilmsFromStorage(s, log, FilmFilter{Genre: "Fantasy"})
+	require.NoError(t, err)
+	require.Len(t, films, 1)
+	assert.Equal(t, "Harry Potter", films[0].Title)
+	assert.Equal(t, []string{"Adventure", "Fantasy"}, films[0].Genres)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Daniel Radcliffe"}}, films[0].Actors)
+
+	films, err = GetAllFilmsFromStorage(s, log, FilmFilter{})
+	require.NoError(t, err)
+	assert.Len(t, films, 2)
+
+	genres, err := GetAllGenresFromStorage(s, log)
+	require.NoError(t, err)
+	require.Len(t, genres, 3)
+	assert.Equal(t, "Action", genres[0].Name)
+	for _, genre := range genres {
+		assert.Equal(t, 1, genre.FilmsCount)
+	}
+
+	// название занято другим жанром
+	err = UpdateGenre(s, Genre{GenreId: genres[0].GenreId, Name: "Fantasy"})
+	assert.ErrorIs(t, err, ErrGenreExists)
+	require.NoError(t, UpdateGenre(s, Genre{GenreId: genres[0].GenreId, Name: "Action"}))
+
+	err = DeleteGenre(s, genres[0].GenreId)
+	require.NoError(t, err)
+
+	_, err = GetOneGenreFromStorage(s, genres[0].GenreId)
+	assert.Error(t, err)
+
+	// у фильма без жанров пустой список, а не null
+	film, err := GetOneFilmFromStorage(s, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, film.Genres)
+}
+
+func TestCredits(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	err = PostFilmToStorage(s, Film{
+		Title:       "Forrest Gump",
+		ReleaseDate: "06.07.1994",
+		CriticRating: 9,
+		Actors:      []Ref{{Name: "Tom Hanks"}, {Name: "Robin Wright"}},
+		Credits: []Credit{
+			{Name: "Tom Hanks", Role: RoleActor, Character: "Forrest Gump", Position: 1},
+			{Name: "Robert Zemeckis", Role: RoleDirector},
+			{Name: "Alan Silvestri", Role: RoleComposer, Job: "Original Music"},
+		},
+	}, true)
+	require.NoError(t, err)
+
+	films, err := GetAllFilmsFromStorage(s, log, FilmFilter{})
+	require.NoError(t, err)
+	require.Len(t, films, 1)
+
+	film := films[0]
+	assert.Equal(t, []Ref{{Id: 1, Name: "Tom Hanks"}, {Id: 2, Name: "Robin Wright"}}, film.Actors)
+	require.Len(t, film.Credits, 4)
+	assert.Equal(t, "Forrest Gump", film.Credits[0].Character)
+	assert.Equal(t, RoleComposer, film.Credits[2].Role)
+	assert.Equal(t, RoleDirector, film.Credits[3].Role)
+
+	actors, err := GetAllActorsFromStorage(s, log, false)
+	require.NoError(t, err)
+	assert.Len(t, actors, 2)
+
+	directors, err := GetAllPeopleFromStorage(s, log, RoleDirector)
+	require.NoError(t, err)
+	require.Len(t, directors, 1)
+	assert.Equal(t, "Robert Zemeckis", directors[0].Name)
+	assert.Equal(t, "Forrest Gump", directors[0].Credits[0].Title)
+}
+
+func TestMigrateActorFilm(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	path := filepath.Join(t.TempDir(), "storage.db")
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	for _, query := range []string{
+		"CREATE TABLE Actors (ActorId INTEGER PRIMARY KEY, Name TEXT UNIQUE, Gender TEXT, BirthDate TEXT)",
+		"CREATE TABLE Films (FilmId INTEGER PRIMARY KEY, Title TEXT UNIQUE, Description TEXT, ReleaseDate TEXT, Rating INTEGER)",
+		"CREATE TABLE ActorFilm (ActorId INTEGER, FilmId INTEGER, PRIMARY KEY (ActorId, FilmId))",
+		"INSERT INTO Actors VALUES (1, 'Vova', 'male', '16.05.2000'), (2, 'Lisa', 'female', '13.03.2001')",
+		"INSERT INTO Films VALUES (1, 'Harry Potter', '', '16.11.2001', 8)",
+		"INSERT INTO ActorFilm VALUES (2, 1), (1, 1)",
+	} {
+		_, err = db.Exec(query)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	s, err := New(path, log)
+	require.NoError(t, err)
+
+	film, err := GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Vova"}, {Id: 2, Name: "Lisa"}}, film.Actors)
+	assert.Equal(t, "2001-11-16", film.ReleaseDate)
+
+	actor, err := GetOneActorFromStorage(s, 2, log)
+	require.NoError(t, err)
+	assert.Equal(t, "2001-03-13", actor.BirthDate)
+}
+
+func TestCast(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	err = PostFilmToStorage(s, Film{
+		Title:       "Harry Potter",
+		ReleaseDate: "16.11.2001",
+		Actors:      []Ref{{Name: "Daniel Radcliffe"}, {Name: "Rupert Grint"}, {Name: "Emma Watson"}},
+	}, true)
+	require.NoError(t, err)
+
+	film, err := GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	emma := film.Credits[2].PersonId
+
+	err = SetCastMember(s, film.FilmId, emma, CastMember{Character: "Hermione Granger", Position: 2})
+	require.NoError(t, err)
+
+	film, err = GetOneFilmFromStorage(s, film.FilmId)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Daniel Radcliffe"}, {Id: 3, Name: "Emma Watson"}, {Id: 2, Name: "Rupert Grint"}}, film.Actors)
+	assert.Equal(t, "Hermione Granger", film.Credits[1].Character)
+	assert.Equal(t, 3, film.Credits[2].Position)
+
+	err = DeleteCastMember(s, film.FilmId, film.Credits[0].PersonId)
+	require.NoError(t, err)
+
+	film, err = GetOneFilmFromStorage(s, film.FilmId)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 3, Name: "Emma Watson"}, {Id: 2, Name: "Rupert Grint"}}, film.Actors)
+	assert.Equal(t, 1, film.Credits[0].Position)
+	assert.Equal(t, "Hermione Granger", film.Credits[0].Character)
+
+	err = SetCastMember(s, film.FilmId, 100, CastMember{})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// актёр, убранный из фильма через PUT /actors, не оставляет пропуска в позициях
+	err = UpdateActor(s, Actor{ActorId: 3, Name: "Emma Watson", Gender: "female"}, false)
+	require.NoError(t, err)
+
+	film, err = GetOneFilmFromStorage(s, film.FilmId)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 2, Name: "Rupert Grint"}}, film.Actors)
+	assert.Equal(t, 1, film.Credits[0].Position)
+
+	// уточнение персонажа без позиции не переносит актёра в конец титров
+	err = PostFilmToStorage(s, Film{
+		Title:       "Harry Potter and the Chamber of Secrets",
+		ReleaseDate: "2002-11-03",
+		Actors:      []Ref{{Name: "Daniel Radcliffe"}, {Name: "Rupert Grint"}},
+		Credits:     []Credit{{Name: "Daniel Radcliffe", Role: RoleActor, Character: "Harry Potter"}},
+	}, false)
+	require.NoError(t, err)
+
+	film, err = GetOneFilmFromStorage(s, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Daniel Radcliffe"}, {Id: 2, Name: "Rupert Grint"}}, film.Actors)
+	assert.Equal(t, "Harry Potter", film.Credits[0].Character)
+	assert.Equal(t, 1, film.Credits[0].Position)
+}
+
+// failCommits заставляет падать COMMIT транзакций, которые меняют tables: триггер оставляет запись,
+// нарушающую отложенный внешний ключ, а его SQLite проверяет только при фиксации
+func failCommits(t *testing.T, s *Storage, tables ...string) {
+	// PRAGMA действует на соединение, поэтому оно должно быть одно
+	s.db.SetMaxOpenConns(1)
+	queries := []string{
+		"PRAGMA foreign_keys = ON",
+		"CREATE TABLE CommitParents (Id INTEGER PRIMARY KEY)",
+		"CREATE TABLE CommitFailures (ParentId INTEGER REFERENCES CommitParents (Id) DEFERRABLE INITIALLY DEFERRED)",
+	}
+	for _, table := range tables {
+		queries = append(queries, "CREATE TRIGGER FailCommit"+table+" AFTER UPDATE ON "+table+
+			" BEGIN INSERT INTO CommitFailures VALUES (-1); END")
+	}
+
+	for _, query := range queries {
+		_, err := s.db.Exec(query)
+		require.NoError(t, err)
+	}
+}
+
+// TestCommitFailure: ошибка COMMIT возвращается вызывающему, а не теряется в defer
+func TestCommitFailure(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	err = PostFilmToStorage(s, Film{Title: "Forrest Gump", ReleaseDate: "1994-07-06", Actors: []Ref{{Name: "Tom Hanks"}}}, true)
+	require.NoError(t, err)
+
+	failCommits(t, s, "Films", "Actors")
+	err = UpdateFilm(s, Film{FilmId: 1, Title: "Cast Away", ReleaseDate: "2000-12-07"}, false)
+	require.Error(t, err)
+	// SQLite оставляет транзакцию открытой после неудачного COMMIT
+	s.db.Exec("ROLLBACK")
+
+	film, err := GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Forrest Gump", film.Title)
+
+	err = UpdateActor(s, Actor{ActorId: 1, Name: "Thomas Hanks", Gender: "male"}, false)
+	require.Error(t, err)
+	s.db.Exec("ROLLBACK")
+
+	actor, err := GetOneActorFromStorage(s, 1, log)
+	require.NoError(t, err)
+	assert.Equal(t, "Tom Hanks", actor.Name)
+
+	// перенос в корзину тоже меняет строку, и неудачный COMMIT не даёт 204 на неудалённую запись
+	require.Error(t, DeleteFilm(s, 1))
+	s.db.Exec("ROLLBACK")
+	require.Error(t, DeleteActor(s, 1))
+	s.db.Exec("ROLLBACK")
+
+	_, err = GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	_, err = GetOneActorFromStorage(s, 1, log)
+	require.NoError(t, err)
+}
+
+func TestRefs(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Hanks", Gender: "male", BirthDate: "09.07.1956"}, false))
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Hanks", Gender: "male", BirthDate: "01.01.1990"}, false))
+
+	film := Film{Title: "Big", ReleaseDate: "03.06.1988", Actors: []Ref{{Name: "Tom Hanks"}}}
+	err = PostFilmToStorage(s, film, true)
+	assert.ErrorIs(t, err, ErrAmbiguousRef)
+
+	film.Actors = []Ref{{Name: "Tom  Hanks"}}
+	err = PostFilmToStorage(s, film, false)
+	assert.ErrorIs(t, err, ErrUnknownRef)
+
+	film.Actors = []Ref{{Id: 42}}
+	err = PostFilmToStorage(s, film, true)
+	assert.ErrorIs(t, err, ErrUnknownRef)
+
+	_, err = GetOneFilmFromStorage(s, 1)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	film.Actors = []Ref{{Id: 1}}
+	require.NoError(t, PostFilmToStorage(s, film, false))
+
+	saved, err := GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Tom Hanks"}}, saved.Actors)
+}
+
+func TestUserRatings(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "03.06.1988", CriticRating: 5}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Cast Away", ReleaseDate: "22.12.2000", CriticRating: 9}, false))
+
+	require.NoError(t, RateFilm(s, "User", 1, 8))
+	require.NoError(t, RateFilm(s, "Admin", 1, 10))
+	require.NoError(t, RateFilm(s, "User", 2, 4))
+	require.NoError(t, RateFilm(s, "User", 2, 6))
+	assert.ErrorIs(t, RateFilm(s, "User", 3, 6), sql.ErrNoRows)
+
+	film, err := GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 5, film.CriticRating)
+	assert.Equal(t, FilmScore{Average: 9, Votes: 2, Histogram: [10]int{7: 1, 9: 1}}, film.UserScore)
+
+	rating, err := GetUserRating(s, "User", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 6, rating)
+
+	films, err := GetAllFilmsFromStorage(s, log, FilmFilter{Sort: "score", Desc: true})
+	require.NoError(t, err)
+	require.Len(t, films, 2)
+	assert.Equal(t, "Big", films[0].Title)
+	assert.Equal(t, 1, films[1].UserScore.Votes)
+
+	require.NoError(t, DeleteUserRating(s, "Admin", 1))
+	film, err = GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 8.0, film.UserScore.Average)
+
+	// прежнее поле rating принимается, пока не передан criticRating
+	var input Film
+	require.NoError(t, json.Unmarshal([]byte(`{"title":"Big","rating":7}`), &input))
+	assert.Equal(t, 7, input.CriticRating)
+	assert.Equal(t, "Big", input.Title)
+	require.NoError(t, json.Unmarshal([]byte(`{"title":"Big","rating":7,"criticRating":6}`), &input))
+	assert.Equal(t, 6, input.CriticRating)
+}
+
+func TestReviews(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "03.06.1988"}, false))
+
+	userReview, err := PostReviewToStorage(s, Review{FilmId: 1, Login: "User", Text: "Great"})
+	require.NoError(t, err)
+	_, err = PostReviewToStorage(s, Review{FilmId: 1, Login: "Admin", Text: "Fine"})
+	require.NoError(t, err)
+	_, err = PostReviewToStorage(s, Review{FilmId: 2, Login: "User", Text: "No film"})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = PostReviewToStorage(s, Review{FilmId: 1, Login: "User", Text: "Twice"})
+	assert.Error(t, err)
+
+	page, err := GetFilmReviewsFromStorage(s, 1, ReviewApproved, 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, 0, page.Total)
+	assert.Empty(t, page.Reviews)
+
+	require.NoError(t, SetReviewStatus(s, userReview, ReviewApproved))
+
+	page, err = GetFilmReviewsFromStorage(s, 1, ReviewApproved, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, page.Reviews, 1)
+	assert.Equal(t, "Great", page.Reviews[0].Text)
+
+	page, err = GetFilmReviewsFromStorage(s, 1, "", 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	assert.Len(t, page.Reviews, 1)
+
+	assert.ErrorIs(t, UpdateReview(s, Review{ReviewId: userReview, Login: "Admin", Text: "Hijack"}), sql.ErrNoRows)
+	require.NoError(t, UpdateReview(s, Review{ReviewId: userReview, Login: "User", Text: "Great!"}))
+
+	review, err := GetOneReviewFromStorage(s, userReview)
+	require.NoError(t, err)
+	assert.Equal(t, ReviewPending, review.Status)
+	assert.Equal(t, "Great!", review.Text)
+
+	assert.ErrorIs(t, DeleteReview(s, userReview, "Admin"), sql.ErrNoRows)
+	require.NoError(t, DeleteReview(s, userReview, ""))
+}
+
+func TestWatchlist(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "03.06.1988"}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Cast Away", ReleaseDate: "22.12.2000"}, false))
+
+	require.NoError(t, AddToWatchlist(s, "User", 1, "with friends"))
+	require.NoError(t, AddToWatchlist(s, "User", 2, ""))
+	assert.ErrorIs(t, AddToWatchlist(s, "User", 3, ""), sql.ErrNoRows)
+
+	require.NoError(t, MarkWatched(s, "User", 2, "01.02.2024", "liked it"))
+	require.NoError(t, MarkWatched(s, "User", 1, "2023-01-15", ""))
+	assert.ErrorIs(t, MarkWatched(s, "User", 1, "15/01/2023", ""), ErrInvalidDate)
+	require.NoError(t, AddToWatchlist(s, "User", 1, "again"))
+
+	watchlist, err := GetWatchlistFromStorage(s, "User")
+	require.NoError(t, err)
+	require.Len(t, watchlist, 1)
+	assert.Equal(t, Ref{Id: 1, Name: "Big"}, watchlist[0].Film)
+
+	watched, err := GetWatchedFromStorage(s, "User")
+	require.NoError(t, err)
+	require.Len(t, watched, 2)
+	assert.Equal(t, "Cast Away", watched[0].Film.Name)
+	assert.Equal(t, "liked it", watched[0].Note)
+	assert.Equal(t, "2024-02-01", watched[0].WatchedAt)
+	assert.Equal(t, "2023-01-15", watched[1].WatchedAt)
+
+	films, err := GetAllFilmsFromStorage(s, log, FilmFilter{})
+	require.NoError(t, err)
+	require.NoError(t, FillViewerFlags(s, "User", films))
+	assert.True(t, films[0].InWatchlist)
+	assert.True(t, films[0].Watched)
+	assert.False(t, films[1].InWatchlist)
+
+	require.NoError(t, FillViewerFlags(s, "Admin", films))
+	assert.False(t, films[0].Watched)
+
+	require.NoError(t, UnmarkWatched(s, "User", 2))
+	assert.ErrorIs(t, RemoveFromWatchlist(s, "User", 2), sql.ErrNoRows)
+}
+
+func TestMigrateWatchedDates(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	path := filepath.Join(t.TempDir(), "storage.db")
+
+	s, err := New(path, log)
+	require.NoError(t, err)
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big"}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Cast Away"}, false))
+
+	// история просмотров в прежнем формате, записанная до миграции
+	for _, query := range []string{
+		"INSERT INTO Watched (Login, FilmId, WatchedAt) VALUES ('User', 1, '05.03.2022'), ('User', 2, '28.12.2021')",
+		fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion()-1),
+	} {
+		_, err = s.db.Exec(query)
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.db.Close())
+
+	s, err = New(path, log)
+	require.NoError(t, err)
+
+	watched, err := GetWatchedFromStorage(s, "User")
+	require.NoError(t, err)
+	require.Len(t, watched, 2)
+	assert.Equal(t, "2022-03-05", watched[0].WatchedAt)
+	assert.Equal(t, "2021-12-28", watched[1].WatchedAt)
+}
+
+func TestBatch(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	err = RunBatch(s, true, func(b *Batch) error {
+		return b.Row(func() error {
+			_, err := b.PostFilm(Film{Title: "Big", ReleaseDate: "03.06.1988"}, false)
+			return err
+		})
+	})
+	require.NoError(t, err)
+
+	films, err := GetAllFilmsFromStorage(s, log, FilmFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, films)
+
+	err = RunBatch(s, false, func(b *Batch) error {
+		require.NoError(t, b.Row(func() error {
+			_, err := b.PostFilm(Film{Title: "Big", ReleaseDate: "03.06.1988"}, false)
+			return err
+		}))
+
+		// ошибка в строке откатывает только её изменения
+		err := b.Row(func() error {
+			_, err := b.PostFilm(Film{Title: "Splash", ReleaseDate: "09.03.1984", Actors: []Ref{{Name: "Nobody"}}}, false)
+			return err
+		})
+		assert.ErrorIs(t, err, ErrUnknownRef)
+
+		id, err := b.FindFilm(Ref{Name: "Big"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, id)
+
+		_, err = b.FindFilm(Ref{Name: "Splash"})
+		assert.ErrorIs(t, err, ErrUnknownRef)
+
+		return b.Row(func() error {
+			_, err := b.PostActor(Actor{Name: "Tom Hanks", Gender: "male", BirthDate: "09.07.1956", Films: []Ref{{Name: "Big"}}}, false)
+			return err
+		})
+	})
+	require.NoError(t, err)
+
+	films, err = GetAllFilmsFromStorage(s, log, FilmFilter{})
+	require.NoError(t, err)
+	require.Len(t, films, 1)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Tom Hanks"}}, films[0].Actors)
+}
+
+func TestExport(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostFilmToStorage(s, Film{
+		Title:       "Big",
+		ReleaseDate: "03.06.1988",
+		Actors:      []Ref{{Name: "Tom Hanks"}},
+		Genres:      []string{"comedy"},
+	}, true))
+
+	counts := map[string]int{}
+	err = RunExport(s, func(x *Export) error {
+		for _, table := range ExportTables {
+			err := x.Rows(table, func(values []any) error {
+				require.Len(t, values, len(table.Columns))
+				counts[table.Name]++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return x.Rows(ExportTables[0], func(values []any) error {
+			assert.Equal(t, []any{int64(1), "Big", "", int64(0), "1988-06-03", nil}, values)
+
+			// выгрузка не мешает записи, а запись не попадает в её снимок
+			require.NoError(t, PostFilmToStorage(s, Film{Title: "Splash", ReleaseDate: "1984-03-09", Genres: []string{"comedy"}}, false))
+			return x.Rows(ExportTables[0], func(values []any) error {
+				counts["films after write"]++
+				return nil
+			})
+		})
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{"films": 1, "people": 1, "genres": 1, "film_genres": 1, "credits": 1, "films after write": 1}, counts)
+
+	films, err := GetAllFilmsFromStorage(s, log, FilmFilter{})
+	require.NoError(t, err)
+	assert.Len(t, films, 2)
+}
+
+func TestBackup(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	dir := t.TempDir()
+	storagePath := filepath.Join(dir, "storage.db")
+
+	s, err := New(storagePath, log)
+	require.NoError(t, err)
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "03.06.1988"}, false))
+
+	backupPath := filepath.Join(dir, "backup.db")
+	require.NoError(t, Backup(s, backupPath))
+
+	version, err := CheckBackup(backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion(), version)
+
+	_, err = CheckBackup(filepath.Join(dir, "missing.db"))
+	assert.Error(t, err)
+
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Splash", ReleaseDate: "09.03.1984"}, false))
+	require.NoError(t, s.db.Close())
+
+	require.NoError(t, Restore(backupPath, storagePath))
+	assert.FileExists(t, storagePath+".before-restore")
+
+	s, err = New(storagePath, log)
+	require.NoError(t, err)
+	films, err := GetAllFilmsFromStorage(s, log, FilmFilter{})
+	require.NoError(t, err)
+	require.Len(t, films, 1)
+	assert.Equal(t, "Big", films[0].Title)
+
+	backups := filepath.Join(dir, "backups")
+	for _, name := range []string{"filmoteka-20240101-000000.db", "filmoteka-20240102-000000.db", "filmoteka-20240103-000000.db"} {
+		require.NoError(t, os.MkdirAll(backups, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(backups, name), nil, 0o644))
+	}
+	removed, err := PruneBackups(backups, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(backups, "filmoteka-20240101-000000.db")}, removed)
+
+	// две копии подряд получают разные имена
+	first, err := BackupToDir(s, backups)
+	require.NoError(t, err)
+	second, err := BackupToDir(s, backups)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.FileExists(t, first)
+	assert.FileExists(t, second)
+}
+
+func TestAuditLog(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	admin := s.As("Admin")
+	require.NoError(t, PostFilmToStorage(admin, Film{Title: "Big", ReleaseDate: "03.06.1988", Genres: []string{"comedy"}}, false))
+	require.NoError(t, UpdateFilm(admin, Film{FilmId: 1, Title: "Big", CriticRating: 8, ReleaseDate: "03.06.1988"}, false))
+	require.NoError(t, RateFilm(s, "User", 1, 9))
+	require.NoError(t, DeleteFilm(admin, 1))
+	// повторное удаление фильма из корзины не проходит и в журнал не попадает
+	require.ErrorIs(t, DeleteFilm(admin, 1), sql.ErrNoRows)
+
+	page, err := GetAuditLogFromStorage(s, AuditFilter{EntityType: EntityFilm, EntityId: 1}, 1, 20)
+	require.NoError(t, err)
+	require.Equal(t, 3, page.Total)
+
+	deleted, updated, created := page.Entries[0], page.Entries[1], page.Entries[2]
+	assert.Equal(t, AuditDelete, deleted.Action)
+	assert.Equal(t, "Admin", deleted.Principal)
+	assert.JSONEq(t, string(updated.After), string(deleted.Before))
+	assert.NotContains(t, string(deleted.After), `"deletedAt":null`)
+	assert.Equal(t, AuditCreate, created.Action)
+	assert.JSONEq(t, "null", string(created.Before))
+	assert.JSONEq(t, `{"id":1,"title":"Big","description":"","criticRating":0,"releaseDate":"1988-06-03","deletedAt":null,"genres":["comedy"],"credits":[]}`, string(created.After))
+	assert.JSONEq(t, string(created.After), string(updated.Before))
+	assert.JSONEq(t, `{"id":1,"title":"Big","description":"","criticRating":8,"releaseDate":"1988-06-03","deletedAt":null,"genres":[],"credits":[]}`, string(updated.After))
+
+	page, err = GetAuditLogFromStorage(s, AuditFilter{Principal: "User"}, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, EntityRating, page.Entries[0].EntityType)
+	assert.JSONEq(t, `{"filmId":1,"login":"User","rating":9}`, string(page.Entries[0].After))
+
+	page, err = GetAuditLogFromStorage(s, AuditFilter{From: "2000-01-01 00:00:00", To: "2000-01-02 00:00:00"}, 1, 20)
+	require.NoError(t, err)
+	assert.Zero(t, page.Total)
+}
+
+func TestSoftDelete(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Hanks", Gender: "male", BirthDate: "09.07.1956"}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "03.06.1988", Actors: []Ref{{Id: 1}}, Genres: []string{"comedy"}}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Cast Away", ReleaseDate: "22.12.2000", Actors: []Ref{{Id: 1}}}, false))
+
+	require.NoError(t, DeleteFilm(s, 1))
+
+	_, err = GetOneFilmFromStorage(s, 1)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, RateFilm(s, "User", 1, 8), sql.ErrNoRows)
+
+	films, err := GetAllFilmsFromStorage(s, log, FilmFilter{})
+	require.NoError(t, err)
+	require.Len(t, films, 1)
+	assert.Equal(t, "Cast Away", films[0].Title)
+
+	trash, err := GetAllFilmsFromStorage(s, log, FilmFilter{Deleted: true})
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.NotEmpty(t, trash[0].DeletedAt)
+
+	actor, err := GetOneActorFromStorage(s, 1, log)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 2, Name: "Cast Away"}}, actor.Films)
+
+	genres, err := GetAllGenresFromStorage(s, log)
+	require.NoError(t, err)
+	require.Len(t, genres, 1)
+	assert.Zero(t, genres[0].FilmsCount)
+
+	// восстановленный фильм возвращается со своим составом
+	require.NoError(t, RestoreFilm(s, 1))
+	assert.ErrorIs(t, RestoreFilm(s, 1), sql.ErrNoRows)
+
+	film, err := GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Tom Hanks"}}, film.Actors)
+	assert.Empty(t, film.DeletedAt)
+
+	require.NoError(t, DeleteActor(s, 1))
+
+	film, err = GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Empty(t, film.Actors)
+
+	actors, err := GetAllActorsFromStorage(s, log, true)
+	require.NoError(t, err)
+	require.Len(t, actors, 1)
+
+	// очистка не трогает свежую корзину
+	purged, err := PurgeDeleted(s, time.Hour)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	require.NoError(t, DeleteFilm(s, 2))
+	purged, err = PurgeDeleted(s, -time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	assert.ErrorIs(t, RestoreFilm(s, 2), sql.ErrNoRows)
+	assert.ErrorIs(t, RestoreActor(s, 1), sql.ErrNoRows)
+
+	var credits int
+	require.NoError(t, s.db.QueryRow("SELECT COUNT(*) FROM Credits").Scan(&credits))
+	assert.Zero(t, credits)
+
+	page, err := GetAuditLogFromStorage(s, AuditFilter{Principal: SystemPrincipal}, 1, 20)
+	require.NoError(t, err)
+	require.Equal(t, 9, page.Total)
+	for _, entry := range page.Entries[:2] {
+		assert.Equal(t, AuditPurge, entry.Action)
+		assert.JSONEq(t, "null", string(entry.After))
+	}
+
+	// название фильма из корзины свободно и для нового фильма, и для создания по ссылке
+	require.NoError(t, DeleteFilm(s, 1))
+	newID, err := CreateFilm(s, Film{Title: "Big", ReleaseDate: "1988"}, false)
+	require.NoError(t, err)
+	assert.ErrorIs(t, RestoreFilm(s, 1), ErrTitleTaken)
+	require.NoError(t, DeleteFilm(s, newID))
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Elizabeth Perkins", Gender: "female", Films: []Ref{{Name: "Big"}}}, true))
+
+	trash, err = GetAllFilmsFromStorage(s, log, FilmFilter{Deleted: true})
+	require.NoError(t, err)
+	assert.Len(t, trash, 2)
+	films, err = GetAllFilmsFromStorage(s, log, FilmFilter{})
+	require.NoError(t, err)
+	require.Len(t, films, 1)
+	assert.Equal(t, "Big", films[0].Title)
+	assert.NotContains(t, []int{1, newID}, films[0].FilmId)
+}
+
+func TestRevisions(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	editor := s.As("Admin")
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Hanks", Gender: "male", BirthDate: "09.07.1956"}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", Description: "first", ReleaseDate: "03.06.1988", Actors: []Ref{{Id: 1}}}, false))
+	require.NoError(t, UpdateFilm(editor, Film{FilmId: 1, Title: "Big", Description: "second", ReleaseDate: "03.06.1988"}, false))
+	// изменение без отличий версию не создаёт
+	require.NoError(t, UpdateFilm(editor, Film{FilmId: 1, Title: "Big", Description: "second", ReleaseDate: "03.06.1988"}, false))
+
+	revisions, err := GetRevisionsFromStorage(s, EntityFilm, 1)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, 1, revisions[0].Number)
+	assert.Equal(t, "Admin", revisions[0].ReplacedBy)
+	assert.Equal(t, []FieldChange{
+		{Field: "credits", Before: json.RawMessage(`[{"personId":1,"role":"actor","character":"","job":"","position":1}]`), After: json.RawMessage(`[]`)},
+		{Field: "description", Before: json.RawMessage(`"first"`), After: json.RawMessage(`"second"`)},
+	}, revisions[0].Changes)
+
+	require.NoError(t, RevertFilm(editor, 1, 1))
+
+	film, err := GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "first", film.Description)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Tom Hanks"}}, film.Actors)
+
+	changes, err := DiffRevisions(s, EntityFilm, 1, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	changes, err = DiffRevisions(s, EntityFilm, 1, 1, 0)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = DiffRevisions(s, EntityFilm, 1, 5, 0)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = GetRevisionsFromStorage(s, EntityPerson, 42)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, UpdateActor(editor, Actor{ActorId: 1, Name: "Thomas Hanks", Gender: "male", BirthDate: "09.07.1956"}, false))
+	require.NoError(t, RevertActor(editor, 1, 1))
+
+	actor, err := GetOneActorFromStorage(s, 1, log)
+	require.NoError(t, err)
+	assert.Equal(t, "Tom Hanks", actor.Name)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Big"}}, actor.Films)
+
+	// версия ссылается на фильм из корзины
+	require.NoError(t, DeleteFilm(editor, 1))
+	require.NoError(t, RestoreFilm(editor, 1))
+	require.NoError(t, UpdateActor(editor, Actor{ActorId: 1, Name: "Tom Hanks", Gender: "male", BirthDate: "09.07.1956"}, false))
+	require.NoError(t, DeleteFilm(editor, 1))
+	assert.ErrorIs(t, RevertActor(editor, 1, 3), ErrUnknownRef)
+}
+
+func TestMerge(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Hanks", Gender: "male"}, false))
+	// дубль с лишним пробелом, созданный по ссылке из фильма
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "03.06.1988", Actors: []Ref{{Name: "Tom  Hanks"}}, Genres: []string{"comedy"}}, true))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big (1988)", Description: "A boy wakes up big", Actors: []Ref{{Id: 1}}, Genres: []string{"fantasy"}}, false))
+	require.NoError(t, UpdateActor(s, Actor{ActorId: 2, Name: "Tom  Hanks", BirthDate: "09.07.1956", Films: []Ref{{Id: 1}}}, false))
+	require.NoError(t, RateFilm(s, "User", 1, 6))
+	require.NoError(t, RateFilm(s, "User", 2, 8))
+	require.NoError(t, RateFilm(s, "Admin", 2, 10))
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Thomas Hanks"}, false))
+
+	assert.ErrorIs(t, MergeActors(s, 1, 1, MergeFill), ErrSelfMerge)
+	assert.ErrorIs(t, MergeActors(s, 1, 42, MergeFill), sql.ErrNoRows)
+
+	require.NoError(t, MergeActors(s, 1, 2, MergeFill))
+
+	actor, err := GetOneActorFromStorage(s, 1, log)
+	require.NoError(t, err)
+	assert.Equal(t, "Tom Hanks", actor.Name)
+	assert.Equal(t, "1956-07-09", actor.BirthDate)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Big"}, {Id: 2, Name: "Big (1988)"}}, actor.Films)
+
+	_, err = GetOneActorFromStorage(s, 2, log)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	target, err := ResolveAlias(s, EntityPerson, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, target)
+
+	// старый ID дубля продолжает работать в ссылках
+	require.NoError(t, UpdateFilm(s, Film{FilmId: 1, Title: "Big", ReleaseDate: "03.06.1988", Actors: []Ref{{Id: 2}}, Genres: []string{"comedy"}}, false))
+
+	require.NoError(t, MergeFilms(s, 1, 2, MergeTake))
+
+	film, err := GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Big (1988)", film.Title)
+	assert.Equal(t, "A boy wakes up big", film.Description)
+	assert.Equal(t, "1988-06-03", film.ReleaseDate)
+	assert.ElementsMatch(t, []string{"comedy", "fantasy"}, film.Genres)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Tom Hanks"}}, film.Actors)
+	// оценка пользователя у оставшегося фильма не перезаписывается
+	assert.Equal(t, FilmScore{Average: 8, Votes: 2, Histogram: [10]int{5: 1, 9: 1}}, film.UserScore)
+
+	// слияние цепочкой: псевдонимы слитой записи переходят к новой
+	require.NoError(t, MergeActors(s, 3, 1, MergeKeep))
+	target, err = ResolveAlias(s, EntityPerson, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, target)
+
+	page, err := GetAuditLogFromStorage(s, AuditFilter{EntityType: EntityFilm, EntityId: 2}, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, AuditMerge, page.Entries[0].Action)
+}
+
+// TestMergeMaxID сливает записи с наибольшим ID: новые записи не должны получить их ID,
+// иначе старый ID перестал бы вести на оставшуюся запись
+func TestMergeMaxID(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Harry Potter", Actors: []Ref{{Name: "Daniel Radcliffe"}, {Name: "Rupert Grint"}}}, true))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Harry Potter (2001)", Actors: []Ref{{Name: "Emma Watson"}, {Id: 1}}}, true))
+
+	require.NoError(t, MergeFilms(s, 1, 2, MergeKeep))
+
+	film, err := GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Daniel Radcliffe"}, {Id: 2, Name: "Rupert Grint"}, {Id: 3, Name: "Emma Watson"}}, film.Actors)
+	for i, credit := range film.Credits {
+		assert.Equal(t, i+1, credit.Position)
+	}
+
+	filmID, err := CreateFilm(s, Film{Title: "Chamber of Secrets"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, filmID)
+
+	// ссылка по старому ID ведёт на оставшийся фильм, а не на новый
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Felton", Gender: "male", Films: []Ref{{Id: 2}}}, false))
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "R. Grint", Gender: "male", Films: []Ref{{Id: 2}}}, false))
+	_, err = GetOneFilmFromStorage(s, 2)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, MergeActors(s, 2, 5, MergeKeep))
+
+	film, err = GetOneFilmFromStorage(s, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 1, Name: "Daniel Radcliffe"}, {Id: 2, Name: "Rupert Grint"}, {Id: 3, Name: "Emma Watson"}, {Id: 4, Name: "Tom Felton"}}, film.Actors)
+	for i, credit := range film.Credits {
+		assert.Equal(t, i+1, credit.Position)
+	}
+
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Bonnie Wright", Gender: "female"}, false))
+	actors, err := GetAllActorsFromStorage(s, log, false)
+	require.NoError(t, err)
+	assert.Equal(t, 6, actors[len(actors)-1].ActorId)
+
+	require.NoError(t, UpdateFilm(s, Film{FilmId: 3, Title: "Chamber of Secrets", Actors: []Ref{{Id: 5}}}, false))
+	film, err = GetOneFilmFromStorage(s, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []Ref{{Id: 2, Name: "Rupert Grint"}}, film.Actors)
+}
+
+func TestDuplicates(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	assert.Equal(t, "tom hanks", NormalizeName("  Tom  HANKS "))
+	assert.Equal(t, "fedor bondarchuk", NormalizeName("Фёдор Бондарчук"))
+	assert.Equal(t, "fedor bondarchuk", NormalizeName("Федор Бондарчук"))
+	assert.Equal(t, "big 1988", NormalizeName("Big (1988)"))
+	assert.Equal(t, 3, editDistance([]rune("kitten"), []rune("sitting")))
+
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Hanks", BirthDate: "09.07.1956"}, false))
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom  Hanks"}, false))
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Том Хэнкс"}, false))
+	// тёзка с другой датой рождения - другой человек
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Hanks", BirthDate: "01.01.1990"}, false))
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Фёдор Бондарчук"}, false))
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Fedor Bondarchuk"}, false))
+
+	calls := 0
+	pairs, err := FindDuplicates(s, DuplicatePeople, 0.85, func(done, total int) {
+		calls++
+		assert.Equal(t, 6, total)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 6, calls)
+
+	found := map[[2]int]float64{}
+	for _, pair := range pairs {
+		found[[2]int{pair.First.Id, pair.Second.Id}] = pair.Score
+	}
+	assert.Equal(t, 1.0, found[[2]int{1, 2}])
+	assert.Equal(t, 1.0, found[[2]int{5, 6}])
+	assert.InDelta(t, 1-1.0/9, found[[2]int{1, 3}], 0.001)
+	assert.NotContains(t, found, [2]int{1, 4})
+	assert.Equal(t, 1.0, pairs[0].Score)
+
+	_, err = FindDuplicates(s, "genres", 0.85, nil)
+	assert.Error(t, err)
+}
+
+func TestDates(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	for input, want := range map[string]string{
+		"1988-06-03": "1988-06-03",
+		"1988-06":    "1988-06",
+		"1927":       "1927",
+		"03.06.1988": "1988-06-03",
+		"06.1988":    "1988-06",
+	} {
+		date, err := NormalizeDate(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, date)
+	}
+	for _, input := range []string{"", "1988-13-01", "31.02.1988", "88", "3.6.1988"} {
+		_, err := NormalizeDate(input)
+		assert.ErrorIs(t, err, ErrInvalidDate, input)
+	}
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Metropolis", ReleaseDate: "1927"}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "03.06.1988"}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Cast Away", ReleaseDate: "2000-12-22", Actors: []Ref{{Name: "Tom Hanks"}}}, true))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Solaris", ReleaseDate: "1972-03"}, false))
+	assert.ErrorIs(t, PostFilmToStorage(s, Film{Title: "Wrong", ReleaseDate: "1988/06/03"}, false), ErrInvalidDate)
+
+	films, err := GetAllFilmsFromStorage(s, log, FilmFilter{Sort: "release_date"})
+	require.NoError(t, err)
+	titles := []string{}
+	for _, film := range films {
+		titles = append(titles, film.Title)
+	}
+	assert.Equal(t, []string{"Metropolis", "Solaris", "Big", "Cast Away"}, titles)
+
+	films, err = GetAllFilmsFromStorage(s, log, FilmFilter{ReleasedFrom: "1972", ReleasedTo: "1988", Sort: "release_date"})
+	require.NoError(t, err)
+	require.Len(t, films, 2)
+	assert.Equal(t, "1972-03", films[0].ReleaseDate)
+	assert.Equal(t, "1988-06-03", films[1].ReleaseDate)
+
+	// у человека, созданного по ссылке, даты нет
+	var birthDate sql.NullString
+	require.NoError(t, s.db.QueryRow("SELECT BirthDate FROM Actors WHERE Name = 'Tom Hanks'").Scan(&birthDate))
+	assert.False(t, birthDate.Valid)
+}
+
+func TestGraphQueries(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "1988-06-03", Genres: []string{"comedy"},
+		Actors: []Ref{{Name: "Tom Hanks"}, {Name: "Elizabeth Perkins"}}}, true))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Cast Away", ReleaseDate: "2000-12-22", Genres: []string{"drama", "adventure"},
+		Actors:  []Ref{{Name: "Tom Hanks"}},
+		Credits: []Credit{{Name: "Robert Zemeckis", Role: RoleDirector}}}, true))
+	filmID, err := CreateFilm(s, Film{Title: "Twister", ReleaseDate: "1996"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, filmID)
+	require.NoError(t, DeleteFilm(s, 3))
+
+	films, total, err := FindFilms(s, FilmFilter{Sort: "title"}, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, films, 1)
+	assert.Equal(t, "Cast Away", films[0].Title)
+	assert.Nil(t, films[0].Actors)
+
+	actors, total, err := FindActors(s, "hanks", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "Tom Hanks", actors[0].Name)
+
+	// режиссёр в /actors не попадает
+	_, total, err = FindActors(s, "", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+
+	byID, err := FilmsByID(s, []int{1, 2, 3, 42})
+	require.NoError(t, err)
+	assert.Len(t, byID, 2)
+	assert.Equal(t, "Big", byID[1].Title)
+
+	people, err := ActorsByID(s, []int{1, 3})
+	require.NoError(t, err)
+	assert.Equal(t, "Robert Zemeckis", people[3].Name)
+
+	filmCredits, err := CreditsForFilms(s, []int{1, 2})
+	require.NoError(t, err)
+	require.Len(t, filmCredits[2], 2)
+	assert.Equal(t, RoleActor, filmCredits[2][0].Role)
+	assert.Equal(t, "Tom Hanks", filmCredits[2][0].Name)
+	assert.Equal(t, "Cast Away", filmCredits[2][0].Title)
+	assert.Equal(t, RoleDirector, filmCredits[2][1].Role)
+	assert.Equal(t, "Elizabeth Perkins", filmCredits[1][1].Name)
+
+	personCredits, err := CreditsForPeople(s, []int{1, 2})
+	require.NoError(t, err)
+	require.Len(t, personCredits[1], 2)
+	assert.Equal(t, "Big", personCredits[1][0].Title)
+	assert.Equal(t, "Cast Away", personCredits[1][1].Title)
+	assert.Len(t, personCredits[2], 1)
+
+	genres, err := GenresForFilms(s, []int{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"adventure", "drama"}, genres[2])
+	assert.Equal(t, []string{"comedy"}, genres[1])
+}
+
+func TestStreams(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Cast Away", ReleaseDate: "2000-12-22", Actors: []Ref{{Name: "Tom Hanks"}}, Genres: []string{"drama"}}, true))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "1988-06-03", Actors: []Ref{{Name: "Tom Hanks"}, {Name: "Elizabeth Perkins"}}}, true))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Philadelphia", ReleaseDate: "1993-12-22", Actors: []Ref{{Name: "Denzel Washington"}, {Name: "Tom Hanks"}}}, true))
+	// фильмов больше, чем помещается в одну пачку
+	for i := 0; i < streamChunk+5; i++ {
+		require.NoError(t, PostFilmToStorage(s, Film{Title: fmt.Sprintf("Short %03d", i), ReleaseDate: "2010"}, false))
+	}
+
+	titles := []string{}
+	require.NoError(t, StreamFilms(s, FilmFilter{Search: "hanks", Sort: "release_date"}, func(film Film) error {
+		titles = append(titles, film.Title)
+		return nil
+	}))
+	assert.Equal(t, []string{"Big", "Philadelphia", "Cast Away"}, titles)
+
+	titles = []string{}
+	require.NoError(t, StreamFilms(s, FilmFilter{Search: "PHILA"}, func(film Film) error {
+		titles = append(titles, film.Title)
+		assert.Equal(t, []Ref{{Id: 3, Name: "Denzel Washington"}, {Id: 1, Name: "Tom Hanks"}}, film.Actors)
+		return nil
+	}))
+	assert.Equal(t, []string{"Philadelphia"}, titles)
+
+	count := 0
+	require.NoError(t, StreamFilms(s, FilmFilter{}, func(film Film) error {
+		count++
+		if film.Title == "Cast Away" {
+			assert.Equal(t, []string{"drama"}, film.Genres)
+			assert.Len(t, film.Credits, 1)
+		}
+		return nil
+	}))
+	assert.Equal(t, streamChunk+8, count)
+
+	// ошибка получателя прерывает выборку
+	stop := errors.New("stop")
+	count = 0
+	err = StreamFilms(s, FilmFilter{}, func(film Film) error {
+		count++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, count)
+
+	actors := map[string][]Ref{}
+	require.NoError(t, StreamActors(s, "", func(actor Actor) error {
+		actors[actor.Name] = actor.Films
+		return nil
+	}))
+	assert.Len(t, actors, 3)
+	assert.Equal(t, []Ref{{Id: 2, Name: "Big"}, {Id: 3, Name: "Philadelphia"}, {Id: 1, Name: "Cast Away"}}, actors["Tom Hanks"])
+}
+
+func TestUsers(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	// роли встроенных пользователей выставляет миграция
+	users, err := ListUsers(s)
+	require.NoError(t, err)
+	assert.Equal(t, []User{{Login: "Admin", Role: "admin"}, {Login: "User", Role: "user"}}, users)
+
+	require.NoError(t, CreateUser(s, User{Login: "alice", Role: "user", Password: "hash"}))
+	assert.ErrorIs(t, CreateUser(s, User{Login: "alice", Role: "admin", Password: "other"}), ErrUserExists)
+	assert.ErrorIs(t, CreateUser(s, User{Login: "key/import", Role: "user", Password: "hash"}), ErrReservedLogin)
+
+	require.NoError(t, SetUserRole(s, "alice", "admin"))
+	require.NoError(t, SetUserPassword(s, "alice", "new-hash"))
+	user, err := GetUser(s, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, User{Login: "alice", Role: "admin", Password: "new-hash"}, user)
+
+	assert.ErrorIs(t, SetUserRole(s, "bob", "admin"), sql.ErrNoRows)
+	assert.ErrorIs(t, SetUserPassword(s, "bob", "hash"), sql.ErrNoRows)
+	_, err = GetUser(s, "bob")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestEvents(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	first, last, err := EventRange(s)
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{1, 0}, [2]int{first, last})
+
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Hanks", Gender: "male", BirthDate: "1956-07-09"}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "1988", Actors: []Ref{{Id: 1}}}, false))
+	// без изменений в составе актёр события не получает
+	require.NoError(t, UpdateFilm(s, Film{FilmId: 1, Title: "Big", CriticRating: 8, ReleaseDate: "1988", Actors: []Ref{{Id: 1}}}, false))
+	// повторное сохранение без изменений событий не даёт
+	require.NoError(t, UpdateFilm(s, Film{FilmId: 1, Title: "Big", CriticRating: 8, ReleaseDate: "1988", Actors: []Ref{{Id: 1}}}, false))
+	require.NoError(t, UpdateActor(s, Actor{ActorId: 1, Name: "Thomas Hanks", Gender: "male", BirthDate: "1956-07-09", Films: []Ref{{Id: 1}}}, false))
+	require.NoError(t, RateFilm(s, "User", 1, 9))
+	require.NoError(t, PostGenreToStorage(s, Genre{Name: "comedy"}))
+	require.NoError(t, DeleteFilm(s, 1))
+	_, err = PurgeDeleted(s, -time.Hour)
+	require.NoError(t, err)
+
+	events, err := EventsAfter(s, 0, 100)
+	require.NoError(t, err)
+
+	type change struct {
+		Type   string
+		Entity string
+		Id     int
+	}
+	changes := []change{}
+	for i, event := range events {
+		assert.Equal(t, i+1, event.EventId)
+		assert.NotEmpty(t, event.CreatedAt)
+		changes = append(changes, change{event.Type, event.Entity, event.EntityId})
+	}
+	assert.Equal(t, []change{
+		{EventCreated, EntityPerson, 1},
+		{EventCreated, EntityFilm, 1},
+		{EventUpdated, EntityPerson, 1},
+		{EventUpdated, EntityFilm, 1},
+		{EventUpdated, EntityPerson, 1},
+		{EventUpdated, EntityFilm, 1},
+		{EventUpdated, EntityFilm, 1},
+		{EventDeleted, EntityFilm, 1},
+		{EventUpdated, EntityPerson, 1},
+	}, changes)
+
+	events, err = EventsAfter(s, 7, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, 8, events[0].EventId)
+
+	pruned, err := PruneEvents(s, time.Hour)
+	require.NoError(t, err)
+	assert.Zero(t, pruned)
+
+	// после очистки ID продолжаются, а не начинаются заново
+	pruned, err = PruneEvents(s, -time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 9, pruned)
+
+	first, last, err = EventRange(s)
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{10, 9}, [2]int{first, last})
+
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Meg Ryan", Gender: "female"}, false))
+	events, err = EventsAfter(s, 9, 100)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, 10, events[0].EventId)
+}
+
+func TestWebhooks(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	films, err := CreateWebhook(s, Webhook{URL: "http://films", Events: []string{"film.created", "film.deleted"}, Secret: "a", Active: true})
+	require.NoError(t, err)
+	people, err := CreateWebhook(s, Webhook{URL: "http://people", Events: []string{"person.created"}, Secret: "b"})
+	require.NoError(t, err)
+
+	webhooks, err := ListWebhooks(s)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+	assert.Equal(t, []string{"film.created", "film.deleted"}, webhooks[0].Events)
+	assert.False(t, webhooks[1].Active)
+
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Tom Hanks", Gender: "male"}, false))
+	require.NoError(t, PostFilmToStorage(s, Film{Title: "Big", ReleaseDate: "1988"}, false))
+	require.NoError(t, UpdateFilm(s, Film{FilmId: 1, Title: "Big", CriticRating: 8, ReleaseDate: "1988"}, false))
+
+	now := time.Now().Add(time.Second)
+	due, err := DueDeliveries(s, now, 100)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	delivery := due[0]
+	assert.Equal(t, films, delivery.WebhookId)
+	assert.Equal(t, "film.created", delivery.Event)
+	assert.Equal(t, "http://films", delivery.URL)
+	assert.Equal(t, "a", delivery.Secret)
+	assert.JSONEq(t, fmt.Sprintf(`{"id":%d,"type":"created","entity":"film","entityId":1,"createdAt":%q}`,
+		delivery.EventId, delivery.CreatedAt), string(delivery.Payload))
+
+	// только dead можно вернуть в очередь
+	assert.ErrorIs(t, RetryDelivery(s, films, delivery.DeliveryId), sql.ErrNoRows)
+
+	attempt := DeliveryAttempt{StatusCode: 500, Error: "unexpected status 500", DurationMs: 3, AttemptedAt: "2024-05-01 12:00:00"}
+	require.NoError(t, RecordAttempt(s, delivery.DeliveryId, attempt, DeliveryPending, now.Add(time.Hour)))
+	due, err = DueDeliveries(s, now, 100)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	require.NoError(t, RecordAttempt(s, delivery.DeliveryId, attempt, DeliveryDead, time.Time{}))
+	page, err := GetDeliveries(s, films, DeliveryDead, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, page.Total)
+	assert.Equal(t, 2, page.Deliveries[0].Attempts)
+	assert.Equal(t, "unexpected status 500", page.Deliveries[0].LastError)
+	assert.Empty(t, page.Deliveries[0].NextAttemptAt)
+	assert.Equal(t, []DeliveryAttempt{attempt, attempt}, page.Deliveries[0].Log)
+
+	assert.ErrorIs(t, RetryDelivery(s, people, delivery.DeliveryId), sql.ErrNoRows)
+	require.NoError(t, RetryDelivery(s, films, delivery.DeliveryId))
+	due, err = DueDeliveries(s, now, 100)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Zero(t, due[0].Attempts)
+
+	require.NoError(t, RecordAttempt(s, delivery.DeliveryId, DeliveryAttempt{StatusCode: 204, AttemptedAt: "2024-05-01 13:00:00"}, DeliveryDelivered, time.Time{}))
+	page, err = GetDeliveries(s, films, "", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, page.Deliveries, 1)
+	assert.Equal(t, DeliveryDelivered, page.Deliveries[0].Status)
+	assert.Equal(t, "2024-05-01 13:00:00", page.Deliveries[0].DeliveredAt)
+	assert.Empty(t, page.Deliveries[0].LastError)
+	assert.Len(t, page.Deliveries[0].Log, 3)
+
+	// активная подписка получает события, записанные после включения
+	require.NoError(t, UpdateWebhook(s, Webhook{WebhookId: people, URL: "http://people", Events: []string{"person.created"}, Secret: "b", Active: true}))
+	require.NoError(t, PostActorToStorage(s, Actor{Name: "Meg Ryan", Gender: "female"}, false))
+	require.NoError(t, DeleteFilm(s, 1))
+	due, err = DueDeliveries(s, now, 100)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, []string{"person.created", "film.deleted"}, []string{due[0].Event, due[1].Event})
+
+	// очередь не очищается, завершённые доставки удаляются вместе с журналом
+	pruned, err := PruneDeliveries(s, -time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+	page, err = GetDeliveries(s, films, "", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, page.Total)
+
+	require.NoError(t, DeleteWebhook(s, films))
+	assert.ErrorIs(t, DeleteWebhook(s, films), sql.ErrNoRows)
+	_, err = GetWebhook(s, films)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	due, err = DueDeliveries(s, now, 100)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, people, due[0].WebhookId)
+}
+
+func TestAPIKeys(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, err := New(filepath.Join(t.TempDir(), "storage.db"), log)
+	require.NoError(t, err)
+
+	id, err := CreateAPIKey(s.As("Admin"), APIKey{Name: "import", Prefix: "fk_aaaa", Permissions: []string{"read", "write"}}, "hash-a")
+	require.NoError(t, err)
+	_, err = CreateAPIKey(s, APIKey{Name: "import", Prefix: "fk_bbbb", Permissions: []string{"read"}}, "hash-b")
+	assert.ErrorIs(t, err, ErrAPIKeyExists)
+
+	key, err := ActiveAPIKey(s, "hash-a")
+	require.NoError(t, err)
+	assert.Equal(t, id, key.KeyId)
+	assert.Equal(t, []string{"read", "write"}, key.Permissions)
+	assert.Equal(t, "Admin", key.CreatedBy)
+	assert.Empty(t, key.LastUsedAt)
+	_, err = ActiveAPIKey(s, "hash-b")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, TouchAPIKey(s, id))
+	key, err = ActiveAPIKeyByName(s, "import")
+	require.NoError(t, err)
+	assert.NotEmpty(t, key.LastUsedAt)
+
+	// отозванный ключ не действует, а его имя снова свободно
+	require.NoError(t, RevokeAPIKey(s, id))
+	assert.ErrorIs(t, RevokeAPIKey(s, id), sql.ErrNoRows)
+	_, err = ActiveAPIKey(s, "hash-a")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = CreateAPIKey(s, APIKey{Name: "import", Prefix: "fk_bbbb", Permissions: []string{"read"}}, "hash-b")
+	require.NoError(t, err)
+
+	expired, err := CreateAPIKey(s, APIKey{Name: "old", Prefix: "fk_cccc", Permissions: []string{"read"}, ExpiresAt: "2020-01-01 00:00:00"}, "hash-c")
+	require.NoError(t, err)
+	_, err = ActiveAPIKey(s, "hash-c")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	keys, err := ListAPIKeys(s)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	assert.NotEmpty(t, keys[0].RevokedAt)
+	assert.Equal(t, "2020-01-01 00:00:00", keys[2].ExpiresAt)
+	assert.Equal(t, expired, keys[2].KeyId)
+}
@@ -0,0 +1,91 @@
+package sqlite
+
+// записи отдаются пачками по streamChunk: пачка читается целиком вместе со связями,
+// поэтому пока получатель обрабатывает записи, чтение из базы не держится открытым
+const streamChunk = 100
+
+// StreamFilms передаёт в fn фильмы по фильтру вместе с актёрами, жанрами и ролями
+// в порядке GetAllFilmsFromStorage. Ошибка fn прерывает выборку и возвращается как есть.
+func StreamFilms(s *Storage, filter FilmFilter, fn func(Film) error) error {
+	for offset := 0; ; offset += streamChunk {
+		films, err := filmPage(s, filter, streamChunk, offset)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int, 0, len(films))
+		for _, film := range films {
+			ids = append(ids, film.FilmId)
+		}
+
+		credits, err := CreditsForFilms(s, ids)
+		if err != nil {
+			return err
+		}
+
+		genres, err := GenresForFilms(s, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, film := range films {
+			film.Credits = []Credit{}
+			film.Actors = []Ref{}
+			for _, credit := range credits[film.FilmId] {
+				film.Credits = append(film.Credits, credit)
+				if credit.Role == RoleActor {
+					film.Actors = append(film.Actors, Ref{Id: credit.PersonId, Name: credit.Name})
+				}
+			}
+			film.Genres = genres[film.FilmId]
+
+			err = fn(film)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(films) < streamChunk {
+			return nil
+		}
+	}
+}
+
+// StreamActors передаёт в fn актёров, которые попадают в /actors, вместе с фильмами.
+// Непустой name ищет по части имени.
+func StreamActors(s *Storage, name string, fn func(Actor) error) error {
+	for offset := 0; ; offset += streamChunk {
+		actors, err := actorPage(s, name, streamChunk, offset)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int, 0, len(actors))
+		for _, actor := range actors {
+			ids = append(ids, actor.ActorId)
+		}
+
+		credits, err := CreditsForPeople(s, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, actor := range actors {
+			actor.Films = []Ref{}
+			for _, credit := range credits[actor.ActorId] {
+				if credit.Role == RoleActor {
+					actor.Films = append(actor.Films, Ref{Id: credit.FilmId, Name: credit.Title})
+				}
+			}
+
+			err = fn(actor)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(actors) < streamChunk {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PurgeDeleted окончательно удаляет фильмы и людей, пролежавшие в корзине дольше retention.
+// Возвращает число удалённых записей.
+func PurgeDeleted(s *Storage, retention time.Duration) (purged int, err error) {
+	cutoff := time.Now().UTC().Add(-retention).Format("2006-01-02 15:04:05")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	trash := []struct {
+		entity string
+		query  string
+		purge  func(tx *sql.Tx, id int64) error
+	}{
+		{EntityFilm, "SELECT FilmId FROM Films WHERE DeletedAt < :cutoff", purgeFilm},
+		{EntityPerson, "SELECT ActorId FROM Actors WHERE DeletedAt < :cutoff", purgeActor},
+	}
+
+	for _, t := range trash {
+		var ids []int64
+		ids, err = expiredIDs(tx, t.query, cutoff)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, id := range ids {
+			var before sql.NullString
+			before, err = snapshot(tx, SystemPrincipal, t.entity, id)
+			if err != nil {
+				return 0, err
+			}
+
+			err = t.purge(tx, id)
+			if err != nil {
+				return 0, err
+			}
+
+			err = audit(tx, SystemPrincipal, AuditPurge, t.entity, id, before)
+			if err != nil {
+				return 0, err
+			}
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func expiredIDs(tx *sql.Tx, query, cutoff string) ([]int64, error) {
+	rows, err := tx.Query(query, sql.Named("cutoff", cutoff))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,308 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+type WatchlistEntry struct {
+	Film    Ref    `json:"film"`
+	Note    string `json:"note"`
+	AddedAt string `json:"addedAt"`
+}
+
+type WatchedEntry struct {
+	Film      Ref    `json:"film"`
+	Note      string `json:"note"`
+	WatchedAt string `json:"watchedAt"`
+}
+
+// app.GetMyWatchlist(log, storage, w, r)
+func GetWatchlistFromStorage(s *Storage, login string) ([]WatchlistEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT Films.FilmId, Films.Title, Watchlist.Note, Watchlist.AddedAt
+		FROM Watchlist
+		JOIN Films ON Films.FilmId = Watchlist.FilmId
+		WHERE Watchlist.Login = :login AND Films.DeletedAt IS NULL
+		ORDER BY Watchlist.AddedAt DESC
+	`, sql.Named("login", login))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []WatchlistEntry{}
+	for rows.Next() {
+		var entry WatchlistEntry
+		if err := rows.Scan(&entry.Film.Id, &entry.Film.Name, &entry.Note, &entry.AddedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, entry)
+	}
+
+	return res, rows.Err()
+}
+
+// app.PostMyWatchlist(log, storage, w, r)
+func AddToWatchlist(s *Storage, login string, filmID int, note string) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, login, EntityWatchlist, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO Watchlist (Login, FilmId, Note, AddedAt)
+		SELECT :login, FilmId, :note, datetime('now') FROM Films WHERE FilmId = :id AND DeletedAt IS NULL
+		ON CONFLICT (Login, FilmId) DO UPDATE SET Note = excluded.Note
+	`,
+		sql.Named("login", login),
+		sql.Named("id", filmID),
+		sql.Named("note", note))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	action := AuditCreate
+	if before.Valid {
+		action = AuditUpdate
+	}
+	err = audit(tx, login, action, EntityWatchlist, int64(filmID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.DeleteMyWatchlist(log, storage, w, r)
+func RemoveFromWatchlist(s *Storage, login string, filmID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, login, EntityWatchlist, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM Watchlist WHERE Login = :login AND FilmId = :id",
+		sql.Named("login", login),
+		sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, login, AuditDelete, EntityWatchlist, int64(filmID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.GetMyWatched(log, storage, w, r)
+func GetWatchedFromStorage(s *Storage, login string) ([]WatchedEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT Films.FilmId, Films.Title, Watched.Note, Watched.WatchedAt
+		FROM Watched
+		JOIN Films ON Films.FilmId = Watched.FilmId
+		WHERE Watched.Login = :login AND Films.DeletedAt IS NULL
+		ORDER BY Watched.WatchedAt DESC
+	`, sql.Named("login", login))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []WatchedEntry{}
+	for rows.Next() {
+		var entry WatchedEntry
+		if err := rows.Scan(&entry.Film.Id, &entry.Film.Name, &entry.Note, &entry.WatchedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, entry)
+	}
+
+	return res, rows.Err()
+}
+
+// app.PostMyWatched(log, storage, w, r)
+//
+// Просмотренный фильм убирается из списка "буду смотреть". Дата хранится в ISO 8601.
+func MarkWatched(s *Storage, login string, filmID int, watchedAt, note string) (err error) {
+	watchedAt, err = NormalizeDate(watchedAt)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, login, EntityWatched, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	listed, err := snapshot(tx, login, EntityWatchlist, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO Watched (Login, FilmId, WatchedAt, Note)
+		SELECT :login, FilmId, :watchedAt, :note FROM Films WHERE FilmId = :id AND DeletedAt IS NULL
+		ON CONFLICT (Login, FilmId) DO UPDATE SET
+			WatchedAt = excluded.WatchedAt,
+			Note = excluded.Note
+	`,
+		sql.Named("login", login),
+		sql.Named("id", filmID),
+		sql.Named("watchedAt", watchedAt),
+		sql.Named("note", note))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Watchlist WHERE Login = :login AND FilmId = :id",
+		sql.Named("login", login),
+		sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	action := AuditCreate
+	if before.Valid {
+		action = AuditUpdate
+	}
+	err = audit(tx, login, action, EntityWatched, int64(filmID), before)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, login, AuditDelete, EntityWatchlist, int64(filmID), listed)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// app.DeleteMyWatched(log, storage, w, r)
+func UnmarkWatched(s *Storage, login string, filmID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, login, EntityWatched, int64(filmID))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM Watched WHERE Login = :login AND FilmId = :id",
+		sql.Named("login", login),
+		sql.Named("id", filmID))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	err = audit(tx, login, AuditDelete, EntityWatched, int64(filmID), before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FillViewerFlags отмечает фильмы, которые пользователь добавил в список или уже посмотрел
+func FillViewerFlags(s *Storage, login string, films []Film) error {
+	rows, err := s.db.Query(`
+		SELECT FilmId, 'watchlist' FROM Watchlist WHERE Login = :login
+		UNION ALL
+		SELECT FilmId, 'watched' FROM Watched WHERE Login = :login
+	`, sql.Named("login", login))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	watchlist := map[int]bool{}
+	watched := map[int]bool{}
+	for rows.Next() {
+		var filmID int
+		var list string
+		if err := rows.Scan(&filmID, &list); err != nil {
+			return err
+		}
+		if list == "watchlist" {
+			watchlist[filmID] = true
+		} else {
+			watched[filmID] = true
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range films {
+		films[i].InWatchlist = watchlist[films[i].FilmId]
+		films[i].Watched = watched[films[i].FilmId]
+	}
+
+	return nil
+}
@@ -0,0 +1,479 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// состояния доставки события подписчику. dead - попытки кончились, доставка ждёт ручного повтора
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// формат NextAttemptAt, CreatedAt и других времён доставок, как у datetime('now')
+const deliveryTimeLayout = "2006-01-02 15:04:05"
+
+// Webhook - подписка на события ленты. Events - типы вида film.created, см. ValidWebhookEvent
+type Webhook struct {
+	WebhookId int      `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	Active    bool     `json:"active"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+// Delivery - отправка одного события одному подписчику.
+// URL и Secret заполняет только DueDeliveries для отправки.
+type Delivery struct {
+	DeliveryId    int               `json:"id"`
+	WebhookId     int               `json:"webhookId"`
+	EventId       int               `json:"eventId"`
+	Event         string            `json:"event"`
+	Payload       json.RawMessage   `json:"payload"`
+	Status        string            `json:"status"`
+	Attempts      int               `json:"attempts"`
+	NextAttemptAt string            `json:"nextAttemptAt,omitempty"`
+	LastError     string            `json:"lastError,omitempty"`
+	CreatedAt     string            `json:"createdAt"`
+	DeliveredAt   string            `json:"deliveredAt,omitempty"`
+	Log           []DeliveryAttempt `json:"log"`
+
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// DeliveryAttempt - запись журнала доставки. StatusCode 0 - ответа не было, причина в Error
+type DeliveryAttempt struct {
+	StatusCode  int    `json:"statusCode"`
+	Error       string `json:"error,omitempty"`
+	DurationMs  int    `json:"durationMs"`
+	AttemptedAt string `json:"attemptedAt"`
+}
+
+type DeliveryPage struct {
+	Deliveries []Delivery `json:"deliveries"`
+	Page       int        `json:"page"`
+	Limit      int        `json:"limit"`
+	Total      int        `json:"total"`
+}
+
+// ValidWebhookEvent проверяет тип события подписки: сущность и событие ленты через точку
+func ValidWebhookEvent(event string) bool {
+	for _, entity := range []string{EntityFilm, EntityPerson} {
+		for _, eventType := range []string{EventCreated, EventUpdated, EventDeleted} {
+			if event == entity+"."+eventType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func ValidDeliveryStatus(status string) bool {
+	return status == DeliveryPending || status == DeliveryDelivered || status == DeliveryDead
+}
+
+// addDeliveries ставит в очередь только что записанное событие для подходящих активных подписок.
+// Вызывается из addEvent в транзакции изменения, поэтому доставки есть ровно у зафиксированных изменений.
+func addDeliveries(tx *sql.Tx, eventID int64) error {
+	_, err := tx.Exec(`
+		INSERT INTO WebhookDeliveries (WebhookId, EventId, Event, Payload, Status, Attempts, NextAttemptAt, CreatedAt)
+		SELECT Webhooks.WebhookId, Events.EventId, Events.EntityType || '.' || Events.Type,
+			json_object('id', Events.EventId, 'type', Events.Type, 'entity', Events.EntityType,
+				'entityId', Events.EntityId, 'createdAt', Events.CreatedAt),
+			:pending, 0, Events.CreatedAt, Events.CreatedAt
+		FROM Events
+		JOIN Webhooks ON Webhooks.Active
+			AND EXISTS (SELECT 1 FROM json_each(Webhooks.Events) WHERE value = Events.EntityType || '.' || Events.Type)
+		WHERE Events.EventId = :id
+	`, sql.Named("id", eventID), sql.Named("pending", DeliveryPending))
+	return err
+}
+
+func scanWebhook(row scanner) (Webhook, error) {
+	var webhook Webhook
+	var events string
+	err := row.Scan(&webhook.WebhookId, &webhook.URL, &events, &webhook.Secret, &webhook.Active, &webhook.CreatedAt)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	err = json.Unmarshal([]byte(events), &webhook.Events)
+	return webhook, err
+}
+
+// app.GetWebhooks(log, storage, w, r)
+func ListWebhooks(s *Storage) ([]Webhook, error) {
+	rows, err := s.db.Query(`
+		SELECT WebhookId, URL, Events, Secret, Active, CreatedAt
+		FROM Webhooks
+		ORDER BY WebhookId
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// app.GetOneWebhook(log, storage, w, r)
+func GetWebhook(s *Storage, id int) (Webhook, error) {
+	return scanWebhook(s.db.QueryRow(`
+		SELECT WebhookId, URL, Events, Secret, Active, CreatedAt
+		FROM Webhooks
+		WHERE WebhookId = :id
+	`, sql.Named("id", id)))
+}
+
+// app.PostWebhook(log, storage, w, r)
+func CreateWebhook(s *Storage, webhook Webhook) (webhookID int, err error) {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	result, err := tx.Exec(`
+		INSERT INTO Webhooks (URL, Events, Secret, Active, CreatedAt)
+		VALUES (:url, :events, :secret, :active, datetime('now'))
+	`,
+		sql.Named("url", webhook.URL),
+		sql.Named("events", string(events)),
+		sql.Named("secret", webhook.Secret),
+		sql.Named("active", webhook.Active))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = audit(tx, s.auditPrincipal(), AuditCreate, EntityWebhook, id, sql.NullString{})
+	return int(id), err
+}
+
+// app.PutOneWebhook(log, storage, w, r)
+//
+// Уже поставленные в очередь доставки отправляются по новому URL с новым секретом.
+func UpdateWebhook(s *Storage, webhook Webhook) (err error) {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, s.principal, EntityWebhook, int64(webhook.WebhookId))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE Webhooks SET URL = :url, Events = :events, Secret = :secret, Active = :active
+		WHERE WebhookId = :id
+	`,
+		sql.Named("url", webhook.URL),
+		sql.Named("events", string(events)),
+		sql.Named("secret", webhook.Secret),
+		sql.Named("active", webhook.Active),
+		sql.Named("id", webhook.WebhookId))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, s.auditPrincipal(), AuditUpdate, EntityWebhook, int64(webhook.WebhookId), before)
+}
+
+// app.DeleteOneWebhook(log, storage, w, r)
+//
+// Подписка удаляется вместе с очередью и журналом доставок.
+func DeleteWebhook(s *Storage, id int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before, err := snapshot(tx, s.principal, EntityWebhook, int64(id))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM WebhookAttempts
+		WHERE DeliveryId IN (SELECT DeliveryId FROM WebhookDeliveries WHERE WebhookId = :id)
+	`, sql.Named("id", id))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM WebhookDeliveries WHERE WebhookId = :id", sql.Named("id", id))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM Webhooks WHERE WebhookId = :id", sql.Named("id", id))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, s.auditPrincipal(), AuditDelete, EntityWebhook, int64(id), before)
+}
+
+// столбцы доставки вместе с журналом попыток для scanDelivery
+const deliveryColumns = `
+	DeliveryId, WebhookId, EventId, Event, Payload, Status, Attempts,
+	COALESCE(NextAttemptAt, ''), COALESCE(LastError, ''), WebhookDeliveries.CreatedAt, COALESCE(DeliveredAt, ''),
+	(SELECT json_group_array(json_object(
+			'statusCode', StatusCode, 'error', Error, 'durationMs', DurationMs, 'attemptedAt', AttemptedAt)
+			ORDER BY AttemptId)
+		FROM WebhookAttempts WHERE WebhookAttempts.DeliveryId = WebhookDeliveries.DeliveryId)`
+
+func scanDelivery(row scanner, dest ...any) (Delivery, error) {
+	var delivery Delivery
+	var payload, attempts string
+	err := row.Scan(append([]any{&delivery.DeliveryId, &delivery.WebhookId, &delivery.EventId, &delivery.Event,
+		&payload, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastError,
+		&delivery.CreatedAt, &delivery.DeliveredAt, &attempts}, dest...)...)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	delivery.Payload = json.RawMessage(payload)
+	err = json.Unmarshal([]byte(attempts), &delivery.Log)
+	return delivery, err
+}
+
+// app.GetWebhookDeliveries(log, storage, w, r)
+//
+// Новые доставки первыми, пустой status возвращает доставки в любом состоянии.
+func GetDeliveries(s *Storage, webhookID int, status string, page, limit int) (DeliveryPage, error) {
+	res := DeliveryPage{Deliveries: []Delivery{}, Page: page, Limit: limit}
+
+	where := " WHERE WebhookId = :webhook AND (:status = '' OR Status = :status)"
+	args := []any{sql.Named("webhook", webhookID), sql.Named("status", status)}
+
+	err := s.db.QueryRow("SELECT COUNT(*) FROM WebhookDeliveries"+where, args...).Scan(&res.Total)
+	if err != nil {
+		return DeliveryPage{}, err
+	}
+
+	rows, err := s.db.Query("SELECT"+deliveryColumns+" FROM WebhookDeliveries"+where+`
+		ORDER BY DeliveryId DESC
+		LIMIT :limit OFFSET :offset
+	`, append(args, sql.Named("limit", limit), sql.Named("offset", (page-1)*limit))...)
+	if err != nil {
+		return DeliveryPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return DeliveryPage{}, err
+		}
+		res.Deliveries = append(res.Deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return DeliveryPage{}, err
+	}
+
+	return res, nil
+}
+
+// DueDeliveries возвращает до limit доставок, время попытки которых наступило к now, по порядку событий
+func DueDeliveries(s *Storage, now time.Time, limit int) ([]Delivery, error) {
+	rows, err := s.db.Query("SELECT"+deliveryColumns+`, Webhooks.URL, Webhooks.Secret
+		FROM WebhookDeliveries
+		JOIN Webhooks USING (WebhookId)
+		WHERE Status = :pending AND NextAttemptAt <= :now
+		ORDER BY EventId, DeliveryId
+		LIMIT :limit
+	`,
+		sql.Named("pending", DeliveryPending),
+		sql.Named("now", now.UTC().Format(deliveryTimeLayout)),
+		sql.Named("limit", limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var url, secret string
+		delivery, err := scanDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, err
+		}
+		delivery.URL, delivery.Secret = url, secret
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordAttempt заносит попытку в журнал и переводит доставку в status.
+// Для pending next - время следующей попытки, для остальных состояний не используется.
+func RecordAttempt(s *Storage, deliveryID int, attempt DeliveryAttempt, status string, next time.Time) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	_, err = tx.Exec(`
+		INSERT INTO WebhookAttempts (DeliveryId, StatusCode, Error, DurationMs, AttemptedAt)
+		VALUES (:id, :code, :error, :duration, :at)
+	`,
+		sql.Named("id", deliveryID),
+		sql.Named("code", attempt.StatusCode),
+		sql.Named("error", attempt.Error),
+		sql.Named("duration", attempt.DurationMs),
+		sql.Named("at", attempt.AttemptedAt))
+	if err != nil {
+		return err
+	}
+
+	var nextAttemptAt, deliveredAt any
+	switch status {
+	case DeliveryPending:
+		nextAttemptAt = next.UTC().Format(deliveryTimeLayout)
+	case DeliveryDelivered:
+		deliveredAt = attempt.AttemptedAt
+	}
+
+	result, err := tx.Exec(`
+		UPDATE WebhookDeliveries
+		SET Status = :status, Attempts = Attempts + 1, NextAttemptAt = :next,
+			LastError = NULLIF(:error, ''), DeliveredAt = :delivered
+		WHERE DeliveryId = :id
+	`,
+		sql.Named("status", status),
+		sql.Named("next", nextAttemptAt),
+		sql.Named("error", attempt.Error),
+		sql.Named("delivered", deliveredAt),
+		sql.Named("id", deliveryID))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	return err
+}
+
+// app.PostDeliveryRetry(log, storage, w, r)
+//
+// RetryDelivery возвращает доставку из dead в очередь с новым набором попыток.
+// Доставки в других состояниях не меняются, тогда возвращается sql.ErrNoRows.
+func RetryDelivery(s *Storage, webhookID, deliveryID int) error {
+	result, err := s.db.Exec(`
+		UPDATE WebhookDeliveries
+		SET Status = :pending, Attempts = 0, NextAttemptAt = datetime('now')
+		WHERE DeliveryId = :id AND WebhookId = :webhook AND Status = :dead
+	`,
+		sql.Named("pending", DeliveryPending),
+		sql.Named("dead", DeliveryDead),
+		sql.Named("id", deliveryID),
+		sql.Named("webhook", webhookID))
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+// PruneDeliveries удаляет завершённые доставки старше retention вместе с журналом и возвращает их число.
+// Доставки в очереди не удаляются: их содержимое хранится в них самих, а не в Events.
+func PruneDeliveries(s *Storage, retention time.Duration) (pruned int, err error) {
+	cutoff := time.Now().UTC().Add(-retention).Format(deliveryTimeLayout)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	finished := `
+		SELECT DeliveryId FROM WebhookDeliveries
+		WHERE Status <> :pending AND CreatedAt < :cutoff`
+	args := []any{sql.Named("pending", DeliveryPending), sql.Named("cutoff", cutoff)}
+
+	_, err = tx.Exec("DELETE FROM WebhookAttempts WHERE DeliveryId IN ("+finished+")", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("DELETE FROM WebhookDeliveries WHERE DeliveryId IN ("+finished+")", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,90 @@
+package verify
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"vk-testovoe/filmoteka/storage"
+)
+
+// запросы по ключу API выполняются под логином key/<имя ключа>, он и попадает в журнал изменений
+const KeyLoginPrefix = sqlite.KeyLoginPrefix
+
+// ключ - "fk_" и 48 hex-символов, начало до keyPrefixLen показывается в списке ключей
+const (
+	keyScheme    = "fk_"
+	keyPrefixLen = len(keyScheme) + 8
+)
+
+func KeyLogin(name string) string {
+	return KeyLoginPrefix + name
+}
+
+func IsKeyLogin(login string) bool {
+	return strings.HasPrefix(login, KeyLoginPrefix)
+}
+
+// NewKey возвращает новый ключ и его начало для списка ключей
+func NewKey() (key, prefix string, err error) {
+	secret := make([]byte, 24)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	key = keyScheme + hex.EncodeToString(secret)
+	return key, key[:keyPrefixLen], nil
+}
+
+// HashKey - хеш ключа в том виде, в котором он хранится в ApiKeys. Ключ случайный и длинный,
+// поэтому, в отличие от пароля, его не подобрать по словарю и соль не нужна
+func HashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// Key возвращает активный ключ, ErrWrongCredentials - если ключа нет, он отозван или истёк
+func Key(s *sqlite.Storage, key string) (sqlite.APIKey, error) {
+	stored, err := sqlite.ActiveAPIKey(s, HashKey(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return sqlite.APIKey{}, ErrWrongCredentials
+	}
+	return stored, err
+}
+
+// ValidKeyPermission проверяет право для ключа: оно должно существовать, а выдавать ключи
+// может только пользователь, иначе утёкший ключ мог бы выпустить себе замену
+func ValidKeyPermission(permission string) bool {
+	if permission == KeysPermission {
+		return false
+	}
+	for _, permissions := range rolePermissions {
+		for _, p := range permissions {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keyPermissions проверяет ключ, переданный паролем к логину key/<имя>, и отмечает его использование
+func keyPermissions(s *sqlite.Storage, login, key string) ([]string, error) {
+	stored, err := Key(s, key)
+	if err != nil {
+		return nil, err
+	}
+	if KeyLogin(stored.Name) != login {
+		return nil, ErrWrongCredentials
+	}
+
+	err = sqlite.TouchAPIKey(s, stored.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	return stored.Permissions, nil
+}
@@ -0,0 +1,179 @@
+package verify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"vk-testovoe/filmoteka/config"
+)
+
+// LimitStore хранит счётчики и блокировки Limiter. MemoryStore держит их в памяти процесса,
+// для нескольких экземпляров сервиса за балансировщиком нужна общая реализация, например в Redis
+type LimitStore interface {
+	// Incr увеличивает счётчик key и возвращает новое значение и время до его сброса.
+	// Счётчик живёт ttl с первого увеличения
+	Incr(ctx context.Context, key string, ttl time.Duration) (int, time.Duration, error)
+	// Block закрывает key на d, более ранняя блокировка продлевается
+	Block(ctx context.Context, key string, d time.Duration) error
+	// Blocked возвращает, сколько ещё key закрыт, 0 - не закрыт
+	Blocked(ctx context.Context, key string) (time.Duration, error)
+}
+
+// Limiter ограничивает запросы с одного адреса и под одним логином и закрывает их
+// после нескольких неверных паролей за FailureWindow. Каждая следующая неудача удваивает блокировку.
+// Верный пароль неудачи не сбрасывает, они истекают сами: иначе перебор можно было бы
+// перемежать входом под своим логином
+type Limiter struct {
+	cfg   config.RateLimit
+	store LimitStore
+}
+
+func NewLimiter(cfg config.RateLimit, store LimitStore) *Limiter {
+	return &Limiter{cfg: cfg, store: store}
+}
+
+// Allow учитывает запрос с адреса ip под логином login (пустой - без авторизации)
+// и возвращает, через сколько его можно повторить, если он превысил лимит или адрес либо логин закрыты
+func (l *Limiter) Allow(ctx context.Context, ip, login string) (time.Duration, error) {
+	keys := []string{"ip:" + ip}
+	if login != "" {
+		keys = append(keys, "login:"+login)
+	}
+
+	for _, key := range keys {
+		wait, err := l.store.Blocked(ctx, key)
+		if err != nil || wait > 0 {
+			return wait, err
+		}
+	}
+
+	limits := []int{l.cfg.IPRequests, l.cfg.LoginRequests}
+	for i, key := range keys {
+		if limits[i] <= 0 || l.cfg.Window <= 0 {
+			continue
+		}
+		count, reset, err := l.store.Incr(ctx, "rate:"+key, l.cfg.Window)
+		if err != nil {
+			return 0, err
+		}
+		if count > limits[i] {
+			return reset, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// Failure учитывает неверный пароль и возвращает блокировку, если она началась
+func (l *Limiter) Failure(ctx context.Context, ip, login string) (time.Duration, error) {
+	var lockout time.Duration
+	for key, limit := range map[string]int{"ip:" + ip: l.cfg.IPFailures, "login:" + login: l.cfg.LoginFailures} {
+		if limit <= 0 || l.cfg.FailureWindow <= 0 {
+			continue
+		}
+
+		failures, _, err := l.store.Incr(ctx, "failures:"+key, l.cfg.FailureWindow)
+		if err != nil {
+			return 0, err
+		}
+		if failures < limit {
+			continue
+		}
+
+		d := l.lockout(failures - limit)
+		err = l.store.Block(ctx, key, d)
+		if err != nil {
+			return 0, err
+		}
+		lockout = max(lockout, d)
+	}
+
+	return lockout, nil
+}
+
+// lockout - блокировка после n неудач сверх порога: Lockout, затем вдвое больше до MaxLockout
+func (l *Limiter) lockout(n int) time.Duration {
+	d := l.cfg.Lockout
+	for i := 0; i < n && (l.cfg.MaxLockout <= 0 || d < l.cfg.MaxLockout); i++ {
+		d *= 2
+	}
+	if l.cfg.MaxLockout > 0 {
+		d = min(d, l.cfg.MaxLockout)
+	}
+	return d
+}
+
+type memoryCounter struct {
+	count   int
+	expires time.Time
+}
+
+// MemoryStore - LimitStore в памяти процесса. Истёкшие записи удаляются раз в минуту при обращении
+type MemoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]memoryCounter
+	blocks    map[string]time.Time
+	nextSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: map[string]memoryCounter{}, blocks: map[string]time.Time{}}
+}
+
+func (m *MemoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sweep(now)
+
+	counter := m.counters[key]
+	if !now.Before(counter.expires) {
+		counter = memoryCounter{expires: now.Add(ttl)}
+	}
+	counter.count++
+	m.counters[key] = counter
+
+	return counter.count, counter.expires.Sub(now), nil
+}
+
+func (m *MemoryStore) Block(ctx context.Context, key string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(m.blocks[key]) {
+		m.blocks[key] = until
+	}
+	return nil
+}
+
+func (m *MemoryStore) Blocked(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wait := time.Until(m.blocks[key])
+	if wait <= 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
+
+// sweep удаляет истёкшие счётчики и блокировки, чтобы перебор случайных логинов не занимал память
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Before(m.nextSweep) {
+		return
+	}
+	m.nextSweep = now.Add(time.Minute)
+
+	for key, counter := range m.counters {
+		if !now.Before(counter.expires) {
+			delete(m.counters, key)
+		}
+	}
+	for key, until := range m.blocks {
+		if !now.Before(until) {
+			delete(m.blocks, key)
+		}
+	}
+}
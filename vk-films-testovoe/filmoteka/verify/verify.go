@@ -2,8 +2,11 @@ package verify
 
 import (
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
+	"errors"
 	"log/slog"
+	"strings"
 
 	"vk-testovoe/filmoteka/storage"
 
@@ -11,8 +14,12 @@ import (
 )
 
 const (
-	ReadPermission  = "read"
-	WritePermission = "write"
+	ReadPermission     = "read"
+	WritePermission    = "write"
+	ModeratePermission = "moderate"
+	AuditPermission    = "audit"
+	WebhooksPermission = "webhooks"
+	KeysPermission     = "keys"
 
 	AdminRole = "admin"
 	UserRole  = "user"
@@ -20,49 +27,92 @@ const (
 
 var (
 	rolePermissions = map[string][]string{
-		AdminRole: {ReadPermission, WritePermission},
+		AdminRole: {ReadPermission, WritePermission, ModeratePermission, AuditPermission, WebhooksPermission, KeysPermission},
 		UserRole:  {ReadPermission},
 	}
 )
 
-var (
-	userRoles = map[string][]string{
-		"User":  {UserRole},
-		"Admin": {AdminRole},
-	}
-)
+// ValidRole проверяет, что роль существует
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
 
-func User(user, pass string, log *slog.Logger, permission string, s *sqlite.Storage) bool {
+// HashPassword - хеш пароля в том виде, в котором он хранится в Users
+func HashPassword(pass string) string {
 	hashedPassword := sha256.Sum256([]byte(pass))
-	hashStringPassword := hex.EncodeToString(hashedPassword[:])
+	return hex.EncodeToString(hashedPassword[:])
+}
+
+// ErrWrongCredentials - нет такого пользователя или пароль не совпал
+var ErrWrongCredentials = errors.New("wrong login or password")
+
+// Authenticate проверяет логин и пароль и возвращает права пользователя.
+// Для логина key/<имя> паролем служит ключ API, права - те, на которые он выдан
+func Authenticate(s *sqlite.Storage, user, pass string) ([]string, error) {
+	if IsKeyLogin(user) {
+		return keyPermissions(s, user, pass)
+	}
 
-	userPassword, err := sqlite.GetUsers(s)
+	stored, err := sqlite.GetUser(s, user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWrongCredentials
+	}
 	if err != nil {
-		log.Error("cant get users: %v", err)
-		return false
+		return nil, err
 	}
-	storedPassword, ok := userPassword[user]
 
-	if !ok {
-		log.Error("no such user in storage")
-		return false
+	if HashPassword(pass) != stored.Password {
+		return nil, ErrWrongCredentials
 	}
+	return rolePermissions[stored.Role], nil
+}
 
-	if hashStringPassword != storedPassword {
-		log.Info("wrong password")
+func User(user, pass string, log *slog.Logger, permission string, s *sqlite.Storage) bool {
+	permissions, err := Authenticate(s, user, pass)
+	if errors.Is(err, ErrWrongCredentials) {
+		log.Info("wrong login or password")
+		return false
+	}
+	if err != nil {
+		log.Error("cant get user", slog.Any("error", err))
 		return false
 	}
 
-	for _, roles := range userRoles[user] {
-		for _, storedPermission := range rolePermissions[roles] {
-			if permission == storedPermission {
-				log.Info("access is allowed")
-				return true
-			}
-		}
+	if hasPermission(permissions, permission) {
+		log.Info("access is allowed")
+		return true
 	}
 
 	log.Info("not necessary role")
 	return false
 
 }
+
+// HasPermission проверяет права пользователя или ключа API, который уже прошёл проверку пароля
+func HasPermission(s *sqlite.Storage, user, permission string) bool {
+	if IsKeyLogin(user) {
+		key, err := sqlite.ActiveAPIKeyByName(s, strings.TrimPrefix(user, KeyLoginPrefix))
+		return err == nil && hasPermission(key.Permissions, permission)
+	}
+
+	stored, err := sqlite.GetUser(s, user)
+	if err != nil {
+		return false
+	}
+	return hasPermission(rolePermissions[stored.Role], permission)
+}
+
+// Allows проверяет, что среди прав, которые вернул Authenticate, есть permission
+func Allows(permissions []string, permission string) bool {
+	return hasPermission(permissions, permission)
+}
+
+func hasPermission(permissions []string, permission string) bool {
+	for _, storedPermission := range permissions {
+		if permission == storedPermission {
+			return true
+		}
+	}
+	return false
+}